@@ -0,0 +1,924 @@
+package spruce
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+)
+
+// The (( calc )) expression language is a small, C-like one.  From lowest
+// to highest precedence:
+//
+//	c ? a : b                ternary conditional
+//	||  &&                   logical or, and
+//	== != < <= > >= =~ !~    comparison, regular expression matching
+//	|  ^  &                  bitwise or, exclusive or, and
+//	<<  >>                   bit shifts
+//	+  -                     addition (and string concatenation), subtraction
+//	*  /  //  %              multiplication, division, integer division, modulo
+//	-  +  !  ~               unary operators
+//	**                       exponentiation
+//
+// Operands are integer and floating point numbers, 'single' or "double"
+// quoted strings, true and false, function calls, and references to other
+// parts of the document.  Integers stay integers for as long as possible.
+
+type calcNode interface{}
+
+type calcLiteral struct {
+	value interface{}
+}
+
+type calcRef struct {
+	src    string
+	cursor *tree.Cursor
+}
+
+type calcUnary struct {
+	op string
+	x  calcNode
+}
+
+type calcBinary struct {
+	op   string
+	l, r calcNode
+}
+
+type calcTernary struct {
+	cond, then, otherwise calcNode
+}
+
+type calcCall struct {
+	name string
+	args []calcNode
+}
+
+// calcValue is an intermediate value, along with the reference it came
+// from (if any), for error messages
+type calcValue struct {
+	v   interface{}
+	ref string
+}
+
+// CalcExpr is a parsed (( calc )) expression
+type CalcExpr struct {
+	src  string
+	root calcNode
+	refs []*calcRef
+}
+
+var calcBinaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "=~": 3, "!~": 3,
+	"|":  4,
+	"^":  5,
+	"&":  6,
+	"<<": 7, ">>": 7,
+	"+": 8, "-": 8,
+	"*": 9, "/": 9, "//": 9, "%": 9,
+}
+
+// longest operators first, so that "**" is not lexed as two "*"
+var calcOperators = []string{
+	"**", "//", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "=~", "!~",
+	"+", "-", "*", "/", "%", "&", "|", "^", "~", "!", "<", ">", "?", ":", "(", ")", ",",
+}
+
+type calcToken struct {
+	kind  string // "num", "str", "ident", "op" or "eof"
+	text  string
+	value interface{}
+	pos   int
+}
+
+type calcParser struct {
+	tokens []calcToken
+	pos    int
+	refs   []*calcRef
+}
+
+// ParseCalc parses a (( calc )) expression
+func ParseCalc(src string) (*CalcExpr, error) {
+	tokens, err := lexCalc(src)
+	if err != nil {
+		return nil, ansi.Errorf("@R{invalid calc expression} @c{%s}@R{:} %s", src, err)
+	}
+
+	p := &calcParser{tokens: tokens}
+	root, err := p.ternary()
+	if err == nil && p.peek().kind != "eof" {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, ansi.Errorf("@R{invalid calc expression} @c{%s}@R{:} %s", src, err)
+	}
+	return &CalcExpr{src: src, root: root, refs: p.refs}, nil
+}
+
+func isCalcIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isCalcIdent(c byte) bool {
+	return isCalcIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func lexCalc(src string) ([]calcToken, error) {
+	tokens := []calcToken{}
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (isCalcIdent(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E') && !strings.HasPrefix(strings.ToLower(src[start:]), "0x"))) {
+				i++
+			}
+			text := src[start:i]
+			if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+				tokens = append(tokens, calcToken{kind: "num", text: text, value: n, pos: start})
+			} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+				tokens = append(tokens, calcToken{kind: "num", text: text, value: f, pos: start})
+			} else {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", text, start)
+			}
+
+		case c == '\'' || c == '"':
+			start := i
+			var b strings.Builder
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, calcToken{kind: "str", text: src[start:i], value: b.String(), pos: start})
+
+		case isCalcIdentStart(c):
+			// references are dotted paths; only the first segment has to
+			// look like an identifier, since keys like `custom-extras` or
+			// list indices are common further down
+			start := i
+			for i < len(src) && isCalcIdent(src[i]) {
+				i++
+			}
+			for i+1 < len(src) && src[i] == '.' && (isCalcIdent(src[i+1]) || src[i+1] == '-') {
+				for i++; i < len(src) && (isCalcIdent(src[i]) || src[i] == '-'); i++ {
+				}
+			}
+			tokens = append(tokens, calcToken{kind: "ident", text: src[start:i], pos: start})
+
+		default:
+			found := false
+			for _, op := range calcOperators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, calcToken{kind: "op", text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				r, _ := utf8.DecodeRuneInString(src[i:])
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+			}
+		}
+	}
+	return append(tokens, calcToken{kind: "eof", pos: len(src)}), nil
+}
+
+func (p *calcParser) peek() calcToken {
+	return p.tokens[p.pos]
+}
+
+func (p *calcParser) next() {
+	if p.tokens[p.pos].kind != "eof" {
+		p.pos++
+	}
+}
+
+func (p *calcParser) accept(op string) bool {
+	if t := p.peek(); t.kind == "op" && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *calcParser) unexpected() error {
+	t := p.peek()
+	if t.kind == "eof" {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos)
+}
+
+func (p *calcParser) ternary() (calcNode, error) {
+	cond, err := p.binary(1)
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(":") {
+		return nil, p.unexpected()
+	}
+	otherwise, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return &calcTernary{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *calcParser) binary(minPrec int) (calcNode, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := calcBinaryPrecedence[t.text]
+		if t.kind != "op" || !ok || prec < minPrec {
+			return l, nil
+		}
+		p.next()
+		r, err := p.binary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &calcBinary{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *calcParser) unary() (calcNode, error) {
+	if t := p.peek(); t.kind == "op" && (t.text == "-" || t.text == "+" || t.text == "!" || t.text == "~") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &calcUnary{op: t.text, x: x}, nil
+	}
+
+	base, err := p.primary()
+	if err != nil || !p.accept("**") {
+		return base, err
+	}
+	// exponentiation is right-associative, and binds tighter than a
+	// unary minus on its left, but not on its right: -2 ** -1 == -(2 ** (-1))
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &calcBinary{op: "**", l: base, r: exp}, nil
+}
+
+func (p *calcParser) primary() (calcNode, error) {
+	t := p.peek()
+	switch {
+	case t.kind == "num" || t.kind == "str":
+		p.next()
+		return &calcLiteral{value: t.value}, nil
+
+	case t.kind == "ident" && (t.text == "true" || t.text == "false"):
+		p.next()
+		return &calcLiteral{value: t.text == "true"}, nil
+
+	case t.kind == "ident":
+		p.next()
+		if p.accept("(") {
+			return p.call(t.text)
+		}
+
+		cursor, err := tree.ParseCursor(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference '%s' at position %d", t.text, t.pos)
+		}
+		ref := &calcRef{src: t.text, cursor: cursor}
+		p.refs = append(p.refs, ref)
+		return ref, nil
+
+	case t.kind == "op" && t.text == "(":
+		p.next()
+		x, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.unexpected()
+		}
+		return x, nil
+	}
+	return nil, p.unexpected()
+}
+
+func (p *calcParser) call(name string) (calcNode, error) {
+	call := &calcCall{name: name}
+	if p.accept(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.accept(")") {
+			return call, nil
+		}
+		if !p.accept(",") {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// String ...
+func (e *CalcExpr) String() string {
+	return e.src
+}
+
+// References returns the paths that the expression refers to.  Bare words
+// (without any dots) only count as references if they exist at the top of
+// the document; everything else is a named variable, which calc does not
+// support.
+func (e *CalcExpr) References(root map[interface{}]interface{}) ([]*tree.Cursor, []string) {
+	refs := []*tree.Cursor{}
+	unknown := []string{}
+	seen := map[string]bool{}
+	for _, ref := range e.refs {
+		if !strings.Contains(ref.src, ".") {
+			if _, ok := root[ref.src]; !ok {
+				if !seen[ref.src] {
+					unknown = append(unknown, ref.src)
+				}
+				seen[ref.src] = true
+				continue
+			}
+		}
+		refs = append(refs, ref.cursor)
+	}
+	return refs, unknown
+}
+
+// Evaluate evaluates the expression against the given document, and
+// returns an int64, float64, string or bool.  Floating point results
+// without a fractional part are turned into integers.
+func (e *CalcExpr) Evaluate(root map[interface{}]interface{}) (interface{}, error) {
+	if _, unknown := e.References(root); len(unknown) > 0 {
+		return nil, ansi.Errorf("@R{calc operator does not support named variables in expression:} @r{%s}", strings.Join(unknown, ", "))
+	}
+
+	v, err := (&calcEval{root: root}).eval(e.root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := v.v.(type) {
+	case float64:
+		if i := int64(x); float64(i) == x && math.Abs(x) < 1<<63 {
+			return i, nil
+		}
+	case map[interface{}]interface{}, []interface{}:
+		return nil, calcTypeError(v, "")
+	}
+	return v.v, nil
+}
+
+type calcEval struct {
+	root map[interface{}]interface{}
+}
+
+// calcTypeError explains that v cannot be used (with op)
+func calcTypeError(v calcValue, op string) error {
+	kind := "nil"
+	if v.v != nil {
+		kind = reflect.TypeOf(v.v).Kind().String()
+	}
+	if v.ref != "" {
+		return ansi.Errorf("@R{path} @r{%s} @R{is of type} @r{%s}@R{, which cannot be used in calculations}", v.ref, kind)
+	}
+	if op != "" {
+		return ansi.Errorf("@R{operator} @r{%s} @R{cannot be used with} @r{%s} @R{values like} @r{%#v}", op, kind, v.v)
+	}
+	return ansi.Errorf("@r{%#v} @R{is of type} @r{%s}@R{, which cannot be used in calculations}", v.v, kind)
+}
+
+func calcNormalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint:
+		if x <= math.MaxInt64 {
+			return int64(x)
+		}
+		return float64(x)
+	case uint64:
+		if x <= math.MaxInt64 {
+			return int64(x)
+		}
+		return float64(x)
+	case float32:
+		return float64(x)
+	}
+	return v
+}
+
+func (c *calcEval) eval(n calcNode) (calcValue, error) {
+	switch n := n.(type) {
+	case *calcLiteral:
+		return calcValue{v: n.value}, nil
+
+	case *calcRef:
+		v, err := n.cursor.Resolve(c.root)
+		if err != nil {
+			return calcValue{}, err
+		}
+		if v == nil {
+			return calcValue{}, ansi.Errorf("@R{path} @r{%s} @R{references a }@r{nil}@R{ value, which cannot be used in calculations}", n.cursor)
+		}
+		return calcValue{v: calcNormalize(v), ref: n.cursor.String()}, nil
+
+	case *calcUnary:
+		x, err := c.eval(n.x)
+		if err != nil {
+			return calcValue{}, err
+		}
+		return calcUnaryOp(n.op, x)
+
+	case *calcTernary:
+		cond, err := c.bool(n.cond, "?")
+		if err != nil {
+			return calcValue{}, err
+		}
+		if cond {
+			return c.eval(n.then)
+		}
+		return c.eval(n.otherwise)
+
+	case *calcBinary:
+		if n.op == "&&" || n.op == "||" {
+			l, err := c.bool(n.l, n.op)
+			if err != nil {
+				return calcValue{}, err
+			}
+			if (n.op == "&&") != l {
+				return calcValue{v: l}, nil
+			}
+			r, err := c.bool(n.r, n.op)
+			return calcValue{v: r}, err
+		}
+
+		l, err := c.eval(n.l)
+		if err != nil {
+			return calcValue{}, err
+		}
+		r, err := c.eval(n.r)
+		if err != nil {
+			return calcValue{}, err
+		}
+		return calcBinaryOp(n.op, l, r)
+
+	case *calcCall:
+		args := make([]calcValue, len(n.args))
+		for i, arg := range n.args {
+			v, err := c.eval(arg)
+			if err != nil {
+				return calcValue{}, err
+			}
+			args[i] = v
+		}
+		fn, ok := calcFunctions[n.name]
+		if !ok {
+			return calcValue{}, ansi.Errorf("@R{unknown calc function} @r{%s}", n.name)
+		}
+		v, err := fn(args)
+		return calcValue{v: v}, err
+	}
+	return calcValue{}, fmt.Errorf("unhandled calc expression node %T", n)
+}
+
+func (c *calcEval) bool(n calcNode, op string) (bool, error) {
+	v, err := c.eval(n)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.v.(bool)
+	if !ok {
+		return false, calcTypeError(v, op)
+	}
+	return b, nil
+}
+
+func isCalcNumber(v calcValue) bool {
+	switch v.v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func calcFloat(v calcValue) float64 {
+	if i, ok := v.v.(int64); ok {
+		return float64(i)
+	}
+	return v.v.(float64)
+}
+
+func calcUnaryOp(op string, x calcValue) (calcValue, error) {
+	switch op {
+	case "!":
+		if b, ok := x.v.(bool); ok {
+			return calcValue{v: !b}, nil
+		}
+	case "~":
+		if i, ok := x.v.(int64); ok {
+			return calcValue{v: ^i}, nil
+		}
+	case "+":
+		if isCalcNumber(x) {
+			return calcValue{v: x.v}, nil
+		}
+	case "-":
+		switch v := x.v.(type) {
+		case int64:
+			if v != math.MinInt64 {
+				return calcValue{v: -v}, nil
+			}
+			return calcValue{v: -float64(v)}, nil
+		case float64:
+			return calcValue{v: -v}, nil
+		}
+	}
+	return calcValue{}, calcTypeError(x, op)
+}
+
+func calcBinaryOp(op string, l, r calcValue) (calcValue, error) {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return calcCompare(op, l, r)
+
+	case "=~", "!~":
+		s, ok := l.v.(string)
+		if !ok {
+			return calcValue{}, calcTypeError(l, op)
+		}
+		pattern, ok := r.v.(string)
+		if !ok {
+			return calcValue{}, calcTypeError(r, op)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return calcValue{}, ansi.Errorf("@R{invalid regular expression} @r{%q}@R{:} %s", pattern, err)
+		}
+		return calcValue{v: re.MatchString(s) == (op == "=~")}, nil
+
+	case "&", "|", "^", "<<", ">>":
+		a, ok := l.v.(int64)
+		if !ok {
+			return calcValue{}, calcTypeError(l, op)
+		}
+		b, ok := r.v.(int64)
+		if !ok {
+			return calcValue{}, calcTypeError(r, op)
+		}
+		switch op {
+		case "&":
+			return calcValue{v: a & b}, nil
+		case "|":
+			return calcValue{v: a | b}, nil
+		case "^":
+			return calcValue{v: a ^ b}, nil
+		}
+		if b < 0 {
+			return calcValue{}, ansi.Errorf("@R{cannot shift by a negative amount} @r{%d}", b)
+		}
+		if op == "<<" {
+			if a != 0 && (b >= 64 || (a<<uint(b))>>uint(b) != a) {
+				return calcValue{}, calcOverflowError(op, a, b)
+			}
+			return calcValue{v: a << uint(b)}, nil
+		}
+		return calcValue{v: a >> uint(b)}, nil
+	}
+
+	if op == "+" {
+		ls, lok := l.v.(string)
+		rs, rok := r.v.(string)
+		if lok && rok {
+			return calcValue{v: ls + rs}, nil
+		}
+	}
+
+	if !isCalcNumber(l) {
+		return calcValue{}, calcTypeError(l, op)
+	}
+	if !isCalcNumber(r) {
+		return calcValue{}, calcTypeError(r, op)
+	}
+	return calcArithmetic(op, l, r)
+}
+
+// calcArithmetic does integer math when both operands are integers (and
+// the result fits), and floating point math otherwise
+func calcArithmetic(op string, l, r calcValue) (calcValue, error) {
+	a, aInt := l.v.(int64)
+	b, bInt := r.v.(int64)
+
+	if aInt && bInt {
+		switch op {
+		case "+", "-", "*", "**":
+			x, y := big.NewInt(a), big.NewInt(b)
+			switch op {
+			case "+":
+				x.Add(x, y)
+			case "-":
+				x.Sub(x, y)
+			case "*":
+				x.Mul(x, y)
+			case "**":
+				switch {
+				case b < 0:
+					x = nil // a fraction, unless a is 1 or -1
+				case b > 64 && (a > 1 || a < -1):
+					return calcValue{}, calcOverflowError(op, a, b)
+				default:
+					x.Exp(x, y, nil)
+				}
+			}
+			if x != nil {
+				if !x.IsInt64() {
+					return calcValue{}, calcOverflowError(op, a, b)
+				}
+				return calcValue{v: x.Int64()}, nil
+			}
+
+		case "/", "//", "%":
+			if b == 0 {
+				return calcValue{}, ansi.Errorf("@R{division by zero}")
+			}
+			if b == -1 && a == math.MinInt64 {
+				break
+			}
+			switch op {
+			case "/":
+				if a%b == 0 {
+					return calcValue{v: a / b}, nil
+				}
+			case "//":
+				return calcValue{v: a / b}, nil
+			case "%":
+				return calcValue{v: a % b}, nil
+			}
+		}
+	}
+
+	x, y := calcFloat(l), calcFloat(r)
+	switch op {
+	case "+":
+		return calcValue{v: x + y}, nil
+	case "-":
+		return calcValue{v: x - y}, nil
+	case "*":
+		return calcValue{v: x * y}, nil
+	case "**":
+		return calcValue{v: math.Pow(x, y)}, nil
+	}
+
+	if y == 0 {
+		return calcValue{}, ansi.Errorf("@R{division by zero}")
+	}
+	switch op {
+	case "/":
+		return calcValue{v: x / y}, nil
+	case "//":
+		return calcValue{v: math.Trunc(x / y)}, nil
+	case "%":
+		return calcValue{v: math.Mod(x, y)}, nil
+	}
+	return calcValue{}, fmt.Errorf("unhandled calc operator %s", op)
+}
+
+func calcOverflowError(op string, a, b int64) error {
+	return ansi.Errorf("@R{integer overflow:} @r{%d %s %d} @R{does not fit in 64 bits}", a, op, b)
+}
+
+func calcCompare(op string, l, r calcValue) (calcValue, error) {
+	var cmp int
+	switch {
+	case isCalcNumber(l) && isCalcNumber(r):
+		a, aInt := l.v.(int64)
+		b, bInt := r.v.(int64)
+		if aInt && bInt {
+			cmp = big.NewInt(a).Cmp(big.NewInt(b))
+		} else {
+			cmp = big.NewFloat(calcFloat(l)).Cmp(big.NewFloat(calcFloat(r)))
+		}
+
+	case reflect.TypeOf(l.v) == reflect.TypeOf(r.v):
+		switch a := l.v.(type) {
+		case string:
+			cmp = strings.Compare(a, r.v.(string))
+		case bool:
+			if op != "==" && op != "!=" {
+				return calcValue{}, calcTypeError(l, op)
+			}
+			if a != r.v.(bool) {
+				cmp = 1
+			}
+		default:
+			return calcValue{}, calcTypeError(l, op)
+		}
+
+	default:
+		if op == "==" || op == "!=" {
+			for _, v := range []calcValue{l, r} {
+				switch v.v.(type) {
+				case map[interface{}]interface{}, []interface{}:
+					return calcValue{}, calcTypeError(v, op)
+				}
+			}
+			return calcValue{v: op == "!="}, nil
+		}
+		return calcValue{}, ansi.Errorf("@R{cannot compare} @r{%#v} @R{and} @r{%#v} @R{with} @r{%s}", l.v, r.v, op)
+	}
+
+	switch op {
+	case "==":
+		return calcValue{v: cmp == 0}, nil
+	case "!=":
+		return calcValue{v: cmp != 0}, nil
+	case "<":
+		return calcValue{v: cmp < 0}, nil
+	case "<=":
+		return calcValue{v: cmp <= 0}, nil
+	case ">":
+		return calcValue{v: cmp > 0}, nil
+	}
+	return calcValue{v: cmp >= 0}, nil
+}
+
+// calcNumericFunction wraps a function of float64s that (( calc )) has
+// always had, keeping integer results as integers when given integers
+func calcNumericFunction(name string, arity int, ints func(...int64) (int64, bool), floats func(...float64) float64) func([]calcValue) (interface{}, error) {
+	count := map[int]string{1: "one argument", 2: "two arguments"}[arity]
+	return func(args []calcValue) (interface{}, error) {
+		if len(args) != arity {
+			return nil, ansi.Errorf("@R{%s function expects} @r{%s} @R{of type} @r{float64}", name, count)
+		}
+		allInts := true
+		for _, arg := range args {
+			if !isCalcNumber(arg) {
+				return nil, ansi.Errorf("@R{%s function expects} @r{%s} @R{of type} @r{float64}", name, count)
+			}
+			_, ok := arg.v.(int64)
+			allInts = allInts && ok
+		}
+
+		if allInts && ints != nil {
+			is := make([]int64, len(args))
+			for i, arg := range args {
+				is[i] = arg.v.(int64)
+			}
+			if v, ok := ints(is...); ok {
+				return v, nil
+			}
+		}
+
+		fs := make([]float64, len(args))
+		for i, arg := range args {
+			fs[i] = calcFloat(arg)
+		}
+		return floats(fs...), nil
+	}
+}
+
+func calcStringArg(name string, args []calcValue, i int) (string, error) {
+	s, ok := args[i].v.(string)
+	if !ok {
+		return "", ansi.Errorf("@R{%s function expects argument %d to be a string, not} @r{%#v}", name, i+1, args[i].v)
+	}
+	return s, nil
+}
+
+var calcFunctions = map[string]func([]calcValue) (interface{}, error){
+	"min": calcNumericFunction("min", 2,
+		func(i ...int64) (int64, bool) { return min(i[0], i[1]), true },
+		func(f ...float64) float64 { return math.Min(f[0], f[1]) }),
+
+	"max": calcNumericFunction("max", 2,
+		func(i ...int64) (int64, bool) { return max(i[0], i[1]), true },
+		func(f ...float64) float64 { return math.Max(f[0], f[1]) }),
+
+	"mod": calcNumericFunction("mod", 2,
+		func(i ...int64) (int64, bool) { return i[0] % i[1], i[1] != 0 && i[1] != -1 },
+		func(f ...float64) float64 { return math.Mod(f[0], f[1]) }),
+
+	"pow": calcNumericFunction("pow", 2,
+		func(i ...int64) (int64, bool) {
+			if i[1] < 0 || i[1] > 64 {
+				return 0, false
+			}
+			x := new(big.Int).Exp(big.NewInt(i[0]), big.NewInt(i[1]), nil)
+			return x.Int64(), x.IsInt64()
+		},
+		func(f ...float64) float64 { return math.Pow(f[0], f[1]) }),
+
+	"sqrt": calcNumericFunction("sqrt", 1, nil,
+		func(f ...float64) float64 { return math.Sqrt(f[0]) }),
+
+	"floor": calcNumericFunction("floor", 1,
+		func(i ...int64) (int64, bool) { return i[0], true },
+		func(f ...float64) float64 { return math.Floor(f[0]) }),
+
+	"ceil": calcNumericFunction("ceil", 1,
+		func(i ...int64) (int64, bool) { return i[0], true },
+		func(f ...float64) float64 { return math.Ceil(f[0]) }),
+
+	"len": func(args []calcValue) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, ansi.Errorf("@R{len function expects} @r{one argument}")
+		}
+		switch v := args[0].v.(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[interface{}]interface{}:
+			return int64(len(v)), nil
+		}
+		return nil, ansi.Errorf("@R{len function expects a string, list or map, not} @r{%#v}", args[0].v)
+	},
+
+	"cidr_size": func(args []calcValue) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, ansi.Errorf("@R{cidr_size function expects} @r{one argument}@R{, a network in CIDR notation}")
+		}
+		s, err := calcStringArg("cidr_size", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		ipnet, err := parseCIDR(s)
+		if err != nil {
+			return nil, ansi.Errorf("@R{cidr_size function}: %s", err)
+		}
+		size := cidrSize(ipnet)
+		if !size.IsInt64() {
+			return nil, ansi.Errorf("@R{network} @r{%s} @R{has too many addresses to count}", s)
+		}
+		return size.Int64(), nil
+	},
+
+	"cidr_host": func(args []calcValue) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, ansi.Errorf("@R{cidr_host function expects} @r{two arguments}@R{, a network in CIDR notation and a host number}")
+		}
+		s, err := calcStringArg("cidr_host", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		num, ok := args[1].v.(int64)
+		if !ok {
+			return nil, ansi.Errorf("@R{cidr_host function expects argument 2 to be an integer, not} @r{%#v}", args[1].v)
+		}
+		ipnet, err := parseCIDR(s)
+		if err != nil {
+			return nil, ansi.Errorf("@R{cidr_host function}: %s", err)
+		}
+		ip, err := cidrHost(ipnet, big.NewInt(num))
+		if err != nil {
+			return nil, ansi.Errorf("@R{cidr_host function}: %s", err)
+		}
+		return ip.String(), nil
+	},
+}
@@ -0,0 +1,132 @@
+package spruce
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// parseCIDR parses an IPv4 or IPv6 network in CIDR notation, keeping IPv4
+// addresses in their 4-byte form, so that the address and mask agree
+func parseCIDR(s string) (*net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 := ipnet.IP.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+		ipnet.IP = ip4
+	}
+	return ipnet, nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return new(big.Int).SetBytes(ip)
+}
+
+// intToIP converts i back into an address of the given length in bytes
+func intToIP(i *big.Int, length int) net.IP {
+	b := i.Bytes()
+	ip := make(net.IP, length)
+	copy(ip[length-len(b):], b)
+	return ip
+}
+
+// ipAdd returns the address offset from ip, wrapping around at the end
+// (or beginning) of the address space
+func ipAdd(ip net.IP, offset *big.Int) net.IP {
+	length := net.IPv6len
+	if ip.To4() != nil {
+		length = net.IPv4len
+	}
+	space := new(big.Int).Lsh(big.NewInt(1), uint(8*length))
+	n := new(big.Int).Add(ipToInt(ip), offset)
+	return intToIP(n.Mod(n, space), length)
+}
+
+// cidrSize returns the number of addresses in the network
+func cidrSize(n *net.IPNet) *big.Int {
+	ones, bits := n.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+}
+
+// cidrHost returns the num'th address in the network, counting backwards
+// from the last address if num is negative, the way Terraform's cidrhost()
+// does
+func cidrHost(n *net.IPNet, num *big.Int) (net.IP, error) {
+	ones, _ := n.Mask.Size()
+	size := cidrSize(n)
+
+	host := new(big.Int).Set(num)
+	if host.Sign() < 0 {
+		host.Add(host, size)
+	}
+	if host.Sign() < 0 || host.Cmp(size) >= 0 {
+		return nil, fmt.Errorf("prefix of %d does not accommodate a host numbered %s", ones, num)
+	}
+	return intToIP(host.Add(host, ipToInt(n.IP)), len(n.IP)), nil
+}
+
+// cidrSubnet extends the prefix of n by newbits, and returns the netnum'th
+// of the resulting subnets, the way Terraform's cidrsubnet() does
+func cidrSubnet(n *net.IPNet, newbits int, netnum *big.Int) (*net.IPNet, error) {
+	ones, bits := n.Mask.Size()
+	if newbits < 0 {
+		return nil, fmt.Errorf("cannot extend a prefix by a negative number of bits")
+	}
+	if ones+newbits > bits {
+		return nil, fmt.Errorf("insufficient address space to extend prefix of %d by %d", ones, newbits)
+	}
+	if netnum.Sign() < 0 {
+		return nil, fmt.Errorf("cannot have a negative subnet number %s", netnum)
+	}
+	if netnum.BitLen() > newbits {
+		return nil, fmt.Errorf("prefix extension of %d does not accommodate a subnet numbered %s", newbits, netnum)
+	}
+
+	offset := new(big.Int).Lsh(netnum, uint(bits-ones-newbits))
+	return &net.IPNet{
+		IP:   intToIP(offset.Add(offset, ipToInt(n.IP)), len(n.IP)),
+		Mask: net.CIDRMask(ones+newbits, bits),
+	}, nil
+}
+
+// cidrSubnets allocates consecutive subnets of n, each extending its prefix
+// by the given number of bits, and each aligned to its own size, the way
+// Terraform's cidrsubnets() does
+func cidrSubnets(n *net.IPNet, newbits ...int) ([]*net.IPNet, error) {
+	ones, bits := n.Mask.Size()
+	end := new(big.Int).Add(ipToInt(n.IP), cidrSize(n))
+
+	subnets := []*net.IPNet{}
+	next := ipToInt(n.IP)
+	for i, extra := range newbits {
+		if extra < 1 {
+			return nil, fmt.Errorf("must extend prefix by at least one bit")
+		}
+		if ones+extra > bits {
+			return nil, fmt.Errorf("would extend prefix to %d bits, which is too long for a %d-bit address", ones+extra, bits)
+		}
+
+		// round up to the next boundary of this subnet's size
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones-extra))
+		start := new(big.Int).Add(next, size)
+		start.Sub(start, big.NewInt(1))
+		start.Sub(start, new(big.Int).Mod(start, size))
+		next = new(big.Int).Add(start, size)
+
+		if next.Cmp(end) > 0 {
+			if i == 0 {
+				return nil, fmt.Errorf("insufficient address space to extend prefix of %d by %d", ones, extra)
+			}
+			return nil, fmt.Errorf("not enough remaining address space for a subnet with a prefix of %d bits after %s", ones+extra, subnets[i-1])
+		}
+		subnets = append(subnets, &net.IPNet{
+			IP:   intToIP(start, len(n.IP)),
+			Mask: net.CIDRMask(ones+extra, bits),
+		})
+	}
+	return subnets, nil
+}
@@ -0,0 +1,111 @@
+package spruce
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/starkandwayne/goutils/ansi"
+)
+
+// Now pins the time returned by (( now )), for reproducible output.  When
+// it is the zero time, $SOURCE_DATE_EPOCH is consulted instead, and if that
+// is also unset, the actual current time is used.
+var Now time.Time
+
+// timeLayouts maps the names accepted by the date operators to Go layouts
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"DateOnly":    time.DateOnly,
+	"DateTime":    time.DateTime,
+	"Kitchen":     time.Kitchen,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RubyDate":    time.RubyDate,
+	"TimeOnly":    time.TimeOnly,
+	"UnixDate":    time.UnixDate,
+}
+
+var daysRx = regexp.MustCompile(`^([-+]?)(\d+)d(.*)$`)
+
+func currentTime() (time.Time, error) {
+	if !Now.IsZero() {
+		return Now.UTC(), nil
+	}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, ansi.Errorf("@R{invalid} @c{$SOURCE_DATE_EPOCH} @R{'%s': expected a number of seconds since the Unix epoch}", epoch)
+		}
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Now().UTC(), nil
+}
+
+// ParseTime parses the timestamps that spruce understands: RFC 3339 dates
+// and times (with or without the time), and integer Unix timestamps.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, ansi.Errorf("@R{unable to parse} @c{%s} @R{as a time (expected RFC3339, YYYY-MM-DD or seconds since the Unix epoch)}", s)
+}
+
+// parseDuration extends time.ParseDuration with a leading number of days,
+// as in "30d" or "1d12h", since certificate lifetimes and the like are
+// rarely given in hours.  As with time.ParseDuration, a leading sign covers
+// every unit ("-1d12h" is 36 hours ago), and the units can't be given signs
+// of their own ("1d-12h" is an error).
+func parseDuration(s string) (time.Duration, error) {
+	m := daysRx.FindStringSubmatch(s)
+	if m == nil {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if m[3] != "" {
+		if strings.HasPrefix(m[3], "-") || strings.HasPrefix(m[3], "+") {
+			return 0, fmt.Errorf("time: invalid duration %q", s)
+		}
+		rest, err := time.ParseDuration(m[3])
+		if err != nil {
+			return 0, err
+		}
+		d += rest
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// formatTime formats t according to a named layout (like RFC3339), a Go
+// reference-time layout, or "unix" for an integer Unix timestamp
+func formatTime(t time.Time, layout string) interface{} {
+	if layout == "unix" {
+		return t.Unix()
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
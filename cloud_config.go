@@ -0,0 +1,59 @@
+package spruce
+
+import (
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+)
+
+// CloudConfig is a read-only reference document, usually the BOSH
+// cloud-config, that never becomes part of the output.  (( static_ips ))
+// looks up networks that the manifest does not declare in it, and any
+// operator can reach into it with references rooted at $cloud_config.
+var CloudConfig map[interface{}]interface{}
+
+const cloudConfigRoot = "cloud_config"
+
+// cloudConfigPath returns the part of an environment-variable-style name
+// (like "cloud_config.networks.default") that is a path into the cloud-config
+func cloudConfigPath(name string) (string, bool) {
+	if name == cloudConfigRoot {
+		return "", CloudConfig != nil
+	}
+	if rest, ok := strings.CutPrefix(name, cloudConfigRoot+"."); ok {
+		return rest, true
+	}
+	return "", false
+}
+
+// resolveCloudConfig looks up a path in the cloud-config, handing back a
+// copy of what it finds, so that nothing done to the value downstream can
+// change the cloud-config itself
+func resolveCloudConfig(path string) (*Expr, error) {
+	c, err := tree.ParseCursor(path)
+	if err != nil {
+		return nil, err
+	}
+	return resolveCloudConfigNodes(c.Nodes)
+}
+
+// resolveCloudConfigNodes is resolveCloudConfig, for an already-parsed path
+func resolveCloudConfigNodes(nodes []string) (*Expr, error) {
+	c := &tree.Cursor{Nodes: nodes}
+	if CloudConfig == nil {
+		return nil, ansi.Errorf("@R{unable to resolve `}@c{$%s.%s}@R{`: no cloud-config was given (see --cloud-config)}", cloudConfigRoot, c)
+	}
+
+	var v interface{}
+	var err error
+	if isGlob(c) {
+		v, err = resolveGlob(c, CloudConfig)
+	} else {
+		v, err = c.Resolve(CloudConfig)
+	}
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to resolve `}@c{$%s.%s}@R{`: %s}", cloudConfigRoot, c, err)
+	}
+	return &Expr{Type: Literal, Literal: deepCopy(v)}, nil
+}
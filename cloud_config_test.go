@@ -0,0 +1,79 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cloud Config", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	BeforeEach(func() {
+		CloudConfig = evalYAML(`
+networks:
+- name: default
+  subnets:
+  - az: z1
+    gateway: 10.0.1.1
+    static: [ 10.0.1.10 - 10.0.1.20 ]
+  - az: z2
+    gateway: 10.0.2.1
+    static: [ 10.0.2.10 - 10.0.2.20 ]
+`)
+	})
+	AfterEach(func() {
+		CloudConfig = nil
+	})
+
+	It("can be referenced under $cloud_config", func() {
+		t, err := run(`
+network: default
+gateway: (( grab $cloud_config.networks.default.subnets.0.gateway ))
+gateways: (( grab $cloud_config.networks[network].subnets.*.gateway ))
+azs: (( join "," $cloud_config.networks.default.subnets.*.az ))
+fallback: (( grab $cloud_config.networks.nope || "none" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["gateway"]).To(Equal("10.0.1.1"))
+		Expect(t["gateways"]).To(Equal([]interface{}{"10.0.1.1", "10.0.2.1"}))
+		Expect(t["azs"]).To(Equal("z1,z2"))
+		Expect(t["fallback"]).To(Equal("none"))
+	})
+
+	It("is never changed by what the document does with it", func() {
+		t, err := run(`
+subnets: (( grab $cloud_config.networks.default.subnets ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		t["subnets"].([]interface{})[0].(map[interface{}]interface{})["gateway"] = "changed"
+		Expect(CloudConfig["networks"].([]interface{})[0].(map[interface{}]interface{})["subnets"].([]interface{})[0].(map[interface{}]interface{})["gateway"]).To(Equal("10.0.1.1"))
+	})
+
+	It("provides the networks for (( static_ips )) that the manifest does not declare", func() {
+		t, err := run(`
+instance_groups:
+- name: web
+  instances: 2
+  azs: [ z2 ]
+  networks:
+  - name: default
+    static_ips: (( static_ips 0 1 ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		ig := t["instance_groups"].([]interface{})[0].(map[interface{}]interface{})
+		net := ig["networks"].([]interface{})[0].(map[interface{}]interface{})
+		Expect(net["static_ips"]).To(Equal([]interface{}{"10.0.2.10", "10.0.2.11"}))
+		Expect(t).NotTo(HaveKey("networks"))
+	})
+
+	It("complains when there is no cloud-config to reference", func() {
+		CloudConfig = nil
+		_, err := run(`gateway: (( grab $cloud_config.networks.default ))`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no cloud-config was given (see --cloud-config)"))
+	})
+})
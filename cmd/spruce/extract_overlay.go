@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/voxelbrain/goptions"
+
+	. "github.com/geofffranks/spruce"
+	. "github.com/geofffranks/spruce/log"
+)
+
+type extractOverlayOpts struct {
+	Format        string             `goptions:"--format, description='What to generate: overlay (a spruce overlay, the default) or go-patch'"`
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing the base files'"`
+	Help          bool               `goptions:"--help, -h"`
+	Files         goptions.Remainder `goptions:"description='The base files to merge, followed by the desired document'"`
+}
+
+// cmdExtractOverlay works out the overlay (or go-patch file) that turns the
+// merged base files into the desired document, and checks that merging it
+// on top of the base files really does produce the desired document
+func cmdExtractOverlay(options extractOverlayOpts) (string, error) {
+	if options.Format == "" {
+		options.Format = "overlay"
+	}
+	if options.Format != "overlay" && options.Format != "go-patch" {
+		return "", ansi.Errorf("@R{unknown format} @c{'%s'} @R{(expected one of overlay or go-patch)}", options.Format)
+	}
+	if len(options.Files) < 2 {
+		return "", ansi.Errorf("@R{extract-overlay needs at least one base file, followed by the desired document}")
+	}
+	baseFiles := options.Files[:len(options.Files)-1]
+	desiredFile := options.Files[len(options.Files)-1]
+
+	base, err := cmdMergeEval(mergeOpts{Files: baseFiles, EnableGoPatch: options.EnableGoPatch})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := loadYamlFile(desiredFile)
+	if err != nil {
+		return "", err
+	}
+	data, err := readFile(&f)
+	if err != nil {
+		return "", err
+	}
+	desired, err := parseYAML(data)
+	if err != nil {
+		return "", ansi.Errorf("@m{%s}: @R{%s}", f.Path, err)
+	}
+
+	var extracted interface{}
+	if options.Format == "go-patch" {
+		extracted = ExtractGoPatch(base, desired)
+	} else {
+		extracted = ExtractOverlay(base, desired)
+	}
+	out, err := yaml.Marshal(extracted)
+	if err != nil {
+		return "", err
+	}
+	DEBUG("extracted %s:\n%s", options.Format, out)
+
+	if err := verifyOverlay(baseFiles, out, desired, options); err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// verifyOverlay merges the extracted overlay on top of the base files, and
+// returns an error if that doesn't produce the desired document
+func verifyOverlay(baseFiles []string, overlay []byte, desired map[interface{}]interface{}, options extractOverlayOpts) error {
+	files := []YamlFile{}
+	for _, file := range baseFiles {
+		f, err := loadYamlFile(file)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	files = append(files, YamlFile{Path: "extracted " + options.Format, Reader: io.NopCloser(bytes.NewReader(overlay))})
+
+	ev, err := mergeAllDocs(files, mergeOpts{EnableGoPatch: options.EnableGoPatch || options.Format == "go-patch"})
+	if err != nil {
+		return ansi.Errorf("@R{the extracted %s could not be merged back onto the base files}: %s", options.Format, err)
+	}
+
+	// compare the YAML round-trips, so that both sides have the same types
+	var merged, want interface{}
+	for _, x := range []struct {
+		from interface{}
+		to   *interface{}
+	}{{ev.Tree, &merged}, {desired, &want}} {
+		b, err := yaml.Marshal(x.from)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(b, x.to); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(merged, want) {
+		d, _ := Diff(merged, want)
+		return ansi.Errorf("@R{merging the extracted %s onto the base files does not reproduce the desired document:}\n%s", options.Format, d.String("$"))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+	"github.com/voxelbrain/goptions"
+	yamlv3 "go.yaml.in/yaml/v3"
+
+	. "github.com/geofffranks/spruce"
+	. "github.com/geofffranks/spruce/log"
+)
+
+type lintOpts struct {
+	Bosh          bool               `goptions:"--bosh, description='Cross-check the networks, AZs, VM and disk types, stemcells and releases that BOSH instance groups refer to'"`
+	CloudConfig   string             `goptions:"--cloud-config, description='BOSH cloud-config to check references against'"`
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc      bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	MergeRules    string             `goptions:"--merge-rules, description='YAML file declaring how to merge the data at given paths, in lieu of inline array operators'"`
+	Help          bool               `goptions:"--help, -h"`
+	Files         goptions.Remainder `goptions:"description='List of files to merge and lint'"`
+}
+
+// cmdLintEval merges and evaluates the files, and returns the problems
+// found in the result, each prefixed with the file and line that last
+// set the offending value (where that can be determined)
+func cmdLintEval(options lintOpts) ([]string, error) {
+	if options.CloudConfig != "" {
+		cc, err := loadCloudConfig(options.CloudConfig)
+		if err != nil {
+			return nil, err
+		}
+		CloudConfig = cc
+	}
+
+	merged, err := cmdMergeEval(mergeOpts{
+		Files:         options.Files,
+		EnableGoPatch: options.EnableGoPatch,
+		MultiDoc:      options.MultiDoc,
+		MergeRules:    options.MergeRules,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !options.Bosh {
+		return nil, nil
+	}
+
+	locations := lintLocations(options.Files)
+	out := []string{}
+	for _, problem := range LintBOSH(merged) {
+		if where, ok := locations.find(problem.Path); ok {
+			out = append(out, ansi.Sprintf("@m{%s}: @c{%s}: @R{%s}", where, problem.Path, problem.Message))
+		} else {
+			out = append(out, ansi.Sprintf("@c{%s}: @R{%s}", problem.Path, problem.Message))
+		}
+	}
+	return out, nil
+}
+
+// sourceLocations maps the paths set by the files being merged to the file
+// and line that set them last
+type sourceLocations map[string]string
+
+func lintLocations(files []string) sourceLocations {
+	locations := sourceLocations{}
+	for _, file := range files {
+		if file == "-" {
+			continue
+		}
+		data, err := os.ReadFile(file) // #nosec G304 -- user-specified file path is core CLI functionality
+		if err != nil {
+			continue
+		}
+
+		dec := yamlv3.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc yamlv3.Node
+			if err := dec.Decode(&doc); err != nil {
+				if err != io.EOF {
+					DEBUG("unable to locate paths in %s: %s", file, err)
+				}
+				break
+			}
+			if len(doc.Content) > 0 {
+				locations.index(file, "", doc.Content[0])
+			}
+		}
+	}
+	return locations
+}
+
+func (l sourceLocations) index(file, path string, node *yamlv3.Node) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			here := join(k.Value)
+			l[here] = fmt.Sprintf("%s:%d", file, k.Line)
+			l.index(file, here, v)
+		}
+
+	case yamlv3.SequenceNode:
+		for i, v := range node.Content {
+			here := join(sequenceName(v, i))
+			l[here] = fmt.Sprintf("%s:%d", file, v.Line)
+			l.index(file, here, v)
+		}
+	}
+}
+
+// sequenceName names a list entry the way spruce paths do: by its name
+// (or key, or id) field, or failing that, its index
+func sequenceName(node *yamlv3.Node, i int) string {
+	if node.Kind == yamlv3.MappingNode {
+		for _, field := range tree.NameFields {
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				k, v := node.Content[j], node.Content[j+1]
+				if k.Value == field && v.Kind == yamlv3.ScalarNode && !strings.HasPrefix(v.Value, "((") {
+					return v.Value
+				}
+			}
+		}
+	}
+	return strconv.Itoa(i)
+}
+
+// find returns the location of the path, or of its closest ancestor
+func (l sourceLocations) find(path string) (string, bool) {
+	for path != "" {
+		if where, ok := l[path]; ok {
+			return where, true
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return "", false
+}
@@ -46,25 +46,50 @@ type jsonOpts struct {
 }
 
 type mergeOpts struct {
-	SkipEval       bool               `goptions:"--skip-eval, description='Do not evaluate spruce logic after merging docs'"`
-	Prune          []string           `goptions:"--prune, description='Specify keys to prune from final output (may be specified more than once)'"`
-	CherryPick     []string           `goptions:"--cherry-pick, description='The opposite of prune, specify keys to cherry-pick from final output (may be specified more than once)'"`
-	FallbackAppend bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
-	EnableGoPatch  bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
-	MultiDoc       bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
-	Help           bool               `goptions:"--help, -h"`
-	Files          goptions.Remainder `goptions:"description='List of files to merge. To read STDIN, specify a filename of \\'-\\'.'"`
+	SkipEval        bool               `goptions:"--skip-eval, description='Do not evaluate spruce logic after merging docs'"`
+	Prune           []string           `goptions:"--prune, description='Specify keys to prune from final output (may be specified more than once)'"`
+	CherryPick      []string           `goptions:"--cherry-pick, description='The opposite of prune, specify keys to cherry-pick from final output (may be specified more than once)'"`
+	FallbackAppend  bool               `goptions:"--fallback-append, description='Default merge normally tries to key merge, then inline. This flag says do an append instead of an inline.'"`
+	EnableGoPatch   bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc        bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	PostPatch       []string           `goptions:"--post-patch, description='Apply this go-patch ops-file after evaluating the merged documents, before pruning, sorting and cherry-picking (may be specified more than once)'"`
+	MergePatch      []string           `goptions:"--merge-patch, description='Apply this file (one of the files being merged) as an RFC 7386 JSON Merge Patch (may be specified more than once)'"`
+	MergeMode       string             `goptions:"--merge-mode, description='How to merge documents: spruce (the default), or strategic for Kubernetes strategic merge patch semantics'"`
+	MergeRules      string             `goptions:"--merge-rules, description='YAML file declaring how to merge the data at given paths, in lieu of inline array operators'"`
+	NoNewKeys       []string           `goptions:"--no-new-keys, description='Only allow files after the first to override existing keys under these (comma-separated) path globs (may be specified more than once)'"`
+	StrictTypes     bool               `goptions:"--strict-types, description='Refuse to replace maps, lists and scalars with one another when merging'"`
+	ReportOverrides bool               `goptions:"--report-overrides, description='List every value that a later file overrode on stderr, along with the files involved'"`
+	KeyOrder        []string           `goptions:"--key-order, description='Print these keys first, in this order, in the maps at a path glob, given as PATH:KEY,KEY,... or KEY,KEY,... for the top level (may be specified more than once)'"`
+	Help            bool               `goptions:"--help, -h"`
+	Files           goptions.Remainder `goptions:"description='List of files to merge. To read STDIN, specify a filename of \\'-\\'.'"`
+}
+
+type queryOpts struct {
+	SkipEval      bool               `goptions:"--skip-eval, description='Do not evaluate spruce logic after merging docs'"`
+	EnableGoPatch bool               `goptions:"--go-patch, description='Enable the use of go-patch when parsing files to be merged'"`
+	MultiDoc      bool               `goptions:"--multi-doc, -m, description='Treat multi-doc yaml as multiple files.'"`
+	Help          bool               `goptions:"--help, -h"`
+	Args          goptions.Remainder `goptions:"description='A JSONPath query, followed by the files to merge and query'"`
 }
 
 func main() {
 	var options struct {
-		Debug   bool `goptions:"-D, --debug, description='Enable debugging'"`
-		Trace   bool `goptions:"-T, --trace, description='Enable trace mode debugging (very verbose)'"`
-		Version bool `goptions:"-v, --version, description='Display version information'"`
+		Debug   bool   `goptions:"-D, --debug, description='Enable debugging'"`
+		Trace   bool   `goptions:"-T, --trace, description='Enable trace mode debugging (very verbose)'"`
+		Version bool   `goptions:"-v, --version, description='Display version information'"`
+		Plugins string `goptions:"--plugins, description='YAML file declaring external operator plugins (also SPRUCE_PLUGIN_CONFIG)'"`
+		Seed    string `goptions:"--seed, description='Seed the randomizing operators, so that their output is repeatable (also SPRUCE_SEED)'"`
+		Now     string `goptions:"--now, description='Pin the time used by the date operators, as RFC3339 or seconds since the epoch (also SOURCE_DATE_EPOCH)'"`
+		X509    string `goptions:"--x509-state, description='YAML file in which to remember generated certificates across runs'"`
+		IPState string `goptions:"--ip-state, description='YAML file in which to remember the static IPs given to each instance across runs'"`
+		Cloud   string `goptions:"--cloud-config, description='BOSH cloud-config to consult for networks, and to reference as $cloud_config, without merging it'"`
 		Action  goptions.Verbs
-		Merge   mergeOpts `goptions:"merge"`
-		Fan     mergeOpts `goptions:"fan"`
-		JSON    jsonOpts  `goptions:"json"`
+		Merge   mergeOpts          `goptions:"merge"`
+		Fan     mergeOpts          `goptions:"fan"`
+		JSON    jsonOpts           `goptions:"json"`
+		Query   queryOpts          `goptions:"query"`
+		Lint    lintOpts           `goptions:"lint"`
+		Extract extractOverlayOpts `goptions:"extract-overlay"`
 		Diff    struct {
 			Files goptions.Remainder `goptions:"description='Show the semantic differences between two YAML files'"`
 		} `goptions:"diff"`
@@ -87,7 +112,7 @@ func main() {
 		DebugOn = true
 	}
 
-	if options.JSON.Help || options.Merge.Help || options.Fan.Help {
+	if options.JSON.Help || options.Merge.Help || options.Fan.Help || options.Query.Help || options.Lint.Help || options.Extract.Help {
 		goptions.PrintHelp()
 		os.Exit(1)
 		return
@@ -101,6 +126,43 @@ func main() {
 
 	ansi.Color(isatty.IsTerminal(os.Stderr.Fd()))
 
+	if options.Seed != "" {
+		Seed = options.Seed
+	}
+
+	if options.Now != "" {
+		now, err := ParseTime(options.Now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+		Now = now
+	}
+
+	X509StateFile = options.X509
+	IPStateFile = options.IPState
+
+	if options.Cloud != "" {
+		cc, err := loadCloudConfig(options.Cloud)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+		CloudConfig = cc
+	}
+
+	switch options.Action {
+	case "merge", "fan", "json", "query", "lint", "extract-overlay":
+		// only the verbs that evaluate operators need the plugins
+		if err := loadPlugins(options.Plugins); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+	}
+
 	switch options.Action {
 	case "merge":
 		tree, err := cmdMergeEval(options.Merge)
@@ -110,9 +172,16 @@ func main() {
 			return
 		}
 
+		ordered, err := orderKeys(tree, options.Merge.KeyOrder)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+
 		TRACE("Converting the following data back to YML:")
 		TRACE("%#v", tree)
-		merged, err := yaml.Marshal(tree)
+		merged, err := yaml.Marshal(ordered)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Unable to convert merged result back to YAML: %s\nData:\n%#v", err.Error(), tree)
 			os.Exit(2)
@@ -130,9 +199,16 @@ func main() {
 		}
 
 		for _, tree := range trees {
+			ordered, err := orderKeys(tree, options.Fan.KeyOrder)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+				os.Exit(2)
+				return
+			}
+
 			TRACE("Converting the following data back to YML:")
 			TRACE("%#v", tree)
-			merged, err := yaml.Marshal(tree)
+			merged, err := yaml.Marshal(ordered)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Unable to convert merged result back to YAML: %s\nData:\n%#v", err.Error(), tree)
 				os.Exit(2)
@@ -142,6 +218,47 @@ func main() {
 			fmt.Fprintf(os.Stdout, "---\n%s\n", string(merged))
 		}
 
+	case "query":
+		result, err := cmdQueryEval(options.Query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+
+		output, err := yaml.Marshal(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to convert query results to YAML: %s\nData:\n%#v", err.Error(), result)
+			os.Exit(2)
+			return
+		}
+
+		fmt.Fprintf(os.Stdout, "%s\n", string(output))
+
+	case "lint":
+		problems, err := cmdLintEval(options.Lint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stdout, "%s\n", problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+			return
+		}
+
+	case "extract-overlay":
+		output, err := cmdExtractOverlay(options.Extract)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(2)
+			return
+		}
+		fmt.Fprintf(os.Stdout, "%s", output)
+
 	case "vaultinfo":
 		VaultRefs = map[string][]string{}
 		SkipVault = true
@@ -192,6 +309,24 @@ func main() {
 	os.Exit(0)
 }
 
+// loadPlugins registers operator plugins from the given configuration file
+// (or $SPRUCE_PLUGIN_CONFIG), and then any found on $SPRUCE_PLUGIN_PATH.
+// Explicitly configured plugins take precedence over discovered ones.
+func loadPlugins(config string) error {
+	if config == "" {
+		config = os.Getenv("SPRUCE_PLUGIN_CONFIG")
+	}
+	if config != "" {
+		if err := LoadPluginConfig(config); err != nil {
+			return err
+		}
+	}
+	if path := os.Getenv("SPRUCE_PLUGIN_PATH"); path != "" {
+		return DiscoverPlugins(path)
+	}
+	return nil
+}
+
 func isArrayError(err error) bool {
 	_, ok := err.(RootIsArrayError)
 	return ok
@@ -210,6 +345,38 @@ func parseGoPatch(data []byte) (patch.Ops, error) {
 	return ops, nil
 }
 
+// isMergePatchFile returns true if the file (or, with --multi-doc, one of
+// its documents) was given to --merge-patch, and notes that it was seen
+func isMergePatchFile(path string, mergePatches map[string]bool) bool {
+	for p := range mergePatches {
+		if path == p || (strings.HasPrefix(path, p+"[") && strings.HasSuffix(path, "]")) {
+			mergePatches[p] = true
+			return true
+		}
+	}
+	return false
+}
+
+func isJSONPatch(data []byte) bool {
+	var l []interface{}
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return false
+	}
+	return IsJSONPatch(l)
+}
+
+func applyJSONPatch(data []byte, root map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	var l []interface{}
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, ansi.Errorf("@R{Unable to parse JSON Patch}: %s", err)
+	}
+	ops, err := ParseJSONPatch(l)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Apply(root)
+}
+
 func parseYAML(data []byte) (map[interface{}]interface{}, error) {
 	y, err := simpleyaml.NewYaml(data)
 	if err != nil {
@@ -233,6 +400,19 @@ func parseYAML(data []byte) (map[interface{}]interface{}, error) {
 	return doc, nil
 }
 
+// loadCloudConfig reads the reference document given by --cloud-config
+func loadCloudConfig(file string) (map[interface{}]interface{}, error) {
+	data, err := os.ReadFile(file) // #nosec G304 -- user-specified file path is core CLI functionality
+	if err != nil {
+		return nil, ansi.Errorf("@R{Error reading cloud-config} @m{%s}: %s", file, err.Error())
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, ansi.Errorf("@m{%s}: %s", file, err.Error())
+	}
+	return doc, nil
+}
+
 func loadYamlFile(file string) (YamlFile, error) {
 	var target YamlFile
 	if file == "-" {
@@ -275,6 +455,19 @@ func splitLoadYamlFile(file string) ([]YamlFile, error) {
 	return docs, nil
 }
 
+// orderKeys applies the --key-order options to the merged tree, for printing
+func orderKeys(tree map[interface{}]interface{}, keyOrders []string) (interface{}, error) {
+	orders := []KeyOrder{}
+	for _, s := range keyOrders {
+		order, err := ParseKeyOrder(s)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return OrderKeys(tree, orders), nil
+}
+
 func cmdMergeEval(options mergeOpts) (map[interface{}]interface{}, error) {
 	files := []YamlFile{}
 
@@ -380,6 +573,44 @@ func cmdFanEval(options mergeOpts) ([]map[interface{}]interface{}, error) {
 	return roots, nil
 }
 
+// cmdQueryEval merges the given files, and then runs a JSONPath query
+// against the result.  Definite queries (those that can only ever match
+// a single node) return the matched value; all others return a list.
+func cmdQueryEval(options queryOpts) (interface{}, error) {
+	if len(options.Args) < 1 {
+		return nil, ansi.Errorf("@R{Missing Input:} You must specify a query to run against the merged documents.")
+	}
+
+	q, err := ParseQuery(options.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := cmdMergeEval(mergeOpts{
+		SkipEval:      options.SkipEval,
+		EnableGoPatch: options.EnableGoPatch,
+		MultiDoc:      options.MultiDoc,
+		Files:         options.Args[1:],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := q.Run(tree)
+	if q.Definite() {
+		if len(results) == 0 {
+			return nil, ansi.Errorf("@R{query} @c{%s} @R{did not match anything}", q)
+		}
+		return results[0].Value, nil
+	}
+
+	vals := []interface{}{}
+	for _, r := range results {
+		vals = append(vals, r.Value)
+	}
+	return vals, nil
+}
+
 func cmdJSONEval(options jsonOpts) ([]string, error) {
 	stdinInfo, err := os.Stdin.Stat()
 	if err != nil {
@@ -461,11 +692,48 @@ func readFile(file *YamlFile) ([]byte, error) {
 }
 
 func mergeAllDocs(files []YamlFile, options mergeOpts) (*Evaluator, error) {
-	m := &Merger{AppendByDefault: options.FallbackAppend}
+	m := &Merger{
+		AppendByDefault: options.FallbackAppend,
+		StrictTypes:     options.StrictTypes,
+		ReportOverrides: options.ReportOverrides,
+	}
+	mode, err := ParseMergeMode(options.MergeMode)
+	if err != nil {
+		return nil, ansi.Errorf("@R{%s}", err)
+	}
+	m.Mode = mode
+	for _, globs := range options.NoNewKeys {
+		for _, glob := range strings.Split(globs, ",") {
+			if glob = strings.TrimSpace(glob); glob != "" {
+				m.NoNewKeys = append(m.NoNewKeys, glob)
+			}
+		}
+	}
+	if options.MergeRules != "" {
+		rules, err := LoadMergeRules(options.MergeRules)
+		if err != nil {
+			return nil, err
+		}
+		m.Rules = rules
+	}
+	postPatches := []PostPatch{}
+	for _, file := range options.PostPatch {
+		p, err := LoadPostPatch(file)
+		if err != nil {
+			return nil, err
+		}
+		postPatches = append(postPatches, p)
+	}
 	root := make(map[interface{}]interface{})
 
+	mergePatches := map[string]bool{}
+	for _, path := range options.MergePatch {
+		mergePatches[path] = false
+	}
+
 	for _, file := range files {
 		DEBUG("Processing file '%s'", file.Path)
+		isMergePatch := isMergePatchFile(file.Path, mergePatches)
 
 		data, err := readFile(&file)
 		if err != nil {
@@ -474,7 +742,14 @@ func mergeAllDocs(files []YamlFile, options mergeOpts) (*Evaluator, error) {
 
 		doc, err := parseYAML(data)
 		if err != nil {
-			if isArrayError(err) && options.EnableGoPatch {
+			if isArrayError(err) && isJSONPatch(data) {
+				DEBUG("Detected root of document as an array of JSON Patch operations")
+				newRoot, err := applyJSONPatch(data, root)
+				if err != nil {
+					return nil, ansi.Errorf("@m{%s}: %s\n", file.Path, err.Error())
+				}
+				root = newRoot
+			} else if isArrayError(err) && options.EnableGoPatch {
 				DEBUG("Detected root of document as an array. Attempting go-patch parsing")
 				ops, err := parseGoPatch(data)
 				if err != nil {
@@ -492,19 +767,33 @@ func mergeAllDocs(files []YamlFile, options mergeOpts) (*Evaluator, error) {
 			} else {
 				return nil, ansi.Errorf("@m{%s}: @R{%s}\n", file.Path, err.Error())
 			}
+		} else if isMergePatch {
+			DEBUG("Applying '%s' as a JSON Merge Patch", file.Path)
+			root = MergePatch(root, doc).(map[interface{}]interface{})
 		} else {
+			m.Source = file.Path
 			m.Merge(root, doc) // #nosec G104 -- errors collected via m.Error() after loop
 		}
 		tmpYaml, _ := yaml.Marshal(root) // we don't care about errors for debugging
 		TRACE("Current data after processing '%s':\n%s", file.Path, tmpYaml)
 	}
 
+	for path, seen := range mergePatches {
+		if !seen {
+			return nil, ansi.Errorf("@R{--merge-patch} @m{%s}@R{: not one of the files being merged}", path)
+		}
+	}
+
+	for _, o := range m.SortedOverrides() {
+		fmt.Fprintf(os.Stderr, "%s\n", ansi.Sprintf("@Y{override:} %s", o))
+	}
+
 	if m.Error() != nil {
 		return nil, m.Error()
 	}
 
-	ev := &Evaluator{Tree: root, SkipEval: options.SkipEval}
-	err := ev.Run(options.Prune, options.CherryPick)
+	ev := &Evaluator{Tree: root, SkipEval: options.SkipEval, PostPatches: postPatches}
+	err = ev.Run(options.Prune, options.CherryPick)
 	return ev, err
 }
 
@@ -448,6 +448,20 @@ quux: quux
 		Expect(string(session.Err.Contents())).To(ContainSubstring("Root of YAML document is not a hash/map:"))
 	})
 
+	It("only loads operator plugins for the commands that evaluate operators", func() {
+		dir := GinkgoT().TempDir()
+		// a plugin that conflicts with (( grab )) fails to load
+		Expect(os.WriteFile(filepath.Join(dir, "spruce-op-grab"), []byte("#!/bin/sh\n"), 0755)).To(Succeed()) // #nosec G306 -- test plugin must be executable
+		env := []string{"SPRUCE_PLUGIN_PATH=" + dir}
+
+		session := runSpruceWithEnv(env, "vaultinfo", "../../assets/vaultinfo/single.yml")
+		Eventually(session, "10s").Should(gexec.Exit(0))
+
+		session = runSpruceWithEnv(env, "merge", "../../assets/vaultinfo/single.yml")
+		Eventually(session, "10s").Should(gexec.Exit(2))
+		Expect(string(session.Err.Contents())).To(ContainSubstring("conflicts with the built-in"))
+	})
+
 	It("vaultinfo lists vault calls in given file", func() {
 		session := runSpruce("vaultinfo", "../../assets/vaultinfo/single.yml")
 		Eventually(session, "10s").Should(gexec.Exit(0))
@@ -2265,6 +2279,413 @@ var _ = Describe("Color Output - error conditions exit with code 2 and produce n
 		Expect(string(session.Err.Contents())).NotTo(BeEmpty())
 	})
 
+	Context("query", func() {
+		It("prints the value matched by a definite query", func() {
+			session := runSpruce("query", "$.jobs.web.instances", "../../assets/query/base.yml", "../../assets/query/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal("4\n\n"))
+		})
+
+		It("prints a list of everything matched by other queries", func() {
+			session := runSpruce("query", "$.jobs[?(@.lifecycle == 'errand')].name", "../../assets/query/base.yml", "../../assets/query/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal("- smoke-tests\n- db\n\n"))
+		})
+
+		It("fails if a definite query matches nothing", func() {
+			session := runSpruce("query", "jobs.web.nope", "../../assets/query/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("did not match anything"))
+		})
+
+		It("rejects malformed queries", func() {
+			session := runSpruce("query", "$.jobs[", "../../assets/query/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("invalid query"))
+		})
+	})
+
+	Context("--seed", func() {
+		It("makes randomized output repeatable", func() {
+			first := runSpruce("--seed", "build-42", "merge", "../../assets/seed/random.yml")
+			Eventually(first, "10s").Should(gexec.Exit(0))
+			second := runSpruceWithEnv([]string{"SPRUCE_SEED=build-42"}, "merge", "../../assets/seed/random.yml")
+			Eventually(second, "10s").Should(gexec.Exit(0))
+			Expect(string(second.Out.Contents())).To(Equal(string(first.Out.Contents())))
+
+			other := runSpruce("--seed", "build-43", "merge", "../../assets/seed/random.yml")
+			Eventually(other, "10s").Should(gexec.Exit(0))
+			Expect(string(other.Out.Contents())).NotTo(Equal(string(first.Out.Contents())))
+		})
+	})
+
+	Context("--now", func() {
+		It("pins the time used by the date operators", func() {
+			session := runSpruce("--now", "2024-06-01T12:00:00Z", "merge", "../../assets/dates/stamp.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal("built: 2024-06-01T12:00:00Z\nexpires: 2024-07-01\n\n"))
+		})
+
+		It("falls back to $SOURCE_DATE_EPOCH", func() {
+			session := runSpruceWithEnv([]string{"SOURCE_DATE_EPOCH=1717243200"}, "merge", "../../assets/dates/stamp.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(ContainSubstring("2024-06-01T12:00:00Z"))
+		})
+
+		It("rejects unparseable times", func() {
+			session := runSpruce("--now", "tomorrow", "merge", "../../assets/dates/stamp.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("unable to parse tomorrow as a time"))
+		})
+	})
+
+	Context("--x509-state", func() {
+		It("hands back the same certificates on later runs", func() {
+			state := filepath.Join(GinkgoT().TempDir(), "x509.yml")
+			first := runSpruce("--now", "2024-06-01T00:00:00Z", "--x509-state", state, "merge", "../../assets/x509/certs.yml")
+			Eventually(first, "10s").Should(gexec.Exit(0))
+			Expect(string(first.Out.Contents())).To(ContainSubstring("expires: 2025-06-01T00:00:00Z"))
+			Expect(state).To(BeAnExistingFile())
+
+			second := runSpruce("--x509-state", state, "merge", "../../assets/x509/certs.yml")
+			Eventually(second, "10s").Should(gexec.Exit(0))
+			Expect(string(second.Out.Contents())).To(Equal(string(first.Out.Contents())))
+		})
+	})
+
+	Context("--ip-state", func() {
+		It("keeps the static IPs of existing instances when scaling up and reordering AZs", func() {
+			state := filepath.Join(GinkgoT().TempDir(), "ips.yml")
+			first := runSpruce("--ip-state", state, "merge", "../../assets/static_ips/ip-state/base.yml")
+			Eventually(first, "10s").Should(gexec.Exit(0))
+			Expect(string(first.Out.Contents())).To(ContainSubstring("static_ips:\n    - 10.0.1.10\n    - 10.0.1.11\n"))
+
+			second := runSpruce("--ip-state", state, "merge", "../../assets/static_ips/ip-state/base.yml", "../../assets/static_ips/ip-state/scale.yml")
+			Eventually(second, "10s").Should(gexec.Exit(0))
+			Expect(string(second.Out.Contents())).To(ContainSubstring("static_ips:\n    - 10.0.1.10\n    - 10.0.1.11\n    - 10.0.2.12\n"))
+
+			without := runSpruce("merge", "../../assets/static_ips/ip-state/base.yml", "../../assets/static_ips/ip-state/scale.yml")
+			Eventually(without, "10s").Should(gexec.Exit(0))
+			Expect(string(without.Out.Contents())).To(ContainSubstring("static_ips:\n    - 10.0.2.10\n    - 10.0.2.11\n    - 10.0.2.12\n"))
+		})
+	})
+
+	Context("--cloud-config", func() {
+		It("consults the cloud-config without merging it in", func() {
+			session := runSpruce("--cloud-config", "../../assets/cloud-config/cloud.yml", "merge", "../../assets/cloud-config/manifest.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instance_groups:
+- azs:
+  - z1
+  - z2
+  instances: 2
+  name: web
+  networks:
+  - name: default
+    static_ips:
+    - 10.0.1.10
+    - 10.0.1.11
+  properties:
+    gateway: 10.0.1.1
+name: web
+
+`))
+		})
+
+		It("fails if the cloud-config cannot be read", func() {
+			session := runSpruce("--cloud-config", "../../assets/cloud-config/nope.yml", "merge", "../../assets/cloud-config/manifest.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("Error reading cloud-config"))
+		})
+	})
+
+	Context("lint", func() {
+		It("is quiet about manifests with nothing wrong", func() {
+			session := runSpruce("lint", "--bosh", "--cloud-config", "../../assets/lint/cloud.yml", "../../assets/lint/manifest.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(BeEmpty())
+		})
+
+		It("reports BOSH reference errors, along with the file and line responsible", func() {
+			session := runSpruce("lint", "--bosh", "--cloud-config", "../../assets/lint/cloud.yml", "../../assets/lint/manifest.yml", "../../assets/lint/broken.yml")
+			Eventually(session, "10s").Should(gexec.Exit(1))
+			Expect(string(session.Out.Contents())).To(Equal(`../../assets/lint/broken.yml:4: instance_groups.web.azs.1: AZ 'z3' is not defined in azs
+../../assets/lint/broken.yml:5: instance_groups.web.vm_type: vm_type 'huge' is not defined in vm_types
+../../assets/lint/manifest.yml:23: instance_groups.web.networks.default.static_ips: 2 static IPs given for 3 instances
+../../assets/lint/broken.yml:8: instance_groups.db.persistent_disk_type: disk_type '1TB' is not defined in disk_types
+../../assets/lint/broken.yml:11: instance_groups.db.jobs.postgres.release: release 'postgres' is not defined in releases
+../../assets/lint/broken.yml:13: instance_groups.db.networks.private.name: network 'private' is not defined in networks
+`))
+		})
+
+		It("only checks that the files merge without --bosh", func() {
+			session := runSpruce("lint", "../../assets/lint/manifest.yml", "../../assets/lint/broken.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+
+			session = runSpruce("lint", "../../assets/errors/colortest.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+		})
+	})
+
+	Context("--merge-rules", func() {
+		It("merges paths as the rules say", func() {
+			session := runSpruce("merge", "--merge-rules", "../../assets/merge-rules/rules.yml", "../../assets/merge-rules/base.yml", "../../assets/merge-rules/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instance_groups:
+- az: z1
+  instances: 1
+  jobs:
+  - name: nginx
+  name: web
+- az: z2
+  instances: 3
+  jobs:
+  - name: nginx
+  - name: metrics
+    properties:
+      interval: 10s
+  name: web
+meta:
+  pinned: v1
+properties:
+  tls:
+    cert: NEW CERT
+
+`))
+		})
+
+		It("refuses to override paths with an error rule", func() {
+			session := runSpruce("merge", "--merge-rules", "../../assets/merge-rules/rules.yml", "../../assets/merge-rules/base.yml", "../../assets/merge-rules/pinned.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("$.meta.pinned: cannot be overridden, according to the merge rule for meta.pinned"))
+		})
+
+		It("reports bad rules files", func() {
+			session := runSpruce("merge", "--merge-rules", "../../assets/merge-rules/bad-rules.yml", "../../assets/merge-rules/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("rule #0: unknown merge strategy 'sideways' for path 'instance_groups'"))
+		})
+	})
+
+	Context("strict merge modes", func() {
+		It("refuses new keys with --no-new-keys", func() {
+			session := runSpruce("merge", "--no-new-keys", "meta,properties.**", "../../assets/strict/base.yml", "../../assets/strict/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("$.properties.propertise: is not an existing key, and new keys are not allowed under properties.**"))
+
+			session = runSpruce("merge", "--no-new-keys", "meta.*", "../../assets/strict/base.yml", "../../assets/strict/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+		})
+
+		It("refuses type changes with --strict-types", func() {
+			session := runSpruce("merge", "--strict-types", "../../assets/strict/base.yml", "../../assets/strict/types.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("$.meta.zones: refusing to replace a list with a map"))
+		})
+
+		It("lists overridden values with --report-overrides", func() {
+			session := runSpruce("merge", "--report-overrides", "../../assets/strict/base.yml", "../../assets/strict/overlay.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Err.Contents())).To(Equal(`override: meta.size: set in ../../assets/strict/base.yml, overridden by ../../assets/strict/overlay.yml
+override: properties.port: set in ../../assets/strict/base.yml, overridden by ../../assets/strict/overlay.yml
+`))
+		})
+	})
+
+	Context("--merge-mode", func() {
+		It("merges Kubernetes manifests as strategic merge patches", func() {
+			session := runSpruce("merge", "--merge-mode", "strategic", "../../assets/strategic/deployment.yml", "../../assets/strategic/patch.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - env:
+        - name: LOG_LEVEL
+          value: debug
+        image: app:1.1
+        name: app
+
+`))
+		})
+
+		It("rejects unknown merge modes", func() {
+			session := runSpruce("merge", "--merge-mode", "json", "../../assets/strategic/deployment.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("unknown merge mode 'json' (expected one of spruce or strategic)"))
+		})
+	})
+
+	Context("JSON Patch and JSON Merge Patch files", func() {
+		It("applies RFC 6902 JSON Patches, without needing --go-patch", func() {
+			session := runSpruce("merge", "../../assets/json-patch/base.yml", "../../assets/json-patch/patch.json")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instances: 3
+name: web
+properties:
+  tls:
+    enabled: true
+tags:
+- a
+- b
+- c
+
+`))
+		})
+
+		It("applies RFC 7386 JSON Merge Patches given with --merge-patch", func() {
+			session := runSpruce("merge", "--merge-patch", "../../assets/json-patch/merge-patch.json", "../../assets/json-patch/base.yml", "../../assets/json-patch/merge-patch.json")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instances: 1
+name: web
+properties:
+  debug: true
+  log_level: info
+tags:
+- web
+
+`))
+		})
+
+		It("reports failing operations, and --merge-patch files that are not being merged", func() {
+			session := runSpruce("merge", "../../assets/json-patch/base.yml", "../../assets/json-patch/bad.json")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("../../assets/json-patch/bad.json: JSON Patch operation #0 (remove /nope) failed: key 'nope' not found"))
+
+			session = runSpruce("merge", "--merge-patch", "../../assets/json-patch/other.json", "../../assets/json-patch/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("--merge-patch ../../assets/json-patch/other.json: not one of the files being merged"))
+		})
+	})
+
+	Context("--post-patch", func() {
+		It("applies go-patch ops-files to the evaluated documents", func() {
+			session := runSpruce("merge", "--post-patch", "../../assets/post-patch/ops.yml", "../../assets/post-patch/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`jobs:
+- instances: 3
+  name: web-prod
+- instances: 1
+  name: worker
+meta:
+  name: web-prod
+
+`))
+		})
+
+		It("names the operation that failed", func() {
+			session := runSpruce("merge", "--post-patch", "../../assets/post-patch/ops.yml", "--post-patch", "../../assets/post-patch/bad.yml", "../../assets/post-patch/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("../../assets/post-patch/bad.yml: operation #1 (type: replace, path: /jobs/name=web-dev/instances) failed: "))
+		})
+	})
+
+	Context("(( sort )) collations and --key-order", func() {
+		It("sorts by multiple keys with per-key collation and direction", func() {
+			session := runSpruce("merge", "../../assets/sort/releases.yml", "../../assets/sort/collations.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instance_groups:
+- instances: 3
+  name: web1
+- instances: 2
+  name: web2
+- instances: 1
+  name: web10
+name: my-deployment
+releases:
+- name: bpm
+  version: 1.2.10
+- name: bpm
+  version: 1.2.9
+- name: nginx
+  version: 1.21.6
+- name: nginx
+  version: 1.21.6-rc.1
+stemcells:
+- alias: default
+  os: ubuntu-jammy
+  version: latest
+
+`))
+		})
+
+		It("prints the listed keys first", func() {
+			session := runSpruce("merge", "--key-order", "name,releases", "--key-order", "instance_groups.*:name", "../../assets/sort/releases.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(HavePrefix(`name: my-deployment
+releases:
+- name: nginx
+  version: 1.21.6
+`))
+			Expect(string(session.Out.Contents())).To(ContainSubstring(`instance_groups:
+- name: web10
+  instances: 1
+`))
+		})
+
+		It("rejects a key order without keys", func() {
+			session := runSpruce("merge", "--key-order", "meta:", "../../assets/sort/releases.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("key order 'meta:' does not list any keys"))
+		})
+	})
+
+	Context("extract-overlay", func() {
+		It("prints the overlay that turns the base files into the desired document", func() {
+			session := runSpruce("extract-overlay", "../../assets/extract-overlay/base.yml", "../../assets/extract-overlay/desired.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`instance_groups:
+- (( merge on name ))
+- azs:
+  - (( append ))
+  - z2
+  instances: 3
+  name: web
+- instances: 1
+  name: cache
+meta:
+  debug: (( prune ))
+tags:
+- (( append ))
+- c
+`))
+		})
+
+		It("prints go-patch operations with --format go-patch", func() {
+			session := runSpruce("extract-overlay", "--format", "go-patch", "../../assets/extract-overlay/base.yml", "../../assets/extract-overlay/reordered.yml")
+			Eventually(session, "10s").Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(`- path: /instance_groups/name=worker
+  type: remove
+- path: /instance_groups/name=web:after
+  type: replace
+  value:
+    instances: 1
+    name: metrics
+- path: /instance_groups/name=db/instances
+  type: replace
+  value: 2
+`))
+		})
+
+		It("fails when merging the overlay does not reproduce the desired document", func() {
+			session := runSpruce("extract-overlay", "../../assets/extract-overlay/base.yml", "../../assets/extract-overlay/unreproducible.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("merging the extracted overlay onto the base files does not reproduce the desired document:"))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("$.name changed value"))
+		})
+
+		It("needs a base file and a desired document", func() {
+			session := runSpruce("extract-overlay", "../../assets/extract-overlay/base.yml")
+			Eventually(session, "10s").Should(gexec.Exit(2))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("extract-overlay needs at least one base file, followed by the desired document"))
+		})
+	})
+
 	It("NotFoundError, TypeMisMatchErrors, all operator errors, all tree errors", func() {
 		session := runSpruce("merge", "../../assets/errors/colortest.yml")
 		Eventually(session, "10s").Should(gexec.Exit(2))
@@ -23,6 +23,10 @@ type Evaluator struct {
 	CheckOps []*Opcall
 
 	Only []string
+
+	// PostPatches are applied after evaluation, before pruning, sorting
+	// and cherry-picking
+	PostPatches []PostPatch
 }
 
 func nameOfObj(o interface{}, def string) string {
@@ -689,6 +693,12 @@ func (ev *Evaluator) Run(prune []string, picks []string) error {
 		errors.Append(ev.RunPhase(EvalPhase))
 	}
 
+	// post-processing: go-patch ops-files (unless evaluation already failed,
+	// since they are likely to trip over what it left behind)
+	if len(errors.Errors) == 0 {
+		errors.Append(ev.applyPostPatches())
+	}
+
 	// this is a big failure...
 	if err := ev.CheckForCycles(4096); err != nil {
 		return err
@@ -709,5 +719,5 @@ func (ev *Evaluator) Run(prune []string, picks []string) error {
 	if len(errors.Errors) > 0 {
 		return errors
 	}
-	return nil
+	return saveIPState()
 }
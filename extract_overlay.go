@@ -0,0 +1,375 @@
+package spruce
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ExtractOverlay returns a spruce overlay that, merged on top of base,
+// produces desired. It only contains what changed: new and changed keys,
+// `(( prune ))` for removed keys, and array operators for lists. Lists of
+// maps that diff would treat as keyed (see keyed()) are changed entry by
+// entry with `(( merge on KEY ))`, or with `(( delete ... ))` and
+// `(( insert after ... ))` when entries come and go in the middle of them.
+// Anything that can't be expressed more precisely is replaced wholesale.
+func ExtractOverlay(base, desired map[interface{}]interface{}) map[interface{}]interface{} {
+	overlay, _ := overlayFor(base, desired)
+	if m, ok := overlay.(map[interface{}]interface{}); ok {
+		return m
+	}
+	return map[interface{}]interface{}{}
+}
+
+// overlayFor returns the overlay that turns a into b, and whether there is
+// anything to overlay at all
+func overlayFor(a, b interface{}) (interface{}, bool) {
+	if reflect.DeepEqual(a, b) {
+		return nil, false
+	}
+
+	switch b := b.(type) {
+	case map[interface{}]interface{}:
+		a, ok := a.(map[interface{}]interface{})
+		if !ok {
+			return b, true
+		}
+		overlay := map[interface{}]interface{}{}
+		for k, v := range b {
+			if orig, exists := a[k]; exists {
+				if o, changed := overlayFor(orig, v); changed {
+					overlay[k] = o
+				}
+				continue
+			}
+			overlay[k] = v
+		}
+		for k := range a {
+			if _, exists := b[k]; !exists {
+				overlay[k] = "(( prune ))"
+			}
+		}
+		return overlay, true
+
+	case []interface{}:
+		a, ok := a.([]interface{})
+		if !ok {
+			return append([]interface{}{"(( replace ))"}, b...), true
+		}
+		if key := overlayListKey(a, b); key != "" {
+			if l, ok := overlayKeyedList(a, b, key); ok {
+				return l, true
+			}
+		}
+		return overlaySimpleList(a, b), true
+	}
+	return b, true
+}
+
+// overlayListKey returns the identifying key of two lists of maps, if they
+// share one (as diff sees it) that has unique string values in each
+func overlayListKey(a, b []interface{}) string {
+	key := keyed(a)
+	if key == "" || len(b) == 0 {
+		return ""
+	}
+	for _, l := range [][]interface{}{a, b} {
+		m := mapify(l, key)
+		if m == nil || len(m) != len(l) {
+			return ""
+		}
+		for id := range m {
+			s, ok := id.(string)
+			if !ok || strings.ContainsAny(s, `"\`) {
+				return ""
+			}
+		}
+	}
+	return key
+}
+
+func overlayKeyedList(a, b []interface{}, key string) ([]interface{}, bool) {
+	orig := mapify(a, key)
+	desired := mapify(b, key)
+
+	// existing entries have to stay in the same order
+	kept := []interface{}{}
+	for _, e := range a {
+		if id := e.(map[interface{}]interface{})[key]; desired[id] != nil {
+			kept = append(kept, id)
+		}
+	}
+	i := 0
+	structural := len(kept) != len(a)
+	for _, e := range b {
+		id := e.(map[interface{}]interface{})[key]
+		if orig[id] == nil {
+			if i < len(kept) {
+				structural = true // inserted before the end
+			}
+			continue
+		}
+		if i >= len(kept) || kept[i] != id {
+			return nil, false
+		}
+		i++
+	}
+
+	if !structural {
+		// merge the changed entries, and append the new ones
+		l := []interface{}{fmt.Sprintf("(( merge on %s ))", key)}
+		for _, e := range b {
+			id := e.(map[interface{}]interface{})[key]
+			if o, exists := orig[id]; exists {
+				overlay, changed := overlayFor(o, e)
+				if !changed {
+					continue
+				}
+				entry := overlay.(map[interface{}]interface{})
+				entry[key] = id
+				l = append(l, entry)
+				continue
+			}
+			l = append(l, e)
+		}
+		return l, true
+	}
+
+	// (( merge )) can't be combined with (( delete )) or (( insert )), so
+	// changed entries are deleted and inserted again, whole
+	l := []interface{}{}
+	deleted := map[interface{}]bool{}
+	for _, e := range a {
+		id := e.(map[interface{}]interface{})[key]
+		if d, exists := desired[id]; !exists || !reflect.DeepEqual(e, d) {
+			l = append(l, fmt.Sprintf(`(( delete %s "%s" ))`, key, id))
+			deleted[id] = true
+		}
+	}
+
+	var prev interface{}
+	inserting := false
+	for _, e := range b {
+		id := e.(map[interface{}]interface{})[key]
+		if _, exists := orig[id]; exists && !deleted[id] {
+			prev, inserting = id, false
+			continue
+		}
+		if !inserting {
+			if prev == nil {
+				l = append(l, "(( prepend ))")
+			} else {
+				l = append(l, fmt.Sprintf(`(( insert after %s "%s" ))`, key, prev))
+			}
+			inserting = true
+		}
+		l = append(l, e)
+		prev = id
+	}
+	return l, true
+}
+
+func overlaySimpleList(a, b []interface{}) []interface{} {
+	if len(b) > len(a) && reflect.DeepEqual(a, b[:len(a)]) {
+		return append([]interface{}{"(( append ))"}, b[len(a):]...)
+	}
+	if len(b) > len(a) && reflect.DeepEqual(a, b[len(b)-len(a):]) {
+		return append([]interface{}{"(( prepend ))"}, b[:len(b)-len(a)]...)
+	}
+
+	if len(b) < len(a) {
+		if l, ok := overlaySimpleDeletions(a, b); ok {
+			return l
+		}
+	}
+
+	if len(a) == len(b) {
+		// merge entry by entry, as long as every entry can be
+		l := []interface{}{"(( inline ))"}
+		for i := range b {
+			o, changed := overlayFor(a[i], b[i])
+			switch {
+			case !changed && typeof(b[i]) == Map:
+				o = map[interface{}]interface{}{}
+			case !changed:
+				o = b[i]
+			case typeof(b[i]) != Map || typeof(a[i]) != Map:
+				// scalars and lists aren't merged, but replaced
+				if typeof(b[i]) != Scalar || typeof(a[i]) != Scalar {
+					return append([]interface{}{"(( replace ))"}, b...)
+				}
+			}
+			l = append(l, o)
+		}
+		return l
+	}
+	return append([]interface{}{"(( replace ))"}, b...)
+}
+
+// overlaySimpleDeletions returns the `(( delete "..." ))` operators that
+// remove the entries of a that are not in b, if b is what is left of a once
+// they are gone. Those operators delete the first entry of a given value,
+// and only strings can be deleted that way.
+func overlaySimpleDeletions(a, b []interface{}) ([]interface{}, bool) {
+	l := []interface{}{}
+	left := append([]interface{}{}, a...)
+	j := 0
+	for _, entry := range a {
+		if j < len(b) && reflect.DeepEqual(entry, b[j]) {
+			j++
+			continue
+		}
+		s, ok := entry.(string)
+		if !ok || s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, `"\`) {
+			return nil, false
+		}
+		l = append(l, fmt.Sprintf(`(( delete "%s" ))`, s))
+		left = deleteFirst(left, s)
+	}
+	if j < len(b) || !reflect.DeepEqual(left, b) {
+		return nil, false
+	}
+	return l, true
+}
+
+func deleteFirst(l []interface{}, s string) []interface{} {
+	for i, entry := range l {
+		if entry == s {
+			return append(append([]interface{}{}, l[:i]...), l[i+1:]...)
+		}
+	}
+	return l
+}
+
+// ExtractGoPatch returns the go-patch operations that turn base into
+// desired, addressing the entries of keyed lists (see keyed()) by their
+// identifying key.
+func ExtractGoPatch(base, desired map[interface{}]interface{}) []interface{} {
+	return goPatchFor(base, desired, "")
+}
+
+func goPatchOp(typ, path string, value interface{}) interface{} {
+	op := map[interface{}]interface{}{"type": typ, "path": path}
+	if typ == "replace" {
+		op["value"] = value
+	}
+	return op
+}
+
+func goPatchToken(k interface{}) string {
+	s := fmt.Sprintf("%v", k)
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func goPatchFor(a, b interface{}, path string) []interface{} {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+
+	switch b := b.(type) {
+	case map[interface{}]interface{}:
+		a, ok := a.(map[interface{}]interface{})
+		if !ok {
+			break
+		}
+		ops := []interface{}{}
+		for _, k := range sortedKeys(a) {
+			if _, exists := b[k]; !exists {
+				ops = append(ops, goPatchOp("remove", path+"/"+goPatchToken(k), nil))
+			}
+		}
+		for _, k := range sortedKeys(b) {
+			if orig, exists := a[k]; exists {
+				ops = append(ops, goPatchFor(orig, b[k], path+"/"+goPatchToken(k))...)
+				continue
+			}
+			ops = append(ops, goPatchOp("replace", path+"/"+goPatchToken(k)+"?", b[k]))
+		}
+		return ops
+
+	case []interface{}:
+		a, ok := a.([]interface{})
+		if !ok {
+			break
+		}
+		if key := overlayListKey(a, b); key != "" {
+			if ops, ok := goPatchKeyedList(a, b, key, path); ok {
+				return ops
+			}
+		}
+		if len(b) > len(a) && reflect.DeepEqual(a, b[:len(a)]) {
+			ops := []interface{}{}
+			for _, e := range b[len(a):] {
+				ops = append(ops, goPatchOp("replace", path+"/-", e))
+			}
+			return ops
+		}
+		if len(a) == len(b) {
+			ops := []interface{}{}
+			for i := range b {
+				ops = append(ops, goPatchFor(a[i], b[i], fmt.Sprintf("%s/%d", path, i))...)
+			}
+			return ops
+		}
+	}
+	return []interface{}{goPatchOp("replace", path, b)}
+}
+
+func goPatchKeyedList(a, b []interface{}, key, path string) ([]interface{}, bool) {
+	orig := mapify(a, key)
+	desired := mapify(b, key)
+	entry := func(id interface{}) string {
+		return fmt.Sprintf("%s/%s=%s", path, goPatchToken(key), goPatchToken(id))
+	}
+
+	// existing entries have to stay in the same order
+	kept := []interface{}{}
+	for _, e := range a {
+		if id := e.(map[interface{}]interface{})[key]; desired[id] != nil {
+			kept = append(kept, id)
+		}
+	}
+	i := 0
+	for _, e := range b {
+		if id := e.(map[interface{}]interface{})[key]; orig[id] != nil {
+			if kept[i] != id {
+				return nil, false
+			}
+			i++
+		}
+	}
+
+	ops := []interface{}{}
+	for _, e := range a {
+		if id := e.(map[interface{}]interface{})[key]; desired[id] == nil {
+			ops = append(ops, goPatchOp("remove", entry(id), nil))
+		}
+	}
+	var prev interface{}
+	for _, e := range b {
+		id := e.(map[interface{}]interface{})[key]
+		if o, exists := orig[id]; exists {
+			ops = append(ops, goPatchFor(o, e, entry(id))...)
+		} else if prev == nil && len(a) == 0 {
+			ops = append(ops, goPatchOp("replace", path+"/-", e))
+		} else if prev == nil {
+			ops = append(ops, goPatchOp("replace", path+"/0:before", e))
+		} else {
+			ops = append(ops, goPatchOp("replace", entry(prev)+":after", e))
+		}
+		prev = id
+	}
+	return ops, true
+}
+
+func sortedKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+	})
+	return keys
+}
@@ -0,0 +1,158 @@
+package spruce
+
+import (
+	"github.com/geofffranks/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extracting overlays", func() {
+	doc := func(s string) map[interface{}]interface{} {
+		var m map[interface{}]interface{}
+		Expect(yaml.Unmarshal([]byte(s), &m)).To(Succeed())
+		return m
+	}
+
+	base := `
+meta:
+  debug: true
+instance_groups:
+- name: web
+  instances: 1
+  azs: [z1]
+- name: worker
+  instances: 1
+- name: db
+  instances: 1
+tags: [a, b]
+`
+
+	// overlay merges the overlay onto base the way spruce merge would
+	overlay := func(base, desired string) map[interface{}]interface{} {
+		o := ExtractOverlay(doc(base), doc(desired))
+
+		root := doc(base)
+		m := &Merger{}
+		m.Merge(root, deepCopy(o).(map[interface{}]interface{})) // #nosec G104 -- checked via m.Error()
+		Expect(m.Error()).NotTo(HaveOccurred())
+		ev := &Evaluator{Tree: root}
+		Expect(ev.Run(nil, nil)).To(Succeed())
+		Expect(ev.Tree).To(Equal(doc(desired)))
+		return o
+	}
+
+	// goPatch applies the extracted go-patch to base
+	goPatch := func(base, desired string) []interface{} {
+		ops := ExtractGoPatch(doc(base), doc(desired))
+		b, err := yaml.Marshal(ops)
+		Expect(err).NotTo(HaveOccurred())
+		p, err := ParsePostPatch("extracted", b)
+		Expect(err).NotTo(HaveOccurred())
+		result, err := p.Apply(doc(base))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(doc(desired)))
+		return ops
+	}
+
+	It("is empty when nothing changed", func() {
+		Expect(overlay(base, base)).To(BeEmpty())
+		Expect(goPatch(base, base)).To(BeEmpty())
+	})
+
+	It("merges keyed lists, appends to simple lists and prunes removed keys", func() {
+		desired := `
+meta: {}
+instance_groups:
+- name: web
+  instances: 3
+  azs: [z1, z2]
+- name: worker
+  instances: 1
+- name: db
+  instances: 1
+- name: cache
+tags: [a, b, c]
+`
+		Expect(overlay(base, desired)).To(Equal(doc(`
+meta:
+  debug: (( prune ))
+instance_groups:
+- (( merge on name ))
+- name: web
+  instances: 3
+  azs: [ (( append )), z2 ]
+- name: cache
+tags: [ (( append )), c ]
+`)))
+		Expect(goPatch(base, desired)).To(ContainElement(doc(`{type: replace, path: /instance_groups/name=web/instances, value: 3}`)))
+	})
+
+	It("deletes and inserts entries in the middle of keyed lists", func() {
+		desired := `
+meta:
+  debug: true
+instance_groups:
+- name: web
+  instances: 1
+  azs: [z1]
+- name: metrics
+- name: db
+  instances: 2
+tags: [a, b]
+`
+		Expect(overlay(base, desired)).To(Equal(doc(`
+instance_groups:
+- (( delete name "worker" ))
+- (( delete name "db" ))
+- (( insert after name "web" ))
+- name: metrics
+- name: db
+  instances: 2
+`)))
+		goPatch(base, desired)
+	})
+
+	It("deletes entries from simple lists", func() {
+		desired := `
+meta:
+  debug: true
+instance_groups:
+- name: web
+  instances: 1
+  azs: [z1]
+- name: worker
+  instances: 1
+- name: db
+  instances: 1
+tags: [b]
+`
+		Expect(overlay(base, desired)).To(Equal(doc(`
+tags:
+- (( delete "a" ))
+`)))
+		Expect(overlay(`{azs: [z1, z2, z1, z3]}`, `{azs: [z2, z1]}`)).To(Equal(doc(`
+azs:
+- (( delete "z1" ))
+- (( delete "z3" ))
+`)))
+		goPatch(base, desired)
+	})
+
+	It("replaces lists it can't express as changes", func() {
+		desired := `
+meta:
+  debug: true
+instance_groups:
+- name: db
+  instances: 1
+- name: web
+  instances: 1
+  azs: [z1]
+tags: [b, c, a]
+`
+		o := overlay(base, desired)
+		Expect(o["instance_groups"].([]interface{})[0]).To(Equal("(( replace ))"))
+		Expect(o["tags"]).To(Equal([]interface{}{"(( replace ))", "b", "c", "a"}))
+		goPatch(base, desired)
+	})
+})
@@ -0,0 +1,218 @@
+package spruce
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+)
+
+// isGlob returns true if the cursor contains any wildcard (`*`) or
+// recursive-descent (`**`) components.
+func isGlob(c *tree.Cursor) bool {
+	if c == nil {
+		return false
+	}
+	for _, node := range c.Nodes {
+		if node == "*" || node == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// globOperators are the operators that take the lists that wildcard
+// references resolve to. The others can't make sense of a list where they
+// expect a single value, so they refuse wildcard references instead.
+var globOperators = map[string]bool{
+	"cartesian-product": true,
+	"difference":        true,
+	"flatten":           true,
+	"grab":              true,
+	"index-of":          true,
+	"intersect":         true,
+	"join":              true,
+	"length":            true,
+	"shuffle":           true,
+	"stringify":         true,
+	"tojson":            true,
+	"union":             true,
+	"unique":            true,
+	"zip":               true,
+}
+
+// globArg returns the first wildcard reference in the expression, if any
+func globArg(e *Expr) *tree.Cursor {
+	if e == nil {
+		return nil
+	}
+	switch e.Type {
+	case Reference:
+		if isGlob(e.Reference) {
+			return e.Reference
+		}
+	case LogicalOr:
+		if c := globArg(e.Left); c != nil {
+			return c
+		}
+		return globArg(e.Right)
+	}
+	return nil
+}
+
+// checkGlobs returns an error if the operator was given a wildcard
+// reference, but doesn't take the lists they resolve to. Plugins get
+// whatever they are given.
+func (op *Opcall) checkGlobs() error {
+	if _, ok := op.op.(*PluginOperator); ok || globOperators[op.name] {
+		return nil
+	}
+	for _, arg := range op.args {
+		if c := globArg(arg); c != nil {
+			return ansi.Errorf("@R{wildcard reference} @c{%s} @R{cannot be used with} @c{(( %s ))}@R{, which does not take lists of matches}", c, op.name)
+		}
+	}
+	return nil
+}
+
+// orderedChildren returns the keys (as path components) and values of the
+// immediate children of o, in document order: lists by index, and maps by
+// sorted key (since YAML map ordering isn't preserved once parsed).
+func orderedChildren(o interface{}) ([]string, []interface{}) {
+	var keys []string
+	var vals []interface{}
+
+	switch o := o.(type) {
+	case []interface{}:
+		for i, v := range o {
+			keys = append(keys, strconv.Itoa(i))
+			vals = append(vals, v)
+		}
+
+	case map[interface{}]interface{}:
+		byName := map[string]interface{}{}
+		for k, v := range o {
+			name := fmt.Sprintf("%v", k)
+			keys = append(keys, name)
+			byName[name] = v
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vals = append(vals, byName[k])
+		}
+	}
+	return keys, vals
+}
+
+// globStep descends one (non-wildcard) level into o, returning the child,
+// and its canonical path component (list entries are always indexed).
+func globStep(o interface{}, k string) (interface{}, string, bool) {
+	switch o := o.(type) {
+	case []interface{}:
+		if i, err := strconv.ParseUint(k, 10, 0); err == nil {
+			if int(i) >= len(o) {
+				return nil, "", false
+			}
+			return o[i], k, true
+		}
+		for _, field := range tree.NameFields {
+			for i, v := range o {
+				if m, ok := v.(map[interface{}]interface{}); ok && m[field] == k {
+					return v, strconv.Itoa(i), true
+				}
+			}
+		}
+
+	case map[interface{}]interface{}:
+		if v, ok := o[k]; ok {
+			return v, k, true
+		}
+		for k1, v := range o {
+			if fmt.Sprintf("%v", k1) == k {
+				return v, k, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// globCursor expands a cursor containing `*` (any single key or index) and
+// `**` (zero or more levels of keys or indices) components against the
+// tree, returning the canonical path of every match, in document order.
+//
+// Components that can't be found before the first wildcard are an error,
+// since that's almost certainly a typo; afterwards, they just don't match.
+func globCursor(c *tree.Cursor, t interface{}) ([]*tree.Cursor, error) {
+	matches := []*tree.Cursor{}
+	seen := map[string]bool{}
+
+	var walk func(o interface{}, here []string, pos int, wild bool) error
+	walk = func(o interface{}, here []string, pos int, wild bool) error {
+		if pos == len(c.Nodes) {
+			match := &tree.Cursor{Nodes: append([]string{}, here...)}
+			if !seen[match.String()] {
+				seen[match.String()] = true
+				matches = append(matches, match)
+			}
+			return nil
+		}
+
+		switch k := c.Nodes[pos]; k {
+		case "**":
+			if err := walk(o, here, pos+1, true); err != nil {
+				return err
+			}
+			keys, vals := orderedChildren(o)
+			for i := range keys {
+				if err := walk(vals[i], append(here, keys[i]), pos, true); err != nil {
+					return err
+				}
+			}
+
+		case "*":
+			keys, vals := orderedChildren(o)
+			for i := range keys {
+				if err := walk(vals[i], append(here, keys[i]), pos+1, true); err != nil {
+					return err
+				}
+			}
+
+		default:
+			v, canon, ok := globStep(o, k)
+			if !ok {
+				if wild {
+					return nil
+				}
+				return tree.NotFoundError{Path: append(append([]string{}, here...), k)}
+			}
+			return walk(v, append(here, canon), pos+1, wild)
+		}
+		return nil
+	}
+
+	if err := walk(t, []string{}, 0, false); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// resolveGlob returns the values of every node matching the glob cursor,
+// in document order.
+func resolveGlob(c *tree.Cursor, t map[interface{}]interface{}) ([]interface{}, error) {
+	matches, err := globCursor(c, t)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := []interface{}{}
+	for _, match := range matches {
+		v, err := match.Resolve(t)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
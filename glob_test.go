@@ -0,0 +1,155 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/starkandwayne/goutils/tree"
+)
+
+var _ = Describe("Wildcard References", func() {
+	paths := func(l []*tree.Cursor) []string {
+		s := []string{}
+		for _, c := range l {
+			s = append(s, c.String())
+		}
+		return s
+	}
+
+	glob := func(t map[interface{}]interface{}, path string) []string {
+		c, err := tree.ParseCursor(path)
+		Expect(err).NotTo(HaveOccurred())
+		l, err := globCursor(c, t)
+		Expect(err).NotTo(HaveOccurred())
+		return paths(l)
+	}
+
+	doc := `
+jobs:
+  - name: web
+    networks:
+      - name: default
+      - name: public
+  - name: db
+    networks:
+      - name: default
+meta:
+  zeta: 1
+  alpha:
+    name: nested
+`
+
+	Describe("globCursor", func() {
+		It("expands single-level wildcards in document order", func() {
+			t := evalYAML(doc)
+			Expect(glob(t, "jobs.*.name")).To(Equal([]string{"jobs.0.name", "jobs.1.name"}))
+			Expect(glob(t, "jobs.*.networks.*.name")).To(Equal([]string{
+				"jobs.0.networks.0.name",
+				"jobs.0.networks.1.name",
+				"jobs.1.networks.0.name",
+			}))
+			Expect(glob(t, "meta.*")).To(Equal([]string{"meta.alpha", "meta.zeta"}))
+		})
+
+		It("canonicalizes named list entries", func() {
+			t := evalYAML(doc)
+			Expect(glob(t, "jobs.db.networks.*.name")).To(Equal([]string{"jobs.1.networks.0.name"}))
+		})
+
+		It("expands recursive-descent wildcards to any depth", func() {
+			t := evalYAML(doc)
+			Expect(glob(t, "**.name")).To(Equal([]string{
+				"jobs.0.name",
+				"jobs.0.networks.0.name",
+				"jobs.0.networks.1.name",
+				"jobs.1.name",
+				"jobs.1.networks.0.name",
+				"meta.alpha.name",
+			}))
+			Expect(glob(t, "meta.**")).To(Equal([]string{"meta", "meta.alpha", "meta.alpha.name", "meta.zeta"}))
+		})
+
+		It("skips non-matching branches after a wildcard", func() {
+			t := evalYAML(doc)
+			Expect(glob(t, "meta.*.name")).To(Equal([]string{"meta.alpha.name"}))
+			Expect(glob(t, "jobs.*.missing")).To(BeEmpty())
+		})
+
+		It("fails if the path before the first wildcard does not exist", func() {
+			c, _ := tree.ParseCursor("jobz.*.name")
+			_, err := globCursor(c, evalYAML(doc))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("in operator arguments", func() {
+		It("lets (( grab )) return every match", func() {
+			ev := &Evaluator{Tree: evalYAML(doc + "names: (( grab jobs.*.name ))\n")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+			Expect(ev.Tree["names"]).To(Equal([]interface{}{"web", "db"}))
+		})
+
+		It("lets (( join )) join every match", func() {
+			ev := &Evaluator{Tree: evalYAML(doc + "nets: (( join \",\" jobs.*.networks.*.name ))\n")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+			Expect(ev.Tree["nets"]).To(Equal("default,public,default"))
+		})
+
+		It("refuses a wildcard separator for (( join ))", func() {
+			ev := &Evaluator{Tree: evalYAML(doc + "nets: (( join meta.* jobs.*.name ))\n")}
+			err := ev.RunPhase(EvalPhase)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("join operator only accepts a string for the separator"))
+		})
+
+		It("refuses wildcard references in operators that do not take lists", func() {
+			ev := &Evaluator{Tree: evalYAML(doc + "name: (( concat jobs.*.name \"-z\" ))\n")}
+			err := ev.RunPhase(EvalPhase)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.name: wildcard reference jobs.*.name cannot be used with (( concat )), which does not take lists of matches"))
+
+			ev = &Evaluator{Tree: evalYAML(doc + "name: (( concat \"x\" meta.* || \"y\" ))\n")}
+			err = ev.RunPhase(EvalPhase)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("wildcard reference meta.* cannot be used with (( concat ))"))
+		})
+
+		It("falls back on || when nothing before the wildcard exists", func() {
+			ev := &Evaluator{Tree: evalYAML("names: (( grab jobs.*.name || \"none\" ))\n")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+			Expect(ev.Tree["names"]).To(Equal("none"))
+		})
+
+		It("orders operators inside the matched nodes first", func() {
+			ev := &Evaluator{Tree: evalYAML(`
+a_names: (( grab jobs.*.name ))
+jobs:
+  - name: (( concat "web" "-" meta.env ))
+  - name: db
+meta:
+  env: prod
+`)}
+			ops, err := ev.DataFlow(EvalPhase)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[1].src).To(Equal("(( grab jobs.*.name ))"))
+
+			Expect(ev.RunOps(ops)).To(Succeed())
+			Expect(ev.Tree["a_names"]).To(Equal([]interface{}{"web-prod", "db"}))
+		})
+
+		It("orders operators underneath recursive-descent matches first", func() {
+			ev := &Evaluator{Tree: evalYAML(`
+a_all: (( grab meta.** ))
+meta:
+  deep:
+    value: (( grab other ))
+other: x
+`)}
+			ops, err := ev.DataFlow(EvalPhase)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[1].src).To(Equal("(( grab meta.** ))"))
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package spruce
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+)
+
+// IPStateFile is the path of a YAML file in which (( static_ips )) records
+// the address that each instance was given, so that later runs hand out the
+// same addresses even as instance counts change, or AZs are reordered.
+var IPStateFile string
+
+// ipReservation is the address given to one instance on one network
+type ipReservation struct {
+	IP string `yaml:"ip"`
+	AZ string `yaml:"az,omitempty"`
+}
+
+// ipState maps network names to instances (as job/index) to the addresses
+// reserved for them
+var ipState map[string]map[string]ipReservation
+
+func loadIPState() error {
+	if ipState != nil {
+		return nil
+	}
+	ipState = map[string]map[string]ipReservation{}
+	if IPStateFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(IPStateFile) // #nosec G304 -- user-specified state file is core CLI functionality
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return ansi.Errorf("@R{unable to read IP state file} @m{%s}: %s", IPStateFile, err)
+	}
+	if err := yaml.Unmarshal(b, &ipState); err != nil {
+		return ansi.Errorf("@R{unable to parse IP state file} @m{%s}: %s", IPStateFile, err)
+	}
+	if ipState == nil {
+		ipState = map[string]map[string]ipReservation{}
+	}
+	return nil
+}
+
+// saveIPState writes the reservations made by (( static_ips )) back to the
+// state file.  It is only called once a whole evaluation has succeeded, so
+// that a failed render never leaves its allocations behind.
+func saveIPState() error {
+	if IPStateFile == "" || ipState == nil {
+		return nil
+	}
+	b, err := yaml.Marshal(ipState)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(IPStateFile, b, 0600); err != nil {
+		return ansi.Errorf("@R{unable to write IP state file} @m{%s}: %s", IPStateFile, err)
+	}
+	return nil
+}
+
+// ipReservedBy returns the instance (other than the given one) for which ip
+// is reserved on the network, if any
+func ipReservedBy(network, ip, instance string) (string, bool) {
+	for other, r := range ipState[network] {
+		if r.IP == ip && other != instance {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// releaseIPs drops the reservations of the instances of a job that no
+// longer exist, now that it has been scaled down to the given size
+func releaseIPs(network, job string, instances int) {
+	for other := range ipState[network] {
+		name, index, ok := strings.Cut(other, "/")
+		if !ok || name != job {
+			continue
+		}
+		if n, err := strconv.Atoi(index); err == nil && n >= instances {
+			delete(ipState[network], other)
+		}
+	}
+}
@@ -147,3 +147,45 @@ func deinterfaceList(o []interface{}, strict bool) ([]interface{}, error) {
 	}
 	return l, nil
 }
+
+// reinterface is the inverse of deinterface: it converts decoded JSON data
+// (string-keyed maps, json.Number values) back into the generic structures
+// used throughout the spruce tree.
+func reinterface(o interface{}) interface{} {
+	switch o := o.(type) {
+	case map[string]interface{}:
+		m := map[interface{}]interface{}{}
+		for k, v := range o {
+			m[k] = reinterface(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(o))
+		for i, v := range o {
+			l[i] = reinterface(v)
+		}
+		return l
+	case json.Number:
+		if i, err := o.Int64(); err == nil {
+			return i
+		}
+		if f, err := o.Float64(); err == nil {
+			return f
+		}
+		return o.String()
+	default:
+		return o
+	}
+}
+
+// decodeJSON unmarshals JSON data into generic spruce tree structures,
+// preserving integers as int64 rather than float64.
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return reinterface(v), nil
+}
@@ -0,0 +1,408 @@
+package spruce
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// JSONPatchOp is a single operation of an RFC 6902 JSON Patch
+type JSONPatchOp struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// JSONPatch is an RFC 6902 JSON Patch, applied one operation at a time
+type JSONPatch []JSONPatchOp
+
+// IsJSONPatch returns true if the list looks like an RFC 6902 JSON Patch,
+// that is, if every entry is a map with `op` and `path` keys. (go-patch
+// operations have a `type` instead of an `op`.)
+func IsJSONPatch(l []interface{}) bool {
+	if len(l) == 0 {
+		return false
+	}
+	for _, e := range l {
+		obj, ok := e.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := obj["op"]; !ok {
+			return false
+		}
+		if _, ok := obj["path"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseJSONPatch validates the operations of an RFC 6902 JSON Patch
+func ParseJSONPatch(l []interface{}) (JSONPatch, error) {
+	patch := JSONPatch{}
+	for i, e := range l {
+		obj, ok := e.(map[interface{}]interface{})
+		if !ok {
+			return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d} @R{is not a hash/map}", i)
+		}
+
+		op := JSONPatchOp{}
+		for _, field := range []string{"op", "path", "from"} {
+			v, present := obj[field]
+			if !present {
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d}@R{:} @c{%s} @R{must be a string}", i, field)
+			}
+			switch field {
+			case "op":
+				op.Op = s
+			case "path":
+				op.Path = s
+			case "from":
+				op.From = s
+			}
+		}
+
+		_, hasValue := obj["value"]
+		_, hasFrom := obj["from"]
+		switch op.Op {
+		case "add", "replace", "test":
+			if !hasValue {
+				return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d} @R{(%s %s) has no} @c{value}", i, op.Op, op.Path)
+			}
+			op.Value = obj["value"]
+		case "move", "copy":
+			if !hasFrom {
+				return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d} @R{(%s %s) has no} @c{from}", i, op.Op, op.Path)
+			}
+		case "remove":
+		default:
+			return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d}@R{: unknown op} @c{'%s'} @R{- must be one of add, remove, replace, move, copy or test}", i, op.Op)
+		}
+
+		for _, ptr := range []string{op.Path, op.From} {
+			if _, err := parseJSONPointer(ptr); err != nil {
+				return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d}@R{: %s}", i, err)
+			}
+		}
+		patch = append(patch, op)
+	}
+	return patch, nil
+}
+
+// Apply applies the patch to a copy of the document, and returns the patched
+// copy. If any of the operations fails, none of them are applied.
+func (patch JSONPatch) Apply(doc map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	var root interface{} = deepCopy(doc)
+	for i, op := range patch {
+		DEBUG("applying JSON Patch operation #%d: %s %s", i, op.Op, op.Path)
+		var err error
+		root, err = op.apply(root)
+		if err != nil {
+			return nil, ansi.Errorf("@R{JSON Patch operation} @c{#%d} @R{(%s %s) failed: %s}", i, op.Op, op.Path, err)
+		}
+	}
+
+	result, ok := root.(map[interface{}]interface{})
+	if !ok {
+		return nil, ansi.Errorf("@R{JSON Patch did not leave a hash/map at the root of the document}")
+	}
+	return result, nil
+}
+
+func (op JSONPatchOp) apply(root interface{}) (interface{}, error) {
+	path, _ := parseJSONPointer(op.Path)
+	switch op.Op {
+	case "add":
+		return jsonPointerAdd(root, path, deepCopy(op.Value))
+
+	case "remove":
+		return jsonPointerRemove(root, path)
+
+	case "replace":
+		if _, err := jsonPointerGet(root, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return deepCopy(op.Value), nil
+		}
+		root, err := jsonPointerRemove(root, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(root, path, deepCopy(op.Value))
+
+	case "move":
+		from, _ := parseJSONPointer(op.From)
+		if op.Path == op.From {
+			return root, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move '%s' into one of its own children", op.From)
+		}
+		v, err := jsonPointerGet(root, from)
+		if err != nil {
+			return nil, err
+		}
+		root, err = jsonPointerRemove(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(root, path, v)
+
+	case "copy":
+		from, _ := parseJSONPointer(op.From)
+		v, err := jsonPointerGet(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(root, path, deepCopy(v))
+
+	case "test":
+		v, err := jsonPointerGet(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, op.Value) {
+			return nil, fmt.Errorf("value is %v, not %v", v, op.Value)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op '%s'", op.Op)
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped
+// reference tokens. The empty pointer refers to the whole document.
+func parseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("JSON Pointer '%s' does not start with a '/'", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// jsonPointerKey finds the key of the map that the reference token names
+func jsonPointerKey(m map[interface{}]interface{}, token string) (interface{}, bool) {
+	if _, ok := m[token]; ok {
+		return token, true
+	}
+	for k := range m {
+		if fmt.Sprintf("%v", k) == token {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// jsonPointerIndex parses the reference token as an index into a list of
+// the given length. For additions, the index may be one past the end (or
+// `-`, which means the same thing).
+func jsonPointerIndex(l []interface{}, token string, adding bool) (int, error) {
+	if adding && token == "-" {
+		return len(l), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') || strings.HasPrefix(token, "+") {
+		return 0, fmt.Errorf("'%s' is not a valid list index", token)
+	}
+	if i > len(l) || (i == len(l) && !adding) {
+		return 0, fmt.Errorf("list index %d is out of bounds (the list has %d entries)", i, len(l))
+	}
+	return i, nil
+}
+
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch v := doc.(type) {
+		case map[interface{}]interface{}:
+			k, ok := jsonPointerKey(v, token)
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found", token)
+			}
+			doc = v[k]
+
+		case []interface{}:
+			i, err := jsonPointerIndex(v, token, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+
+		default:
+			return nil, fmt.Errorf("cannot find '%s' in a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointerUpdate replaces the container at all but the last token of
+// the path with the result of calling fn on it and the last token
+func jsonPointerUpdate(doc interface{}, path []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := jsonPointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPointerUpdate(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := doc.(type) {
+	case map[interface{}]interface{}:
+		k, _ := jsonPointerKey(v, path[0])
+		v[k] = child
+	case []interface{}:
+		i, _ := jsonPointerIndex(v, path[0], false)
+		v[i] = child
+	}
+	return doc, nil
+}
+
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case map[interface{}]interface{}:
+			k, ok := jsonPointerKey(v, token)
+			if !ok {
+				k = token
+			}
+			v[k] = value
+			return v, nil
+
+		case []interface{}:
+			i, err := jsonPointerIndex(v, token, true)
+			if err != nil {
+				return nil, err
+			}
+			l := make([]interface{}, 0, len(v)+1)
+			l = append(l, v[:i]...)
+			l = append(l, value)
+			return append(l, v[i:]...), nil
+		}
+		return nil, fmt.Errorf("cannot add '%s' to a scalar value", token)
+	})
+}
+
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+	return jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case map[interface{}]interface{}:
+			k, ok := jsonPointerKey(v, token)
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found", token)
+			}
+			delete(v, k)
+			return v, nil
+
+		case []interface{}:
+			i, err := jsonPointerIndex(v, token, false)
+			if err != nil {
+				return nil, err
+			}
+			return deleteIndexFromList(v, i), nil
+		}
+		return nil, fmt.Errorf("cannot remove '%s' from a scalar value", token)
+	})
+}
+
+// jsonEqual compares two values the way JSON does, where all numbers are
+// equal if their values are, whether YAML parsed them as ints or floats
+func jsonEqual(a interface{}, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x == y
+	}
+
+	switch a := a.(type) {
+	case map[interface{}]interface{}:
+		b, ok := b.(map[interface{}]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			bk, ok := jsonPointerKey(b, fmt.Sprintf("%v", k))
+			if !ok || !jsonEqual(v, b[bk]) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// MergePatch applies an RFC 7386 JSON Merge Patch to the target, modifying
+// it in place where it can, and returns the result. Maps in the patch are
+// merged recursively, nulls delete keys, and everything else (lists
+// included) replaces the target's value.
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[interface{}]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[interface{}]interface{})
+	if !ok {
+		t = map[interface{}]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			DEBUG("merge patch: deleting key '%v'", k)
+			delete(t, k)
+			continue
+		}
+		t[k] = MergePatch(t[k], v)
+	}
+	return t
+}
@@ -0,0 +1,103 @@
+package spruce
+
+import (
+	"github.com/geofffranks/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON Patches", func() {
+	parse := func(s string) interface{} {
+		var v interface{}
+		Expect(yaml.Unmarshal([]byte(s), &v)).To(Succeed())
+		return v
+	}
+
+	var doc map[interface{}]interface{}
+	BeforeEach(func() {
+		doc = parse(`{"name": "web", "tags": ["a", "b"], "meta": {"a/b": 1, "m~n": 2}}`).(map[interface{}]interface{})
+	})
+
+	apply := func(patch string) (map[interface{}]interface{}, error) {
+		ops, err := ParseJSONPatch(parse(patch).([]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		return ops.Apply(doc)
+	}
+
+	Context("RFC 6902 JSON Patch", func() {
+		It("recognizes lists of operations", func() {
+			Expect(IsJSONPatch(parse(`[{"op": "remove", "path": "/name"}]`).([]interface{}))).To(BeTrue())
+			Expect(IsJSONPatch(parse(`[{"type": "remove", "path": "/name"}]`).([]interface{}))).To(BeFalse())
+			Expect(IsJSONPatch([]interface{}{})).To(BeFalse())
+		})
+
+		It("adds, removes and replaces values", func() {
+			result, err := apply(`[
+				{"op": "add", "path": "/tags/1", "value": "x"},
+				{"op": "add", "path": "/tags/-", "value": "z"},
+				{"op": "replace", "path": "/name", "value": "api"},
+				{"op": "remove", "path": "/meta/a~1b"},
+				{"op": "add", "path": "/meta/m~0n", "value": 3}
+			]`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(parse(`{"name": "api", "tags": ["a", "x", "b", "z"], "meta": {"m~n": 3}}`)))
+		})
+
+		It("moves, copies and tests values", func() {
+			result, err := apply(`[
+				{"op": "test", "path": "/meta/a~1b", "value": 1.0},
+				{"op": "copy", "from": "/tags", "path": "/meta/tags"},
+				{"op": "move", "from": "/name", "path": "/meta/name"}
+			]`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(parse(`{"tags": ["a", "b"], "meta": {"a/b": 1, "m~n": 2, "tags": ["a", "b"], "name": "web"}}`)))
+		})
+
+		It("leaves the document alone when an operation fails", func() {
+			_, err := apply(`[
+				{"op": "remove", "path": "/name"},
+				{"op": "test", "path": "/tags/0", "value": "b"}
+			]`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("JSON Patch operation #1 (test /tags/0) failed: value is a, not b"))
+			Expect(doc).To(HaveKey("name"))
+		})
+
+		It("reports bad paths and operations", func() {
+			_, err := apply(`[{"op": "remove", "path": "/tags/2"}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0 (remove /tags/2) failed: list index 2 is out of bounds (the list has 2 entries)"))
+
+			_, err = apply(`[{"op": "replace", "path": "/nope", "value": 1}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0 (replace /nope) failed: key 'nope' not found"))
+
+			_, err = apply(`[{"op": "move", "from": "/meta", "path": "/meta/child"}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0 (move /meta/child) failed: cannot move '/meta' into one of its own children"))
+
+			_, err = apply(`[{"op": "frob", "path": "/name"}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0: unknown op 'frob' - must be one of add, remove, replace, move, copy or test"))
+
+			_, err = apply(`[{"op": "add", "path": "name", "value": 1}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0: JSON Pointer 'name' does not start with a '/'"))
+
+			_, err = apply(`[{"op": "add", "path": "/name"}]`)
+			Expect(err).To(MatchError("JSON Patch operation #0 (add /name) has no value"))
+
+			_, err = apply(`[{"op": "replace", "path": "", "value": [1]}]`)
+			Expect(err).To(MatchError("JSON Patch did not leave a hash/map at the root of the document"))
+		})
+	})
+
+	Context("RFC 7386 JSON Merge Patch", func() {
+		It("merges maps, deletes nulls and replaces everything else", func() {
+			result := MergePatch(doc, parse(`{"name": null, "tags": ["c"], "meta": {"m~n": null, "new": {"x": 1}}}`))
+			Expect(result).To(Equal(parse(`{"tags": ["c"], "meta": {"a/b": 1, "new": {"x": 1}}}`)))
+		})
+
+		It("replaces the target when the patch is not a map", func() {
+			Expect(MergePatch(doc, "scalar")).To(Equal("scalar"))
+			Expect(MergePatch("scalar", parse(`{"a": 1, "b": null}`))).To(Equal(parse(`{"a": 1}`)))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package spruce
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+)
+
+// KeyOrder lists the keys that should come first, in that order, when the
+// maps at the paths matching Path (a dotted path glob, see MergeRule) are
+// printed. An empty Path means the top-level map.
+type KeyOrder struct {
+	Path string
+	Keys []string
+}
+
+// ParseKeyOrder parses a key order given as PATH:KEY,KEY,... or, for the
+// top-level map, as just KEY,KEY,...
+func ParseKeyOrder(s string) (KeyOrder, error) {
+	order := KeyOrder{}
+	keys := s
+	if i := strings.Index(s, ":"); i >= 0 {
+		order.Path, keys = strings.TrimSpace(s[:i]), s[i+1:]
+	}
+	if order.Path == "$" {
+		order.Path = ""
+	}
+
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			order.Keys = append(order.Keys, key)
+		}
+	}
+	if len(order.Keys) == 0 {
+		return KeyOrder{}, ansi.Errorf("@R{key order} @c{'%s'} @R{does not list any keys}", s)
+	}
+	return order, nil
+}
+
+func (o KeyOrder) matches(node string) bool {
+	if o.Path == "" {
+		return node == ""
+	}
+	return matchPathGlob(o.Path, node)
+}
+
+// OrderKeys returns a copy of tree in which the maps that the first matching
+// KeyOrder applies to are yaml.MapSlices, so that they are printed with the
+// listed keys first, in that order, followed by the rest of their keys in the
+// usual order. List entries are addressed by name, or failing that, index.
+func OrderKeys(tree interface{}, orders []KeyOrder) interface{} {
+	if len(orders) == 0 {
+		return tree
+	}
+	return orderKeys(tree, orders, "")
+}
+
+func orderKeys(v interface{}, orders []KeyOrder, node string) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			m[k] = orderKeys(val, orders, orderKeysPath(node, fmt.Sprintf("%v", k)))
+		}
+
+		for _, order := range orders {
+			if order.matches(node) {
+				return orderedMap(m, order.Keys)
+			}
+		}
+		return m
+
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, entry := range v {
+			l[i] = orderKeys(entry, orders, orderKeysPath(node, nameOfObj(entry, fmt.Sprintf("%d", i))))
+		}
+		return l
+	}
+	return v
+}
+
+func orderKeysPath(node string, key string) string {
+	if node == "" {
+		return key
+	}
+	return node + "." + key
+}
+
+// orderedMap turns m into a yaml.MapSlice, with the given keys first
+func orderedMap(m map[interface{}]interface{}, first []string) yaml.MapSlice {
+	ordered := yaml.MapSlice{}
+	seen := map[interface{}]bool{}
+	for _, key := range first {
+		for k, v := range m {
+			if !seen[k] && fmt.Sprintf("%v", k) == key {
+				ordered = append(ordered, yaml.MapItem{Key: k, Value: v})
+				seen[k] = true
+			}
+		}
+	}
+
+	rest := []interface{}{}
+	for k := range m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return naturalCompare(fmt.Sprintf("%v", rest[i]), fmt.Sprintf("%v", rest[j])) < 0
+	})
+	for _, k := range rest {
+		ordered = append(ordered, yaml.MapItem{Key: k, Value: m[k]})
+	}
+	return ordered
+}
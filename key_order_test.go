@@ -0,0 +1,87 @@
+package spruce
+
+import (
+	"github.com/geofffranks/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key ordering", func() {
+	Describe("ParseKeyOrder", func() {
+		It("parses a path and its keys", func() {
+			order, err := ParseKeyOrder("instance_groups.*: name, instances,jobs")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(order).To(Equal(KeyOrder{Path: "instance_groups.*", Keys: []string{"name", "instances", "jobs"}}))
+		})
+
+		It("treats keys without a path as the top-level map", func() {
+			order, err := ParseKeyOrder("name,releases")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(order).To(Equal(KeyOrder{Keys: []string{"name", "releases"}}))
+
+			order, err = ParseKeyOrder("$:name")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(order).To(Equal(KeyOrder{Keys: []string{"name"}}))
+		})
+
+		It("requires at least one key", func() {
+			_, err := ParseKeyOrder("meta:")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not list any keys"))
+		})
+	})
+
+	Describe("OrderKeys", func() {
+		tree := map[interface{}]interface{}{
+			"releases": []interface{}{"r"},
+			"name":     "deployment",
+			"azs":      []interface{}{"z1"},
+			"instance_groups": []interface{}{
+				map[interface{}]interface{}{"jobs": []interface{}{}, "name": "web", "azs": []interface{}{"z1"}},
+			},
+			"meta": map[interface{}]interface{}{"b": 2, "a": 1, "c": 3},
+		}
+
+		It("leaves the tree alone without any key orders", func() {
+			Expect(OrderKeys(tree, nil)).To(Equal(tree))
+		})
+
+		It("puts the listed keys first, and the rest in the usual order", func() {
+			ordered := OrderKeys(tree, []KeyOrder{
+				{Keys: []string{"name", "releases"}},
+				{Path: "instance_groups.*", Keys: []string{"name", "missing"}},
+			})
+
+			out, err := yaml.Marshal(ordered)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal(`name: deployment
+releases:
+- r
+azs:
+- z1
+instance_groups:
+- name: web
+  azs:
+  - z1
+  jobs: []
+meta:
+  a: 1
+  b: 2
+  c: 3
+`))
+		})
+
+		It("uses the first key order that matches a path, and does not change the tree", func() {
+			ordered := OrderKeys(tree, []KeyOrder{
+				{Path: "meta", Keys: []string{"c"}},
+				{Path: "meta", Keys: []string{"b"}},
+			})
+			Expect(ordered.(map[interface{}]interface{})["meta"]).To(Equal(yaml.MapSlice{
+				{Key: "c", Value: 3},
+				{Key: "a", Value: 1},
+				{Key: "b", Value: 2},
+			}))
+			Expect(tree["meta"]).To(BeAssignableToTypeOf(map[interface{}]interface{}{}))
+		})
+	})
+})
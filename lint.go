@@ -0,0 +1,268 @@
+package spruce
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// LintProblem is something wrong with a merged document, and the path to
+// where it was found
+type LintProblem struct {
+	Path    string
+	Message string
+}
+
+func (p LintProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// boshDefinitions collects the names of everything that instance groups
+// can refer to, from the manifest itself or, failing that, the cloud-config.
+// A kind of definition that is declared nowhere is left out entirely, so
+// that references to it go unchecked.
+type boshDefinitions map[string]map[string]interface{}
+
+func lintDefinitions(manifest map[interface{}]interface{}) boshDefinitions {
+	defs := boshDefinitions{}
+	collect := func(section, field string) {
+		l, ok := manifest[section].([]interface{})
+		if !ok && CloudConfig != nil {
+			l, ok = CloudConfig[section].([]interface{})
+		}
+		if !ok {
+			return
+		}
+		defs[section] = map[string]interface{}{}
+		for _, item := range l {
+			if m, ok := item.(map[interface{}]interface{}); ok {
+				if name, ok := m[field].(string); ok {
+					defs[section][name] = m
+				}
+			}
+		}
+	}
+
+	collect("azs", "name")
+	collect("networks", "name")
+	collect("vm_types", "name")
+	collect("vm_extensions", "name")
+	collect("disk_types", "name")
+	collect("stemcells", "alias")
+	collect("releases", "name")
+	return defs
+}
+
+// check reports whether name is defined in the section, or true if
+// nothing in the section can be checked
+func (defs boshDefinitions) check(section, name string) bool {
+	known, ok := defs[section]
+	if !ok {
+		return true
+	}
+	_, ok = known[name]
+	return ok
+}
+
+// lintName returns the path segment for an entry of a list, preferring its
+// name, the same way that spruce paths do
+func lintName(v interface{}, i int) string {
+	return nameOfObj(v, strconv.Itoa(i))
+}
+
+// LintBOSH cross-checks the references in a merged BOSH manifest: that the
+// networks, AZs, VM and disk types, VM extensions, stemcells and releases
+// that each instance group uses are all defined (in the manifest, or in the
+// CloudConfig), and that its static IPs fit its instance count and network.
+func LintBOSH(manifest map[interface{}]interface{}) []LintProblem {
+	problems := []LintProblem{}
+	report := func(path, msg string, args ...interface{}) {
+		problems = append(problems, LintProblem{Path: path, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	defs := lintDefinitions(manifest)
+	section := "instance_groups"
+	groups, ok := manifest[section].([]interface{})
+	if !ok {
+		section = "jobs"
+		groups, ok = manifest[section].([]interface{})
+	}
+	if !ok {
+		if _, present := manifest["instance_groups"]; present {
+			report("instance_groups", "is not a list")
+		}
+		return problems
+	}
+
+	staticIPOwners := map[string]string{}
+	for i, g := range groups {
+		group, ok := g.(map[interface{}]interface{})
+		if !ok {
+			report(fmt.Sprintf("%s.%d", section, i), "is not a map")
+			continue
+		}
+		here := fmt.Sprintf("%s.%s", section, lintName(g, i))
+
+		instances, counted := 0, false
+		switch n := group["instances"].(type) {
+		case int:
+			instances, counted = n, true
+		case int64:
+			instances, counted = int(n), true
+		case nil:
+			report(here, "does not specify how many instances to deploy")
+		default:
+			report(here+".instances", "%v is not a number", n)
+		}
+		if counted && instances < 0 {
+			report(here+".instances", "cannot be negative")
+			counted = false
+		}
+
+		azs := []string{}
+		if l, ok := group["azs"].([]interface{}); ok {
+			for j, z := range l {
+				az := fmt.Sprintf("%v", z)
+				if !defs.check("azs", az) {
+					report(fmt.Sprintf("%s.azs.%d", here, j), "AZ '%s' is not defined in azs", az)
+					continue
+				}
+				azs = append(azs, az)
+			}
+		}
+
+		if section == "instance_groups" {
+			if vm, ok := group["vm_type"].(string); ok {
+				if !defs.check("vm_types", vm) {
+					report(here+".vm_type", "vm_type '%s' is not defined in vm_types", vm)
+				}
+			} else if group["vm_resources"] == nil {
+				report(here, "specifies neither a vm_type nor vm_resources")
+			}
+
+			if stemcell, ok := group["stemcell"].(string); ok {
+				if !defs.check("stemcells", stemcell) {
+					report(here+".stemcell", "stemcell '%s' does not match the alias of any stemcell", stemcell)
+				}
+			} else {
+				report(here, "does not specify a stemcell")
+			}
+		}
+
+		if disk, ok := group["persistent_disk_type"].(string); ok && !defs.check("disk_types", disk) {
+			report(here+".persistent_disk_type", "disk_type '%s' is not defined in disk_types", disk)
+		}
+
+		if l, ok := group["vm_extensions"].([]interface{}); ok {
+			for j, x := range l {
+				if name := fmt.Sprintf("%v", x); !defs.check("vm_extensions", name) {
+					report(fmt.Sprintf("%s.vm_extensions.%d", here, j), "vm_extension '%s' is not defined in vm_extensions", name)
+				}
+			}
+		}
+
+		if l, ok := group["jobs"].([]interface{}); ok {
+			for j, job := range l {
+				m, ok := job.(map[interface{}]interface{})
+				if !ok {
+					continue
+				}
+				release, ok := m["release"].(string)
+				if !ok {
+					continue
+				}
+				if !defs.check("releases", release) {
+					report(fmt.Sprintf("%s.jobs.%s.release", here, lintName(job, j)), "release '%s' is not defined in releases", release)
+				}
+			}
+		}
+
+		l, ok := group["networks"].([]interface{})
+		if !ok {
+			report(here, "is not on any networks")
+			continue
+		}
+		for j, n := range l {
+			network, ok := n.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("%v", network["name"])
+			at := fmt.Sprintf("%s.networks.%s", here, lintName(n, j))
+			if !defs.check("networks", name) {
+				report(at+".name", "network '%s' is not defined in networks", name)
+				continue
+			}
+
+			def, _ := defs["networks"][name].(map[interface{}]interface{})
+			subnets, _ := def["subnets"].([]interface{})
+			subnetAZs := map[string]bool{}
+			for _, s := range subnets {
+				subnet, _ := s.(map[interface{}]interface{})
+				if az, ok := subnet["az"].(string); ok {
+					subnetAZs[az] = true
+				}
+				if zs, ok := subnet["azs"].([]interface{}); ok {
+					for _, z := range zs {
+						subnetAZs[fmt.Sprintf("%v", z)] = true
+					}
+				}
+			}
+			if len(subnetAZs) > 0 {
+				for _, az := range azs {
+					if !subnetAZs[az] {
+						report(at+".name", "network '%s' has no subnet in AZ '%s'", name, az)
+					}
+				}
+			}
+
+			ips, ok := network["static_ips"].([]interface{})
+			if !ok {
+				continue
+			}
+			if counted && len(ips) != instances {
+				report(at+".static_ips", "%d static IPs given for %d instances", len(ips), instances)
+			}
+			for k, ip := range ips {
+				addr := fmt.Sprintf("%v", ip)
+				where := fmt.Sprintf("%s.static_ips.%d", at, k)
+				if owner, taken := staticIPOwners[addr]; taken {
+					report(where, "static IP %s is also used by %s", addr, owner)
+				}
+				staticIPOwners[addr] = here
+				if len(subnets) > 0 && !lintStaticIP(subnets, addr) {
+					report(where, "%s is not a static IP of network '%s'", addr, name)
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// lintStaticIP reports whether the address falls within the static range
+// of any of the subnets
+func lintStaticIP(subnets []interface{}, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	n := ipToInt(ip)
+	for _, s := range subnets {
+		subnet, _ := s.(map[interface{}]interface{})
+		static, _ := subnet["static"].([]interface{})
+		for _, r := range static {
+			rng, err := parseIPRange(strings.TrimSpace(fmt.Sprintf("%v", r)))
+			if err == nil && (ip.To4() != nil) == (rng.length == net.IPv4len) && inRange(n, rng) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inRange(n *big.Int, r ipRange) bool {
+	return n.Cmp(r.first) >= 0 && n.Cmp(r.last) <= 0
+}
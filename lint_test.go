@@ -0,0 +1,140 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LintBOSH", func() {
+	lint := func(yml string) []string {
+		l := []string{}
+		for _, p := range LintBOSH(evalYAML(yml)) {
+			l = append(l, p.String())
+		}
+		return l
+	}
+
+	AfterEach(func() {
+		CloudConfig = nil
+	})
+
+	manifest := `
+azs: [ { name: z1 }, { name: z2 } ]
+vm_types: [ { name: small } ]
+vm_extensions: [ { name: lb } ]
+disk_types: [ { name: 10GB } ]
+releases: [ { name: app } ]
+stemcells: [ { alias: default } ]
+networks:
+- name: default
+  subnets:
+  - az: z1
+    static: [ 10.0.1.10 - 10.0.1.20 ]
+  - azs: [ z2 ]
+    static: [ 10.0.2.10 - 10.0.2.20 ]
+`
+
+	It("finds nothing wrong with a consistent manifest", func() {
+		Expect(lint(manifest + `
+instance_groups:
+- name: web
+  instances: 2
+  azs: [ z1, z2 ]
+  vm_type: small
+  vm_extensions: [ lb ]
+  persistent_disk_type: 10GB
+  stemcell: default
+  jobs: [ { name: web, release: app } ]
+  networks:
+  - name: default
+    static_ips: [ 10.0.1.10, 10.0.2.10 ]
+`)).To(BeEmpty())
+	})
+
+	It("reports references to things that are not defined", func() {
+		Expect(lint(manifest + `
+instance_groups:
+- name: web
+  instances: 1
+  azs: [ z1, z9 ]
+  vm_type: huge
+  vm_extensions: [ lb, nope ]
+  persistent_disk_type: 1TB
+  stemcell: trusty
+  jobs: [ { name: web, release: other } ]
+  networks: [ { name: private } ]
+`)).To(Equal([]string{
+			"instance_groups.web.azs.1: AZ 'z9' is not defined in azs",
+			"instance_groups.web.vm_type: vm_type 'huge' is not defined in vm_types",
+			"instance_groups.web.stemcell: stemcell 'trusty' does not match the alias of any stemcell",
+			"instance_groups.web.persistent_disk_type: disk_type '1TB' is not defined in disk_types",
+			"instance_groups.web.vm_extensions.1: vm_extension 'nope' is not defined in vm_extensions",
+			"instance_groups.web.jobs.web.release: release 'other' is not defined in releases",
+			"instance_groups.web.networks.private.name: network 'private' is not defined in networks",
+		}))
+	})
+
+	It("checks static IPs against instance counts and networks", func() {
+		Expect(lint(manifest + `
+instance_groups:
+- name: web
+  instances: 2
+  vm_type: small
+  stemcell: default
+  networks:
+  - name: default
+    static_ips: [ 10.0.1.10, 10.0.1.11, 10.0.9.1 ]
+- name: db
+  instances: 1
+  vm_type: small
+  stemcell: default
+  networks:
+  - name: default
+    static_ips: [ 10.0.1.11 ]
+`)).To(Equal([]string{
+			"instance_groups.web.networks.default.static_ips: 3 static IPs given for 2 instances",
+			"instance_groups.web.networks.default.static_ips.2: 10.0.9.1 is not a static IP of network 'default'",
+			"instance_groups.db.networks.default.static_ips.0: static IP 10.0.1.11 is also used by instance_groups.web",
+		}))
+	})
+
+	It("reports AZs that the network has no subnet in, and missing essentials", func() {
+		Expect(lint(`
+azs: [ { name: z1 }, { name: z2 } ]
+networks: [ { name: default, subnets: [ { az: z1 } ] } ]
+instance_groups:
+- name: web
+  instances: -1
+  azs: [ z2 ]
+  networks: [ { name: default } ]
+- name: db
+`)).To(Equal([]string{
+			"instance_groups.web.instances: cannot be negative",
+			"instance_groups.web: specifies neither a vm_type nor vm_resources",
+			"instance_groups.web: does not specify a stemcell",
+			"instance_groups.web.networks.default.name: network 'default' has no subnet in AZ 'z2'",
+			"instance_groups.db: does not specify how many instances to deploy",
+			"instance_groups.db: specifies neither a vm_type nor vm_resources",
+			"instance_groups.db: does not specify a stemcell",
+			"instance_groups.db: is not on any networks",
+		}))
+	})
+
+	It("looks up definitions in the cloud-config", func() {
+		CloudConfig = evalYAML(`
+vm_types: [ { name: small } ]
+networks: [ { name: default } ]
+`)
+		Expect(lint(`
+stemcells: [ { alias: default } ]
+instance_groups:
+- name: web
+  instances: 1
+  vm_type: large
+  stemcell: default
+  networks: [ { name: default } ]
+`)).To(Equal([]string{
+			"instance_groups.web.vm_type: vm_type 'large' is not defined in vm_types",
+		}))
+	})
+})
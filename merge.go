@@ -15,11 +15,11 @@ import (
 
 var (
 	// mergeMap regexes
-	mergeMapRx = regexp.MustCompile(`^\s*\Q((\E\s*merge\s*.*\Q))\E`)
+	mergeMapRx = regexp.MustCompile(`^\s*\Q((\E\s*merge(?:\s+.*)?\Q))\E`)
 
 	// mergeObj regexes
 	mergeObjPruneRx = regexp.MustCompile(`^\s*\Q((\E\s*prune\s*\Q))\E`)
-	mergeObjSortRx  = regexp.MustCompile(`^\s*\Q((\E\s*sort(?:\s+by\s+(.*?))?\s*\Q))\E$`)
+	mergeObjSortRx  = regexp.MustCompile(`^\s*\Q((\E\s*sort(?:\s+(.*?))?\s*\Q))\E$`)
 
 	// getArrayModifications regexes
 	mergeRegEx                = regexp.MustCompile(`^\Q((\E\s*merge\s*\Q))\E$`)
@@ -28,11 +28,16 @@ var (
 	inlineRegEx               = regexp.MustCompile(`^\Q((\E\s*inline\s*\Q))\E$`)
 	appendRegEx               = regexp.MustCompile(`^\Q((\E\s*append\s*\Q))\E$`)
 	prependRegEx              = regexp.MustCompile(`^\Q((\E\s*prepend\s*\Q))\E$`)
+	appendUniqueRegEx         = regexp.MustCompile(`^\Q((\E\s*(?:append\s+unique|union)(?:\s+on\s+(.+?))?\s*\Q))\E$`)
 	insertByIdxRegEx          = regexp.MustCompile(`^\Q((\E\s*insert\s+(after|before)\s+(\d+)\s*\Q))\E$`)
-	insertByNameRegEx         = regexp.MustCompile(`^\Q((\E\s*insert\s+(after|before)\s+([^ ]+)?\s*"(.+)"\s*\Q))\E$`)
+	insertByNameRegEx         = regexp.MustCompile(`^\Q((\E\s*insert\s+(after|before)\s+([^\s,]+(?:\s*,\s*[^\s,]+)*)?\s*"(.+)"\s*\Q))\E$`)
 	deleteByIdxRegEx          = regexp.MustCompile(`^\Q((\E\s*delete\s+(-?\d+)\s*\Q))\E$`)
-	deleteByNameRegEx         = regexp.MustCompile(`^\Q((\E\s*delete\s+([^ ]+)?\s*"(.+)"\s*\Q))\E$`)
-	deleteByNameUnquotedRegEx = regexp.MustCompile(`^\Q((\E\s*delete\s+([^ ]+)?\s*(.+)\s*\Q))\E$`)
+	deleteByNameRegEx         = regexp.MustCompile(`^\Q((\E\s*delete\s+([^\s,]+(?:\s*,\s*[^\s,]+)*)?\s*"(.+)"\s*\Q))\E$`)
+	deleteByNameUnquotedRegEx = regexp.MustCompile(`^\Q((\E\s*delete\s+([^\s,]+(?:\s*,\s*[^\s,]+)*)?\s*(.+)\s*\Q))\E$`)
+
+	// getMapStrategy regexes
+	mapReplaceRx       = regexp.MustCompile(`^\Q((\E\s*replace\s*\Q))\E$`)
+	mapMergeStrategyRx = regexp.MustCompile(`^\Q((\E\s*merge-strategy\s*\Q))\E$`)
 
 	// shouldKeyMergeArray regexes
 	shouldKeyMergeArrayRx = regexp.MustCompile(`^\Q((\E\s*merge(?:\s+on\s+(.*?))?\s*\Q))\E$`)
@@ -47,13 +52,47 @@ const (
 	listOpReplace
 	listOpInsert
 	listOpDelete
+	listOpUnion
+)
+
+type mapStrategy int
+
+const (
+	mapStrategyDeep mapStrategy = iota
+	mapStrategyShallow
+	mapStrategyReplace
 )
 
+var mapStrategies = map[string]mapStrategy{
+	"deep":    mapStrategyDeep,
+	"shallow": mapStrategyShallow,
+	"replace": mapStrategyReplace,
+}
+
 // Merger ...
 type Merger struct {
 	AppendByDefault bool
+	Rules           MergeRules
+	Mode            MergeMode
+
+	// NoNewKeys lists path globs under which documents after the first may
+	// only override keys that already exist
+	NoNewKeys []string
+	// StrictTypes refuses to replace maps, lists and scalars with one another
+	StrictTypes bool
+	// ReportOverrides records every value replaced by a later document in
+	// Overrides, attributed to the Source of each document
+	ReportOverrides bool
+	Source          string
+	Overrides       []Override
 
 	Errors MultiError
+
+	docs      int
+	adding    int
+	replaying int
+	origins   map[string]string
+	kind      string
 }
 
 // ModificationDefinition encapsulates the details of an array modification:
@@ -125,6 +164,30 @@ func deepCopy(orig interface{}) interface{} {
 
 // Merge ...
 func (m *Merger) Merge(a map[interface{}]interface{}, b map[interface{}]interface{}) error {
+	m.docs++
+	if m.Mode == MergeModeStrategic {
+		// the kind of resource decides some of the patch merge keys
+		for _, doc := range []map[interface{}]interface{}{b, a} {
+			if kind, ok := doc["kind"].(string); ok {
+				m.kind = kind
+				break
+			}
+		}
+		if _, deleted := m.mergeStrategicMap(a, b, "$").(strategicDeletion); deleted {
+			for k := range a {
+				delete(a, k)
+			}
+		}
+		return m.Error()
+	}
+
+	b, strategy, err := getMapStrategy(b, "$", mapStrategyDeep)
+	if err != nil {
+		m.Errors.Append(err)
+		return m.Error()
+	}
+
+	clearForMapStrategy(a, b, strategy)
 	m.mergeMap(a, b, "$")
 	return m.Error()
 }
@@ -141,6 +204,10 @@ func (m *Merger) mergeMap(orig map[interface{}]interface{}, n map[interface{}]in
 			orig[k] = m.mergeObj(orig[k], val, path)
 		} else {
 			DEBUG("%s: not found upstream, adding it", path)
+			if err := m.newKeyForbidden(path); err != nil {
+				m.Errors.Append(err)
+				continue
+			}
 			orig[k] = m.mergeObj(nil, deepCopy(val), path)
 		}
 	}
@@ -182,22 +249,62 @@ func (m *Merger) mergeObj(orig interface{}, n interface{}, node string) interfac
 		return orig
 	}
 
+	rule := m.Rules.match(node)
+	if rule != nil && rule.Strategy == "error" && orig != nil {
+		m.Errors.Append(ansi.Errorf("@m{%s}: @R{cannot be overridden, according to the merge rule for} @c{%s}", node, rule.Path))
+		return orig
+	}
+	if err := m.strictTypes(orig, n, node); err != nil {
+		m.Errors.Append(err)
+		return orig
+	}
+
+	// everything below a key that did not exist before is new
+	if orig == nil {
+		m.adding++
+		defer func() { m.adding-- }()
+	}
+
+	if m.Mode == MergeModeStrategic {
+		return m.mergeStrategic(orig, n, node)
+	}
+
 	switch t := n.(type) {
 	case map[interface{}]interface{}:
+		def := mapStrategyDeep
+		if rule != nil && rule.Strategy != "error" {
+			s, ok := mapStrategies[rule.Strategy]
+			if !ok {
+				m.Errors.Append(ansi.Errorf("@m{%s}: @R{merge strategy} @c{'%s'} @R{from the merge rule for} @c{%s} @R{cannot be applied to a map}", node, rule.Strategy, rule.Path))
+				return orig
+			}
+			def = s
+		}
+
+		t, strategy, err := getMapStrategy(t, node, def)
+		if err != nil {
+			m.Errors.Append(err)
+			return orig
+		}
+
 		switch orig.(type) {
 		case map[interface{}]interface{}:
 			DEBUG("%s: performing map merge", node)
-			m.mergeMap(orig.(map[interface{}]interface{}), n.(map[interface{}]interface{}), node)
+			clearForMapStrategy(orig.(map[interface{}]interface{}), t, strategy)
+			m.mergeMap(orig.(map[interface{}]interface{}), t, node)
 			return orig
 
 		case nil:
 			orig := map[interface{}]interface{}{}
-			m.mergeMap(orig, n.(map[interface{}]interface{}), node)
+			m.mergeMap(orig, t, node)
 			return orig
 
 		default:
 			DEBUG("%s: replacing with new data (original was not a map)", node)
-			return t
+			m.recordOverride(orig, t, node)
+			orig := map[interface{}]interface{}{}
+			m.mergeMap(orig, t, node)
+			return orig
 		}
 
 	case []interface{}:
@@ -217,17 +324,29 @@ func (m *Merger) mergeObj(orig interface{}, n interface{}, node string) interfac
 			}
 
 			DEBUG("%s: replacing with new data (original was not an array)", node)
+			m.recordOverride(orig, t, node)
 			return t
 		}
 
 	default:
 		DEBUG("%s: replacing with new data (new data is neither map nor array)", node)
+		m.recordOverride(orig, t, node)
 		return t
 	}
 }
 
 func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []interface{} {
 	modificationDefinitions := getArrayModifications(n, isSimpleList(orig))
+
+	// Without any explicit array operators, a merge rule may say how to merge
+	if rule := m.Rules.match(node); rule != nil && rule.Strategy != "error" && len(modificationDefinitions) == 1 {
+		if _, isMapStrategy := mapStrategies[rule.Strategy]; isMapStrategy && rule.Strategy != "replace" {
+			m.Errors.Append(ansi.Errorf("@m{%s}: @R{merge strategy} @c{'%s'} @R{from the merge rule for} @c{%s} @R{cannot be applied to an array}", node, rule.Strategy, rule.Path))
+			return nil
+		}
+		n = append([]interface{}{rule.directive()}, n...)
+		modificationDefinitions = getArrayModifications(n, isSimpleList(orig))
+	}
 	DEBUG("%s: performing %d modification operations against list", node, len(modificationDefinitions))
 
 	// Create a copy of orig for the (multiple) modifications that are about to happen
@@ -254,11 +373,7 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 				key = getDefaultIdentifierKey()
 			}
 
-			if err := canKeyMergeArray("new", modificationDefinition.list, node, key); err != nil {
-				m.Errors.Append(err)
-				return nil
-			}
-			if err := canKeyMergeArray("original", orig, node, key); err != nil {
+			if err := m.checkKeyMergeArrays(orig, modificationDefinition.list, node, key); err != nil {
 				m.Errors.Append(err)
 				return nil
 			}
@@ -273,6 +388,17 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 			continue
 		}
 
+		// Perform a set union list modification (append only entries not yet in the list)
+		if modificationDefinition.listOp == listOpUnion {
+			key := modificationDefinition.key
+			if key == "" {
+				key = getDefaultIdentifierKey()
+			}
+			DEBUG("%s: appending %d new elements to existing array, skipping duplicates", node, len(modificationDefinition.list))
+			result = setUnion(key, result, modificationDefinition.list)
+			continue
+		}
+
 		// Perform a list replacement modification
 		if modificationDefinition.listOp == listOpReplace {
 			result = make([]interface{}, len(modificationDefinition.list))
@@ -328,11 +454,16 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 				}
 
 				// Since we have a way to identify indiviual entries based on their key/id, we can sanity check for possible duplicates
+				fields := keyFields(key)
 				for _, entry := range modificationDefinition.list {
 					obj := entry.(map[interface{}]interface{})
-					entryName := obj[key].(string)
-					if getIndexOfEntry(result, key, entryName) > 0 {
-						m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to insert, because new list entry} @c{'%s: %s'} @R{is detected multiple times}", node, key, entryName))
+					values := make([]string, len(fields))
+					for i, field := range fields {
+						v, _ := keyFieldValue(obj, field)
+						values[i] = fmt.Sprintf("%v", v)
+					}
+					if indexOfEntry(result, fields, values) >= 0 {
+						m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to insert, because new list entry} @c{'%s'} @R{is detected multiple times}", node, describeEntry(obj, key)))
 						return nil
 					}
 				}
@@ -344,6 +475,12 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 				}
 			}
 
+			// Composite keys need one value per key field to find the modification point
+			if _, err := keyValues(key, name); err != nil {
+				m.Errors.Append(ansi.Errorf("@m{%s}: @R{unable to find specified modification point:} %s", node, err))
+				return nil
+			}
+
 			// Look up the index of the specified insertion point (based on its key/name)
 			idx = getIndexOfEntry(result, key, name)
 			if idx < 0 {
@@ -375,6 +512,37 @@ func (m *Merger) mergeArray(orig []interface{}, n []interface{}, node string) []
 	return result
 }
 
+// checkKeyMergeArrays ensures that both the original and the new list can be
+// merged by the key `key`, without any ambiguous (duplicate) entries. Only
+// explicit (( merge )) and (( merge on KEY )) calls are held to this; the
+// default merge keeps key-merging lists with duplicate names, as it always has.
+func (m *Merger) checkKeyMergeArrays(orig []interface{}, n []interface{}, node string, key string) error {
+	if err := canKeyMergeArray("new", n, node, key); err != nil {
+		return err
+	}
+	if err := canKeyMergeArray("original", orig, node, key); err != nil {
+		return err
+	}
+
+	// duplicates are only ambiguous if there is something to merge them into,
+	// or anything to merge at all
+	if len(orig) == 0 || len(n) == 0 {
+		return nil
+	}
+	if err := uniqueKeyMergeArray("new", n, node, key); err != nil {
+		return err
+	}
+	return uniqueKeyMergeArray("original", orig, node, key)
+}
+
+// replay merges data that an earlier document already merged in back into
+// the result, without treating it as new
+func (m *Merger) replay(orig interface{}, path string) interface{} {
+	m.replaying++
+	defer func() { m.replaying-- }()
+	return m.mergeObj(nil, orig, path)
+}
+
 // The magic which chooses to merge, append, or inline based on the contents of
 // the array
 func (m *Merger) mergeArrayDefault(orig []interface{}, n []interface{}, node string) []interface{} {
@@ -415,7 +583,7 @@ func (m *Merger) mergeArrayInline(orig []interface{}, n []interface{}, node stri
 	for i := range orig {
 		path := fmt.Sprintf("%s.%d", node, i)
 		if i >= len(n) {
-			merged[i] = m.mergeObj(nil, orig[i], path)
+			merged[i] = m.replay(orig[i], path)
 		} else {
 			merged[i] = m.mergeObj(orig[i], n[i], path)
 		}
@@ -441,26 +609,30 @@ func (m *Merger) mergeArrayByKey(orig []interface{}, n []interface{}, node strin
 	newMap := make(map[interface{}]interface{})
 	for _, o := range n {
 		obj := o.(map[interface{}]interface{})
-		newMap[obj[key]] = obj
+		id, _ := entryIdentity(obj, key)
+		newMap[id] = obj
 	}
 	for i, o := range orig {
 		obj := o.(map[interface{}]interface{})
-		path := fmt.Sprintf("%s.%s", node, obj[key])
-		if _, ok := newMap[obj[key]]; ok {
-			merged[i] = m.mergeObj(obj, newMap[obj[key]], path)
-			delete(newMap, obj[key])
+		id, name := entryIdentity(obj, key)
+		path := fmt.Sprintf("%s.%s", node, name)
+		if _, ok := newMap[id]; ok {
+			merged[i] = m.mergeObj(obj, newMap[id], path)
+			delete(newMap, id)
 		} else {
-			merged[i] = m.mergeObj(nil, obj, path)
+			merged[i] = m.replay(obj, path)
 		}
 	}
 
 	i := 0
 	for _, obj := range n {
 		obj := obj.(map[interface{}]interface{})
-		if _, ok := newMap[obj[key]]; ok {
+		id, name := entryIdentity(obj, key)
+		if _, ok := newMap[id]; ok {
 			path := fmt.Sprintf("%s.%d", node, i)
 			DEBUG("%s: appending new data to merged array", path)
 			merged = append(merged, m.mergeObj(nil, obj, path))
+			m.moveOrigins(path, fmt.Sprintf("%s.%s", node, name))
 			i++
 		}
 	}
@@ -468,6 +640,82 @@ func (m *Merger) mergeArrayByKey(orig []interface{}, n []interface{}, node strin
 	return merged
 }
 
+// getMapStrategy returns a copy of the map n without any map-level merge
+// directives, along with the strategy they ask for (or def, if there are
+// none). A `(( replace ))` key replaces the original map entirely, while a
+// `(( merge-strategy ))` key names one of the strategies 'deep' (the
+// default), 'shallow' (only top-level keys are merged, nested maps and arrays
+// are replaced) or 'replace'.
+func getMapStrategy(n map[interface{}]interface{}, node string, def mapStrategy) (map[interface{}]interface{}, mapStrategy, error) {
+	strategy := def
+	var stripped map[interface{}]interface{}
+	directive := ""
+	for k, v := range n {
+		key, isString := k.(string)
+		if !isString {
+			continue
+		}
+
+		if (mapReplaceRx.MatchString(key) || mapMergeStrategyRx.MatchString(key)) && directive != "" {
+			// which one wins would depend on map iteration order
+			first, second := directive, key
+			if second < first {
+				first, second = second, first
+			}
+			return nil, mapStrategyDeep, ansi.Errorf("@m{%s}: @R{cannot have more than one merge directive, but has both} @c{'%s'} @R{and} @c{'%s'}", node, first, second)
+		}
+
+		switch {
+		case mapReplaceRx.MatchString(key):
+			strategy = mapStrategyReplace
+
+		case mapMergeStrategyRx.MatchString(key):
+			name, _ := v.(string)
+			var ok bool
+			if strategy, ok = mapStrategies[name]; !ok {
+				return nil, mapStrategyDeep, ansi.Errorf("@m{%s}: @R{unknown merge strategy} @c{'%v'} @R{- must be one of 'deep', 'shallow' or 'replace'}", node, v)
+			}
+
+		default:
+			continue
+		}
+		directive = key
+
+		if stripped == nil {
+			stripped = make(map[interface{}]interface{}, len(n))
+			for k, v := range n {
+				stripped[k] = v
+			}
+		}
+		delete(stripped, k)
+	}
+
+	if stripped == nil {
+		return n, strategy, nil
+	}
+	DEBUG("%s: found map-level merge directive", node)
+	return stripped, strategy, nil
+}
+
+// clearForMapStrategy removes everything from orig that should not be deep
+// merged with n, according to the merge strategy.
+func clearForMapStrategy(orig map[interface{}]interface{}, n map[interface{}]interface{}, strategy mapStrategy) {
+	for k := range orig {
+		switch strategy {
+		case mapStrategyReplace:
+			DEBUG("  replacing map entry '%v' (as requested by merge directive)", k)
+			delete(orig, k)
+
+		case mapStrategyShallow:
+			switch n[k].(type) {
+			case map[interface{}]interface{}, []interface{}:
+				DEBUG("  replacing map entry '%v' (as requested by shallow merge directive)", k)
+				delete(orig, k)
+			}
+		}
+	}
+}
+
 // getArrayModifications returns a list of ModificationDefinition objects with
 // information on which array operations to apply to which entries. The first
 // object in the returned will always represent the default merge behavior.
@@ -517,6 +765,14 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			result = append(result, ModificationDefinition{listOp: listOpInsert, index: 0})
 			continue
 
+		case appendUniqueRegEx.MatchString(e): // check for (( append unique )) or (( union )), optionally on "key"
+			/* #0 is the whole string,
+			 * #1 contains the optional identifying key
+			 */
+			captures := appendUniqueRegEx.FindStringSubmatch(e)
+			result = append(result, ModificationDefinition{listOp: listOpUnion, key: strings.TrimSpace(captures[1])})
+			continue
+
 		case insertByIdxRegEx.MatchString(e): // check for (( insert ... <idx> ))
 			/* #0 is the whole string,
 			 * #1 is after or before
@@ -539,7 +795,7 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			 */
 			if captures := insertByNameRegEx.FindStringSubmatch(entry.(string)); len(captures) == 4 {
 				relative := strings.TrimSpace(captures[1])
-				key := strings.TrimSpace(captures[2])
+				key := strings.Join(keyFields(captures[2]), ",")
 				name := strings.TrimSpace(captures[3])
 
 				if key == "" {
@@ -568,7 +824,7 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			 * #2 is finally the target "<name>" string
 			 */
 			if captures := deleteByNameRegEx.FindStringSubmatch(e); len(captures) == 3 {
-				key := strings.TrimSpace(captures[1])
+				key := strings.Join(keyFields(captures[1]), ",")
 				name := strings.TrimSpace(captures[2])
 
 				// illegal state for simple lists, if you have a text with whitespaces, we want to enforce people using quotes
@@ -590,7 +846,7 @@ func getArrayModifications(obj []interface{}, simpleList bool) []ModificationDef
 			 * #2 is finally the target "<name>" string
 			 */
 			if captures := deleteByNameUnquotedRegEx.FindStringSubmatch(e); len(captures) == 3 {
-				key := strings.TrimSpace(captures[1])
+				key := strings.Join(keyFields(captures[1]), ",")
 				name := strings.TrimSpace(captures[2])
 
 				// illegal state for simple lists, if you have a text with whitespaces, we want to enforce people using quotes
@@ -656,9 +912,94 @@ func shouldKeyMergeArray(obj []interface{}) (bool, string) {
 	return false, ""
 }
 
+// keyFields splits an identifier key like `name,az` into its fields. Each
+// field may be a dotted path into the entry, like `metadata.name`.
+func keyFields(key string) []string {
+	fields := []string{}
+	for _, f := range strings.Split(key, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// keyFieldValue looks up a single identifier key field in obj. Fields that
+// exist verbatim win over dotted paths, so keys that contain a literal dot
+// keep working.
+func keyFieldValue(obj map[interface{}]interface{}, field string) (interface{}, bool) {
+	if v, ok := obj[field]; ok {
+		return v, true
+	}
+	if !strings.Contains(field, ".") {
+		return nil, false
+	}
+
+	var v interface{} = obj
+	for _, part := range strings.Split(field, ".") {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// entryIdentity returns a comparable value identifying obj by the given
+// identifier key, along with a human-readable name for it. For single-field
+// keys, the identity is the value of that field itself.
+func entryIdentity(obj map[interface{}]interface{}, key string) (interface{}, string) {
+	fields := keyFields(key)
+	if len(fields) == 1 {
+		v, _ := keyFieldValue(obj, fields[0])
+		return v, fmt.Sprintf("%v", v)
+	}
+
+	ids := make([]string, len(fields))
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		v, _ := keyFieldValue(obj, f)
+		ids[i] = fmt.Sprintf("%T:%v", v, v)
+		names[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(ids, "\x00"), strings.Join(names, ",")
+}
+
+// describeEntry renders the identifier key values of obj for error messages,
+// i.e. `name: web` or `name: web, az: z1`.
+func describeEntry(obj map[interface{}]interface{}, key string) string {
+	parts := []string{}
+	for _, f := range keyFields(key) {
+		v, _ := keyFieldValue(obj, f)
+		parts = append(parts, fmt.Sprintf("%s: %v", f, v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keyValues splits the name given to (( insert )) or (( delete )) into one
+// value per identifier key field. Names for single-field keys are never split.
+func keyValues(key string, name string) ([]string, error) {
+	fields := keyFields(key)
+	if len(fields) == 1 {
+		return []string{name}, nil
+	}
+
+	values := strings.Split(name, ",")
+	if len(values) != len(fields) {
+		return nil, fmt.Errorf("'%s' does not have one value for each of the %d fields of key '%s'", name, len(fields), key)
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values, nil
+}
+
 func canKeyMergeArray(disp string, array []interface{}, node string, key string) error {
 	// ensure that all elements of `array` are maps,
-	// and that they contain the key `key`
+	// and that they contain every field of the key `key`
 
 	for i, o := range array {
 		if o == nil {
@@ -669,17 +1010,35 @@ func canKeyMergeArray(disp string, array []interface{}, node string, key string)
 		}
 
 		obj := o.(map[interface{}]interface{})
-		if _, ok := obj[key]; !ok {
-			return ansi.Errorf("@m{%s.%d}: @R{%s object does not contain the key} @c{'%s'}@R{ - cannot merge by key}", node, i, disp, key)
+		for _, field := range keyFields(key) {
+			targetValue, ok := keyFieldValue(obj, field)
+			if !ok {
+				return ansi.Errorf("@m{%s.%d}: @R{%s object does not contain the key} @c{'%s'}@R{ - cannot merge by key}", node, i, disp, field)
+			}
+
+			//Verify that the target key has a hashable value (i.e. a value that is not itself a hash or sequence)
+			_, isMap := targetValue.(map[interface{}]interface{})
+			_, isSlice := targetValue.([]interface{})
+			if isMap || isSlice {
+				return NewWarningError(eContextDefaultMerge, ansi.Sprintf("@m{%s.%d}: @R{%s object's key} @c{'%s'} @R{cannot have a value which is a hash or sequence - cannot merge by key}", node, i, disp, field))
+			}
 		}
+	}
+	return nil
+}
 
-		//Verify that the target key has a hashable value (i.e. a value that is not itself a hash or sequence)
-		targetValue := obj[key]
-		_, isMap := targetValue.(map[interface{}]interface{})
-		_, isSlice := targetValue.([]interface{})
-		if isMap || isSlice {
-			return NewWarningError(eContextDefaultMerge, ansi.Sprintf("@m{%s.%d}: @R{%s object's key} @c{'%s'} @R{cannot have a value which is a hash or sequence - cannot merge by key}", node, i, disp, key))
+// uniqueKeyMergeArray ensures that no two entries of `array` share the same
+// value(s) for the key `key`, since there would be no telling which of them
+// to merge with. It expects canKeyMergeArray to have passed.
+func uniqueKeyMergeArray(disp string, array []interface{}, node string, key string) error {
+	seen := map[interface{}]int{}
+	for i, o := range array {
+		obj := o.(map[interface{}]interface{})
+		id, _ := entryIdentity(obj, key)
+		if j, ok := seen[id]; ok {
+			return NewWarningError(eContextDefaultMerge, ansi.Sprintf("@m{%s.%d}: @R{%s object} @c{'%s'} @R{is a duplicate of} @m{%s.%d} @R{- cannot merge by key}", node, i, disp, describeEntry(obj, key), node, j))
 		}
+		seen[id] = i
 	}
 	return nil
 }
@@ -697,13 +1056,31 @@ func getIndexOfSimpleEntry(list []interface{}, name string) int {
 }
 
 func getIndexOfEntry(list []interface{}, key string, name string) int {
+	values, err := keyValues(key, name)
+	if err != nil {
+		return -1
+	}
+	return indexOfEntry(list, keyFields(key), values)
+}
+
+func indexOfEntry(list []interface{}, fields []string, values []string) int {
 	for i, entry := range list {
-		if reflect.TypeOf(entry).Kind() == reflect.Map {
-			obj := entry.(map[interface{}]interface{})
-			if obj[key] == name {
-				return i
+		obj, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		found := true
+		for j, field := range fields {
+			v, ok := keyFieldValue(obj, field)
+			if !ok || fmt.Sprintf("%v", v) != values[j] {
+				found = false
+				break
 			}
 		}
+		if found {
+			return i
+		}
 	}
 
 	return -1
@@ -0,0 +1,147 @@
+package spruce
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// MergeRule tells the Merger how to merge the data at every path matching
+// Path, when the overlay being merged in does not say so itself with an
+// inline array operator or map directive.
+//
+// Path is a dotted path, where `*` matches any single key (or array entry),
+// `**` matches any number of keys, and the usual shell wildcards can be used
+// within a key. Strategy is one of:
+//
+//   - `merge` or `merge on KEY` - key-merge arrays
+//   - `inline`, `append`, `prepend` - merge arrays by index, or add to them
+//   - `append unique` or `union` - add to arrays, skipping entries already there
+//   - `deep` or `shallow` - merge maps recursively, or only their top level
+//   - `replace` - replace arrays or maps wholesale
+//   - `error` - refuse to let a later file override the data at all
+type MergeRule struct {
+	Path     string `yaml:"path"`
+	Strategy string `yaml:"strategy"`
+}
+
+// MergeRules is an ordered list of rules; the first one to match wins.
+type MergeRules []MergeRule
+
+// MergeRulesConfig is the structure of the file given to LoadMergeRules
+type MergeRulesConfig struct {
+	Rules MergeRules `yaml:"rules"`
+}
+
+// LoadMergeRules reads the merge rules declared in the given YAML file.
+func LoadMergeRules(file string) (MergeRules, error) {
+	b, err := os.ReadFile(file) // #nosec G304 -- user-specified file path is core CLI functionality
+	if err != nil {
+		return nil, ansi.Errorf("@R{Error reading merge rules} @m{%s}: %s", file, err)
+	}
+
+	var cfg MergeRulesConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, ansi.Errorf("@m{%s}: @R{unable to parse merge rules}: %s", file, err)
+	}
+
+	errors := MultiError{Errors: []error{}}
+	for i := range cfg.Rules {
+		if err := cfg.Rules[i].compile(); err != nil {
+			errors.Append(ansi.Errorf("@m{%s}: @R{rule #%d:} %s", file, i, err))
+		}
+	}
+	if len(errors.Errors) > 0 {
+		return nil, errors
+	}
+	return cfg.Rules, nil
+}
+
+func (r *MergeRule) compile() error {
+	r.Path = strings.TrimPrefix(strings.TrimSpace(r.Path), "$.")
+	r.Strategy = strings.TrimSpace(r.Strategy)
+	if r.Path == "" {
+		return fmt.Errorf("no path given")
+	}
+
+	for _, pattern := range strings.Split(r.Path, ".") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid path '%s': %s", r.Path, err)
+		}
+	}
+
+	if _, ok := mapStrategies[r.Strategy]; ok || r.Strategy == "error" {
+		return nil
+	}
+	if mods := getArrayModifications([]interface{}{r.directive()}, false); len(mods) == 2 {
+		switch op := mods[1]; op.listOp {
+		case listOpMergeOnKey, listOpMergeInline, listOpUnion:
+			return nil
+		case listOpInsert:
+			if op.relative == "" && op.key == "" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unknown merge strategy '%s' for path '%s'", r.Strategy, r.Path)
+}
+
+// directive returns the inline array operator equivalent to the rule
+func (r *MergeRule) directive() string {
+	return fmt.Sprintf("(( %s ))", r.Strategy)
+}
+
+// matches returns true if the rule's path glob matches the given node path
+// (with or without the leading `$.`)
+func (r *MergeRule) matches(node string) bool {
+	return matchPathGlob(r.Path, node)
+}
+
+// matchPathGlob returns true if the dotted path glob (see MergeRule) matches
+// the given node path
+func matchPathGlob(glob string, node string) bool {
+	glob = strings.TrimPrefix(glob, "$.")
+	node = strings.TrimPrefix(strings.TrimPrefix(node, "$"), ".")
+	if glob == "" || node == "" {
+		return false
+	}
+	return globMatch(strings.Split(glob, "."), strings.Split(node, "."))
+}
+
+func globMatch(glob []string, nodes []string) bool {
+	if len(glob) == 0 {
+		return len(nodes) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(nodes); i++ {
+			if globMatch(glob[1:], nodes[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(nodes) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(glob[0], nodes[0]); !ok {
+		return false
+	}
+	return globMatch(glob[1:], nodes[1:])
+}
+
+// match returns the first rule matching the node path, or nil
+func (rules MergeRules) match(node string) *MergeRule {
+	for i := range rules {
+		if rules[i].matches(node) {
+			DEBUG("%s: using merge strategy '%s' from merge rule for '%s'", node, rules[i].Strategy, rules[i].Path)
+			return &rules[i]
+		}
+	}
+	return nil
+}
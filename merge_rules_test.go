@@ -0,0 +1,198 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Merge rules", func() {
+	rule := func(path, strategy string) MergeRule {
+		r := MergeRule{Path: path, Strategy: strategy}
+		Expect(r.compile()).To(Succeed())
+		return r
+	}
+
+	Describe("path globs", func() {
+		It("matches literal paths, with or without the leading $", func() {
+			r := rule("properties.tls", "replace")
+			Expect(r.matches("$.properties.tls")).To(BeTrue())
+			Expect(r.matches("properties.tls")).To(BeTrue())
+			Expect(r.matches("$.properties")).To(BeFalse())
+			Expect(r.matches("$.properties.tls.cert")).To(BeFalse())
+		})
+
+		It("matches any single key with *", func() {
+			r := rule("instance_groups.*.jobs", "append")
+			Expect(r.matches("$.instance_groups.web.jobs")).To(BeTrue())
+			Expect(r.matches("$.instance_groups.0.jobs")).To(BeTrue())
+			Expect(r.matches("$.instance_groups.jobs")).To(BeFalse())
+		})
+
+		It("matches any number of keys with **", func() {
+			r := rule("**.tags", "append")
+			Expect(r.matches("$.tags")).To(BeTrue())
+			Expect(r.matches("$.a.b.c.tags")).To(BeTrue())
+			Expect(r.matches("$.a.b.c")).To(BeFalse())
+		})
+
+		It("matches shell wildcards within keys", func() {
+			r := rule("meta.vault_*", "error")
+			Expect(r.matches("$.meta.vault_prefix")).To(BeTrue())
+			Expect(r.matches("$.meta.prefix")).To(BeFalse())
+		})
+
+		It("uses the first matching rule", func() {
+			rules := MergeRules{rule("a.b", "replace"), rule("a.*", "append")}
+			Expect(rules.match("$.a.b").Strategy).To(Equal("replace"))
+			Expect(rules.match("$.a.c").Strategy).To(Equal("append"))
+			Expect(rules.match("$.c")).To(BeNil())
+		})
+	})
+
+	Describe("strategies", func() {
+		It("accepts array, map and error strategies", func() {
+			for _, s := range []string{"merge", "merge on id", "merge on name,az", "inline", "append", "prepend", "append unique", "union on id", "replace", "deep", "shallow", "error"} {
+				r := MergeRule{Path: "x", Strategy: s}
+				Expect(r.compile()).To(Succeed(), s)
+			}
+		})
+
+		It("rejects anything else", func() {
+			for _, s := range []string{"", "sideways", "delete 0", "insert after 1"} {
+				r := MergeRule{Path: "x", Strategy: s}
+				Expect(r.compile()).NotTo(Succeed(), s)
+			}
+			r := MergeRule{Strategy: "append"}
+			Expect(r.compile()).To(MatchError("no path given"))
+		})
+	})
+
+	Describe("Merger", func() {
+		merge := func(rules MergeRules, docs ...map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+			m := &Merger{Rules: rules}
+			root := map[interface{}]interface{}{}
+			for _, doc := range docs {
+				m.Merge(root, doc) // #nosec G104 -- errors collected via m.Error() after loop
+			}
+			return root, m.Error()
+		}
+
+		It("key-merges arrays as the rule says, without inline operators", func() {
+			merged, err := merge(MergeRules{rule("list", "merge on id")},
+				map[interface{}]interface{}{"list": []interface{}{
+					map[interface{}]interface{}{"id": "a", "v": 1},
+					map[interface{}]interface{}{"id": "b", "v": 1},
+				}},
+				map[interface{}]interface{}{"list": []interface{}{
+					map[interface{}]interface{}{"id": "b", "v": 2},
+				}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["list"]).To(Equal([]interface{}{
+				map[interface{}]interface{}{"id": "a", "v": 1},
+				map[interface{}]interface{}{"id": "b", "v": 2},
+			}))
+		})
+
+		It("appends to arrays as the rule says", func() {
+			merged, err := merge(MergeRules{rule("groups.*.jobs", "append")},
+				map[interface{}]interface{}{"groups": []interface{}{
+					map[interface{}]interface{}{"name": "web", "jobs": []interface{}{"nginx"}},
+				}},
+				map[interface{}]interface{}{"groups": []interface{}{
+					map[interface{}]interface{}{"name": "web", "jobs": []interface{}{"metrics"}},
+				}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["groups"]).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "web", "jobs": []interface{}{"nginx", "metrics"}},
+			}))
+		})
+
+		It("lets inline array operators win over rules", func() {
+			merged, err := merge(MergeRules{rule("list", "append")},
+				map[interface{}]interface{}{"list": []interface{}{"a", "b"}},
+				map[interface{}]interface{}{"list": []interface{}{"(( prepend ))", "c"}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["list"]).To(Equal([]interface{}{"c", "a", "b"}))
+		})
+
+		It("replaces or shallow-merges maps as the rule says", func() {
+			merged, err := merge(MergeRules{rule("tls", "replace"), rule("config", "shallow")},
+				map[interface{}]interface{}{
+					"tls":    map[interface{}]interface{}{"cert": "old", "key": "old"},
+					"config": map[interface{}]interface{}{"a": 1, "nested": map[interface{}]interface{}{"x": 1, "y": 1}},
+				},
+				map[interface{}]interface{}{
+					"tls":    map[interface{}]interface{}{"cert": "new"},
+					"config": map[interface{}]interface{}{"nested": map[interface{}]interface{}{"x": 2}},
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["tls"]).To(Equal(map[interface{}]interface{}{"cert": "new"}))
+			Expect(merged["config"]).To(Equal(map[interface{}]interface{}{"a": 1, "nested": map[interface{}]interface{}{"x": 2}}))
+		})
+
+		It("lets map-level directives win over rules", func() {
+			merged, err := merge(MergeRules{rule("tls", "replace")},
+				map[interface{}]interface{}{"tls": map[interface{}]interface{}{"cert": "old", "key": "old"}},
+				map[interface{}]interface{}{"tls": map[interface{}]interface{}{"(( merge-strategy ))": "deep", "cert": "new"}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["tls"]).To(Equal(map[interface{}]interface{}{"cert": "new", "key": "old"}))
+		})
+
+		It("refuses to let later files override paths with an error rule", func() {
+			_, err := merge(MergeRules{rule("meta.pinned", "error")},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"pinned": "v1"}},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"other": "ok"}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = merge(MergeRules{rule("meta.pinned", "error")},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"pinned": "v1"}},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"pinned": "v2"}},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.meta.pinned: cannot be overridden, according to the merge rule for meta.pinned"))
+		})
+
+		It("throws an error when a strategy does not fit the data", func() {
+			_, err := merge(MergeRules{rule("tls", "append")},
+				map[interface{}]interface{}{"tls": map[interface{}]interface{}{"cert": "old"}},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.tls: merge strategy 'append' from the merge rule for tls cannot be applied to a map"))
+
+			_, err = merge(MergeRules{rule("list", "shallow")},
+				map[interface{}]interface{}{"list": []interface{}{"a"}},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.list: merge strategy 'shallow' from the merge rule for list cannot be applied to an array"))
+		})
+	})
+
+	Describe("LoadMergeRules", func() {
+		It("loads rules in order", func() {
+			rules, err := LoadMergeRules("assets/merge-rules/rules.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(4))
+			Expect(rules[0].Path).To(Equal("instance_groups"))
+			Expect(rules[0].Strategy).To(Equal("merge on name,az"))
+			Expect(rules.match("$.instance_groups.web.jobs").Strategy).To(Equal("append"))
+		})
+
+		It("reports bad rules", func() {
+			_, err := LoadMergeRules("assets/merge-rules/bad-rules.yml")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("rule #0: unknown merge strategy 'sideways' for path 'instance_groups'"))
+		})
+
+		It("reports missing files", func() {
+			_, err := LoadMergeRules("assets/merge-rules/nonexistent.yml")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error reading merge rules"))
+		})
+	})
+})
@@ -0,0 +1,375 @@
+package spruce
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// MergeMode selects the semantics the Merger uses to merge documents
+type MergeMode int
+
+const (
+	// MergeModeSpruce is spruce's own merge semantics, with array operators
+	MergeModeSpruce MergeMode = iota
+	// MergeModeStrategic follows the semantics of Kubernetes' strategic
+	// merge patches, including their `$patch`, `$retainKeys`,
+	// `$setElementOrder` and `$deleteFromPrimitiveList` directives
+	MergeModeStrategic
+)
+
+// ParseMergeMode returns the MergeMode of the given name
+func ParseMergeMode(s string) (MergeMode, error) {
+	switch strings.ToLower(s) {
+	case "", "spruce":
+		return MergeModeSpruce, nil
+	case "strategic":
+		return MergeModeStrategic, nil
+	}
+	return MergeModeSpruce, fmt.Errorf("unknown merge mode '%s' (expected one of spruce or strategic)", s)
+}
+
+// strategicDeletion is returned in place of a map whose patch asked for it
+// to be deleted with `$patch: delete`
+type strategicDeletion struct{}
+
+// strategicListKey is the patch merge key of a well-known list. An empty key
+// merges primitive lists as sets.
+type strategicListKey struct {
+	kinds []string
+	path  string
+	key   string
+}
+
+// strategicListKeys is the table of patch merge keys for the lists of the
+// core resource kinds. Lists that are not in the table (and have no merge
+// rule) are replaced, as Kubernetes does.
+var strategicListKeys = []strategicListKey{
+	{path: "metadata.finalizers"},
+	{path: "metadata.ownerReferences", key: "uid"},
+	{path: "status.conditions", key: "type"},
+	{path: "spec.ports", key: "port", kinds: []string{"Service"}},
+	{path: "**.containers", key: "name"},
+	{path: "**.initContainers", key: "name"},
+	{path: "**.ephemeralContainers", key: "name"},
+	{path: "**.containers.*.ports", key: "containerPort"},
+	{path: "**.initContainers.*.ports", key: "containerPort"},
+	{path: "**.ephemeralContainers.*.ports", key: "containerPort"},
+	{path: "**.env", key: "name"},
+	{path: "**.volumeMounts", key: "mountPath"},
+	{path: "**.volumeDevices", key: "devicePath"},
+	{path: "**.volumes", key: "name"},
+	{path: "**.imagePullSecrets", key: "name"},
+	{path: "**.hostAliases", key: "ip"},
+	{path: "**.resourceClaims", key: "name"},
+	{path: "**.topologySpreadConstraints", key: "topologyKey,whenUnsatisfiable"},
+}
+
+// strategicListKey returns the patch merge key of the list at node, from the
+// merge rules or the built-in table, and whether the list is merged at all
+func (m *Merger) strategicListKey(node string) (string, bool) {
+	if rule := m.Rules.match(node); rule != nil {
+		mods := getArrayModifications([]interface{}{rule.directive()}, false)
+		if len(mods) == 2 && mods[1].listOp == listOpMergeOnKey {
+			if mods[1].key == "" {
+				return getDefaultIdentifierKey(), true
+			}
+			return mods[1].key, true
+		}
+	}
+
+	for _, l := range strategicListKeys {
+		if len(l.kinds) > 0 && !containsString(l.kinds, m.kind) {
+			continue
+		}
+		if matchPathGlob(l.path, node) {
+			return l.key, true
+		}
+	}
+	return "", false
+}
+
+func containsString(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeStrategic merges n into orig at node, as a strategic merge patch
+func (m *Merger) mergeStrategic(orig interface{}, n interface{}, node string) interface{} {
+	switch t := n.(type) {
+	case map[interface{}]interface{}:
+		o, isMap := orig.(map[interface{}]interface{})
+		if !isMap {
+			if orig != nil {
+				m.recordOverride(orig, t, node)
+			}
+			o = map[interface{}]interface{}{}
+		}
+		return m.mergeStrategicMap(o, t, node)
+
+	case []interface{}:
+		o, isList := orig.([]interface{})
+		if !isList && orig != nil {
+			m.recordOverride(orig, t, node)
+		}
+		return m.mergeStrategicList(o, t, node)
+
+	default:
+		m.recordOverride(orig, t, node)
+		return t
+	}
+}
+
+// mergeStrategicMap merges the patch into orig (in place), returning either
+// orig or strategicDeletion{}
+func (m *Merger) mergeStrategicMap(orig map[interface{}]interface{}, patch map[interface{}]interface{}, node string) interface{} {
+	switch p := patch["$patch"]; p {
+	case nil, "merge":
+	case "delete":
+		DEBUG("%s: deleting map (as requested by $patch: delete)", node)
+		return strategicDeletion{}
+	case "replace":
+		DEBUG("%s: replacing map (as requested by $patch: replace)", node)
+		for k := range orig {
+			delete(orig, k)
+		}
+	default:
+		m.Errors.Append(ansi.Errorf("@m{%s}: @R{unknown} @c{$patch} @R{directive} @c{'%v'} @R{- must be one of 'merge', 'replace' or 'delete'}", node, p))
+		return orig
+	}
+
+	for k, v := range patch {
+		if key, _ := k.(string); strings.HasPrefix(key, "$") {
+			continue
+		}
+
+		path := fmt.Sprintf("%s.%v", node, k)
+		_, exists := orig[k]
+		// the first document is the base, not a patch, so its nulls stay
+		if v == nil && (exists || m.docs > 1) {
+			DEBUG("%s: deleting key (patch value is null)", path)
+			delete(orig, k)
+			continue
+		}
+
+		if !exists {
+			if err := m.newKeyForbidden(path); err != nil {
+				m.Errors.Append(err)
+				continue
+			}
+		}
+		merged := m.mergeObj(orig[k], v, path)
+		if _, deleted := merged.(strategicDeletion); deleted {
+			delete(orig, k)
+			continue
+		}
+		orig[k] = merged
+	}
+
+	// the remaining directives apply to the merged result
+	for k, v := range patch {
+		key, _ := k.(string)
+		switch {
+		case strings.HasPrefix(key, "$deleteFromPrimitiveList/"):
+			field := strings.TrimPrefix(key, "$deleteFromPrimitiveList/")
+			if list, ok := orig[field].([]interface{}); ok {
+				orig[field] = deleteFromList(list, v)
+			}
+
+		case strings.HasPrefix(key, "$setElementOrder/"):
+			field := strings.TrimPrefix(key, "$setElementOrder/")
+			if list, ok := orig[field].([]interface{}); ok {
+				order, _ := v.([]interface{})
+				key, _ := m.strategicListKey(fmt.Sprintf("%s.%s", node, field))
+				orig[field] = orderList(list, order, key)
+			}
+		}
+	}
+
+	if retain, ok := patch["$retainKeys"]; ok {
+		keep, isList := retain.([]interface{})
+		if !isList {
+			m.Errors.Append(ansi.Errorf("@m{%s}: @c{$retainKeys} @R{must be a list of keys}", node))
+			return orig
+		}
+		for k := range orig {
+			if !containsValue(keep, k) {
+				DEBUG("%s.%v: deleting key (not in $retainKeys)", node, k)
+				delete(orig, k)
+			}
+		}
+	}
+
+	return orig
+}
+
+// mergeStrategicList merges the patch into orig, by the patch merge key of
+// the list if it has one, and by replacing it otherwise
+func (m *Merger) mergeStrategicList(orig []interface{}, patch []interface{}, node string) interface{} {
+	// spruce array operators, and merge rules other than key merges, win
+	if mods := getArrayModifications(patch, isSimpleList(orig)); len(mods) > 1 {
+		return m.mergeArray(orig, patch, node)
+	}
+	if rule := m.Rules.match(node); rule != nil && rule.Strategy != "error" {
+		if mods := getArrayModifications([]interface{}{rule.directive()}, false); len(mods) != 2 || mods[1].listOp != listOpMergeOnKey {
+			return m.mergeArray(orig, patch, node)
+		}
+	}
+	key, keyed := m.strategicListKey(node)
+
+	// a {$patch: replace} entry replaces the list with the rest of the patch
+	replace := false
+	entries := []interface{}{}
+	for _, e := range patch {
+		if obj, ok := e.(map[interface{}]interface{}); ok && len(obj) == 1 && obj["$patch"] == "replace" {
+			replace = true
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if replace || !keyed {
+		DEBUG("%s: replacing list", node)
+		if orig != nil {
+			m.recordOverride(orig, entries, node)
+		}
+		result := []interface{}{}
+		for i, e := range entries {
+			merged := m.mergeObj(nil, e, fmt.Sprintf("%s.%d", node, i))
+			if _, deleted := merged.(strategicDeletion); !deleted {
+				result = append(result, merged)
+			}
+		}
+		return result
+	}
+
+	result := make([]interface{}, len(orig))
+	copy(result, orig)
+
+	if key == "" {
+		DEBUG("%s: merging primitive list as a set", node)
+		for _, e := range entries {
+			if !containsValue(result, e) {
+				result = append(result, e)
+			}
+		}
+		return result
+	}
+
+	DEBUG("%s: merging list on patch merge key '%s'", node, key)
+	for i, e := range entries {
+		obj, isMap := e.(map[interface{}]interface{})
+		if !isMap {
+			m.Errors.Append(ansi.Errorf("@m{%s.%d}: @R{list entry is not a map - cannot merge on patch merge key} @c{'%s'}", node, i, key))
+			return orig
+		}
+		for _, field := range keyFields(key) {
+			v, ok := keyFieldValue(obj, field)
+			if !ok {
+				m.Errors.Append(ansi.Errorf("@m{%s.%d}: @R{list entry does not contain the patch merge key} @c{'%s'}", node, i, field))
+				return orig
+			}
+			switch v.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				m.Errors.Append(ansi.Errorf("@m{%s.%d}: @R{the patch merge key} @c{'%s'} @R{cannot have a value which is a hash or sequence}", node, i, field))
+				return orig
+			}
+		}
+
+		id, name := entryIdentity(obj, key)
+		path := fmt.Sprintf("%s.%s", node, name)
+		idx := -1
+		for j, r := range result {
+			if robj, ok := r.(map[interface{}]interface{}); ok {
+				if rid, _ := entryIdentity(robj, key); rid == id {
+					idx = j
+					break
+				}
+			}
+		}
+
+		var merged interface{}
+		if idx >= 0 {
+			merged = m.mergeObj(result[idx], obj, path)
+		} else {
+			merged = m.mergeObj(nil, obj, path)
+		}
+		if _, deleted := merged.(strategicDeletion); deleted {
+			if idx >= 0 {
+				DEBUG("%s: deleting list entry (as requested by $patch: delete)", path)
+				result = deleteIndexFromList(result, idx)
+			}
+			continue
+		}
+		if idx >= 0 {
+			result[idx] = merged
+		} else {
+			result = append(result, merged)
+		}
+	}
+	return result
+}
+
+func containsValue(l []interface{}, v interface{}) bool {
+	for _, x := range l {
+		if reflect.DeepEqual(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteFromList removes every value in del (a list) from the list
+func deleteFromList(list []interface{}, del interface{}) []interface{} {
+	values, _ := del.([]interface{})
+	result := []interface{}{}
+	for _, e := range list {
+		if !containsValue(values, e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// orderList orders the entries of the list as they appear in order, which
+// holds either primitive values or maps with just the merge key of each
+// entry. Entries that do not appear in order keep their relative positions,
+// after all the ones that do.
+func orderList(list []interface{}, order []interface{}, key string) []interface{} {
+	position := func(e interface{}) int {
+		for i, o := range order {
+			if key == "" {
+				if reflect.DeepEqual(e, o) {
+					return i
+				}
+				continue
+			}
+			eobj, eok := e.(map[interface{}]interface{})
+			oobj, ook := o.(map[interface{}]interface{})
+			if eok && ook {
+				eid, _ := entryIdentity(eobj, key)
+				oid, _ := entryIdentity(oobj, key)
+				if eid == oid {
+					return i
+				}
+			}
+		}
+		return len(order)
+	}
+
+	result := make([]interface{}, len(list))
+	copy(result, list)
+	sort.SliceStable(result, func(i, j int) bool {
+		return position(result[i]) < position(result[j])
+	})
+	return result
+}
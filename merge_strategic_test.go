@@ -0,0 +1,269 @@
+package spruce
+
+import (
+	"github.com/geofffranks/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategic merging", func() {
+	doc := func(s string) map[interface{}]interface{} {
+		var m map[interface{}]interface{}
+		Expect(yaml.Unmarshal([]byte(s), &m)).To(Succeed())
+		return m
+	}
+
+	merge := func(m *Merger, docs ...string) (map[interface{}]interface{}, error) {
+		m.Mode = MergeModeStrategic
+		root := map[interface{}]interface{}{}
+		for _, d := range docs {
+			m.Merge(root, doc(d)) // #nosec G104 -- errors collected via m.Error() after loop
+		}
+		return root, m.Error()
+	}
+
+	deployment := `
+kind: Deployment
+metadata:
+  name: web
+  finalizers: [a, b]
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1
+        ports:
+        - containerPort: 80
+          name: http
+        env:
+        - name: LOG_LEVEL
+          value: info
+        - name: MODE
+          value: prod
+      - name: sidecar
+        image: sidecar:1
+      tolerations:
+      - key: a
+      - key: b
+`
+
+	containers := func(root map[interface{}]interface{}) []interface{} {
+		spec := root["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		return spec["containers"].([]interface{})
+	}
+
+	It("merges containers by name, and their ports and env by merge key", func() {
+		root, err := merge(&Merger{}, deployment, `
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:2
+        ports:
+        - containerPort: 80
+          protocol: TCP
+        - containerPort: 443
+        env:
+        - name: LOG_LEVEL
+          value: debug
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers(root)).To(Equal(doc(`
+l:
+- name: app
+  image: app:2
+  ports:
+  - containerPort: 80
+    name: http
+    protocol: TCP
+  - containerPort: 443
+  env:
+  - name: LOG_LEVEL
+    value: debug
+  - name: MODE
+    value: prod
+- name: sidecar
+  image: sidecar:1
+`)["l"]))
+	})
+
+	It("replaces lists without a patch merge key", func() {
+		root, err := merge(&Merger{}, deployment, `
+spec:
+  template:
+    spec:
+      tolerations:
+      - key: c
+`)
+		Expect(err).NotTo(HaveOccurred())
+		spec := root["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		Expect(spec["tolerations"]).To(Equal([]interface{}{map[interface{}]interface{}{"key": "c"}}))
+	})
+
+	It("merges finalizers as a set, and honors $deleteFromPrimitiveList", func() {
+		root, err := merge(&Merger{}, deployment, `
+metadata:
+  finalizers: [b, c]
+  $deleteFromPrimitiveList/finalizers: [a]
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["metadata"].(map[interface{}]interface{})["finalizers"]).To(Equal([]interface{}{"b", "c"}))
+	})
+
+	It("deletes keys set to null, and list entries and maps marked with $patch: delete", func() {
+		root, err := merge(&Merger{}, deployment, `
+metadata:
+  name: ~
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        $patch: delete
+      - name: app
+        env:
+        - name: MODE
+          $patch: delete
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["metadata"]).NotTo(HaveKey("name"))
+		Expect(containers(root)).To(HaveLen(1))
+		app := containers(root)[0].(map[interface{}]interface{})
+		Expect(app["env"]).To(HaveLen(1))
+
+		root, err = merge(&Merger{}, deployment, `
+metadata:
+  $patch: delete
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root).NotTo(HaveKey("metadata"))
+	})
+
+	It("keeps the nulls of the first document", func() {
+		root, err := merge(&Merger{}, `
+metadata:
+  name: web
+  creationTimestamp: ~
+`, `
+metadata:
+  labels:
+    app: web
+    tier: ~
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["metadata"]).To(HaveKeyWithValue("creationTimestamp", BeNil()))
+		Expect(root["metadata"]).To(HaveKeyWithValue("labels", map[interface{}]interface{}{"app": "web"}))
+	})
+
+	It("replaces maps and lists marked with $patch: replace", func() {
+		root, err := merge(&Merger{}, deployment, `
+metadata:
+  $patch: replace
+  name: api
+spec:
+  template:
+    spec:
+      containers:
+      - $patch: replace
+      - name: only
+        image: only:1
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["metadata"]).To(Equal(map[interface{}]interface{}{"name": "api"}))
+		Expect(containers(root)).To(Equal([]interface{}{
+			map[interface{}]interface{}{"name": "only", "image": "only:1"},
+		}))
+	})
+
+	It("honors $retainKeys and $setElementOrder", func() {
+		root, err := merge(&Merger{}, deployment, `
+spec:
+  template:
+    spec:
+      $retainKeys: [containers]
+      $setElementOrder/containers:
+      - name: sidecar
+      - name: app
+`)
+		Expect(err).NotTo(HaveOccurred())
+		spec := root["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		Expect(spec).NotTo(HaveKey("tolerations"))
+		Expect(containers(root)[0].(map[interface{}]interface{})["name"]).To(Equal("sidecar"))
+		Expect(containers(root)[1].(map[interface{}]interface{})["name"]).To(Equal("app"))
+	})
+
+	It("only merges spec.ports by port for Services", func() {
+		service := `
+kind: Service
+spec:
+  ports:
+  - port: 80
+    name: http
+`
+		root, err := merge(&Merger{}, service, "spec: {ports: [{port: 80, targetPort: 8080}]}")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["spec"].(map[interface{}]interface{})["ports"]).To(Equal([]interface{}{
+			map[interface{}]interface{}{"port": 80, "name": "http", "targetPort": 8080},
+		}))
+
+		root, err = merge(&Merger{}, "kind: Other\n"+service[len("\nkind: Service\n"):], "spec: {ports: [{port: 80, targetPort: 8080}]}")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root["spec"].(map[interface{}]interface{})["ports"]).To(Equal([]interface{}{
+			map[interface{}]interface{}{"port": 80, "targetPort": 8080},
+		}))
+	})
+
+	It("lets merge rules override the built-in patch merge keys", func() {
+		rules := MergeRules{{Path: "**.containers", Strategy: "append"}}
+		Expect(rules[0].compile()).To(Succeed())
+		root, err := merge(&Merger{Rules: rules}, deployment, `
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:2
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers(root)).To(HaveLen(3))
+	})
+
+	It("still supports spruce array operators", func() {
+		root, err := merge(&Merger{}, deployment, `
+spec:
+  template:
+    spec:
+      tolerations:
+      - (( append ))
+      - key: c
+`)
+		Expect(err).NotTo(HaveOccurred())
+		spec := root["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+		Expect(spec["tolerations"]).To(HaveLen(3))
+	})
+
+	It("reports entries without the patch merge key, and bad directives", func() {
+		_, err := merge(&Merger{}, deployment, `
+spec:
+  template:
+    spec:
+      containers:
+      - image: nameless
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("$.spec.template.spec.containers.0: list entry does not contain the patch merge key 'name'"))
+
+		_, err = merge(&Merger{}, deployment, "metadata: {$patch: remove}")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("$.metadata: unknown $patch directive 'remove'"))
+	})
+
+	It("parses merge mode names", func() {
+		Expect(ParseMergeMode("")).To(Equal(MergeModeSpruce))
+		Expect(ParseMergeMode("Strategic")).To(Equal(MergeModeStrategic))
+		_, err := ParseMergeMode("json")
+		Expect(err).To(MatchError("unknown merge mode 'json' (expected one of spruce or strategic)"))
+	})
+})
@@ -0,0 +1,133 @@
+package spruce
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+)
+
+var (
+	// strictTypes regexes
+	strictOperatorRx = regexp.MustCompile(`^\s*\Q((\E.*\Q))\E\s*$`)
+
+	// recordOverride regexes
+	overrideParamRx = regexp.MustCompile(`^\s*\Q((\E\s*param\s`)
+)
+
+// Override records a value that a later document replaced, for
+// Merger.ReportOverrides
+type Override struct {
+	Path string
+	From string
+	To   string
+}
+
+// String describes the override, as in `meta.size: set in a.yml, overridden by b.yml`
+func (o Override) String() string {
+	if o.From == "" {
+		return fmt.Sprintf("%s: overridden by %s", o.Path, o.To)
+	}
+	return fmt.Sprintf("%s: set in %s, overridden by %s", o.Path, o.From, o.To)
+}
+
+// SortedOverrides returns the overrides recorded so far, ordered by path
+// (and then by the order they happened in)
+func (m *Merger) SortedOverrides() []Override {
+	l := make([]Override, len(m.Overrides))
+	copy(l, m.Overrides)
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Path < l[j].Path
+	})
+	return l
+}
+
+// newKeyForbidden returns an error if documents after the first are not
+// allowed to add the key at path, according to Merger.NoNewKeys
+func (m *Merger) newKeyForbidden(path string) error {
+	if m.docs <= 1 || m.adding > 0 {
+		return nil
+	}
+	for _, glob := range m.NoNewKeys {
+		if matchPathGlob(glob, path) {
+			return ansi.Errorf("@m{%s}: @R{is not an existing key, and new keys are not allowed under} @c{%s}", path, glob)
+		}
+	}
+	return nil
+}
+
+// mergeKind names the kind of data v is, for Merger.StrictTypes. Nulls and
+// operator calls can stand in for any kind of data, so they have none.
+func mergeKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case map[interface{}]interface{}:
+		return "map"
+	case []interface{}:
+		return "list"
+	case string:
+		if strictOperatorRx.MatchString(v) {
+			return ""
+		}
+	}
+	return "scalar"
+}
+
+// strictTypes returns an error if replacing orig with n would change the kind
+// of data at node, according to Merger.StrictTypes
+func (m *Merger) strictTypes(orig interface{}, n interface{}, node string) error {
+	if !m.StrictTypes {
+		return nil
+	}
+	a, b := mergeKind(orig), mergeKind(n)
+	if a != "" && b != "" && a != b {
+		return ansi.Errorf("@m{%s}: @R{refusing to replace a} @c{%s} @R{with a} @c{%s}", node, a, b)
+	}
+	return nil
+}
+
+// recordOverride remembers which document set the value at node, and records
+// an Override if it replaces a different value set by an earlier document
+func (m *Merger) recordOverride(orig interface{}, n interface{}, node string) {
+	if !m.ReportOverrides || m.replaying > 0 {
+		return
+	}
+	if m.origins == nil {
+		m.origins = map[string]string{}
+	}
+
+	if s, ok := orig.(string); ok && overrideParamRx.MatchString(s) {
+		orig = nil // (( param )) asks to be overridden
+	}
+	if orig != nil && m.adding == 0 && !reflect.DeepEqual(orig, n) {
+		m.Overrides = append(m.Overrides, Override{
+			Path: strings.TrimPrefix(node, "$."),
+			From: m.origins[node],
+			To:   m.Source,
+		})
+	}
+	m.origins[node] = m.Source
+}
+
+// moveOrigins moves the origins recorded under the path from to the path
+// to, since key-merged entries are appended under their index, but merged
+// under their identifier by later documents
+func (m *Merger) moveOrigins(from string, to string) {
+	if from == to {
+		return
+	}
+	moved := map[string]string{}
+	for path, source := range m.origins {
+		if path == from || strings.HasPrefix(path, from+".") {
+			delete(m.origins, path)
+			moved[to+strings.TrimPrefix(path, from)] = source
+		}
+	}
+	for path, source := range moved {
+		m.origins[path] = source
+	}
+}
@@ -0,0 +1,173 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strict merging", func() {
+	var (
+		base    map[interface{}]interface{}
+		overlay map[interface{}]interface{}
+	)
+
+	merge := func(m *Merger, docs ...map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+		root := map[interface{}]interface{}{}
+		for i, doc := range docs {
+			m.Source = []string{"base.yml", "overlay.yml", "third.yml"}[i]
+			m.Merge(root, doc) // #nosec G104 -- errors collected via m.Error() after loop
+		}
+		return root, m.Error()
+	}
+
+	BeforeEach(func() {
+		base = map[interface{}]interface{}{
+			"properties": map[interface{}]interface{}{
+				"port": 443,
+				"tls":  map[interface{}]interface{}{"cert": "CERT"},
+			},
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"name": "web", "instances": 1},
+			},
+			"zones": []interface{}{"z1"},
+		}
+		overlay = map[interface{}]interface{}{
+			"properties": map[interface{}]interface{}{
+				"port":       8443,
+				"propertise": "typo",
+			},
+		}
+	})
+
+	Context("with NoNewKeys", func() {
+		It("refuses new keys under the given paths in later documents", func() {
+			_, err := merge(&Merger{NoNewKeys: []string{"properties.**"}}, base, overlay)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.properties.propertise: is not an existing key, and new keys are not allowed under properties.**"))
+		})
+
+		It("still allows overriding existing keys", func() {
+			delete(overlay["properties"].(map[interface{}]interface{}), "propertise")
+			merged, err := merge(&Merger{NoNewKeys: []string{"properties.**"}}, base, overlay)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["properties"].(map[interface{}]interface{})["port"]).To(Equal(8443))
+		})
+
+		It("allows new keys elsewhere, and anything in the first document", func() {
+			_, err := merge(&Merger{NoNewKeys: []string{"meta.*"}}, base, overlay)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("only reports the topmost new key", func() {
+			overlay = map[interface{}]interface{}{
+				"properties": map[interface{}]interface{}{
+					"new": map[interface{}]interface{}{"nested": "value"},
+				},
+			}
+			_, err := merge(&Merger{NoNewKeys: []string{"**"}}, base, overlay)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(MultiError).Errors).To(HaveLen(1))
+			Expect(err.Error()).To(ContainSubstring("$.properties.new: is not an existing key"))
+		})
+
+		It("checks keys of existing array entries, but not new entries", func() {
+			overlay = map[interface{}]interface{}{
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "db", "instances": 1},
+					map[interface{}]interface{}{"name": "web", "instnaces": 2},
+				},
+			}
+			_, err := merge(&Merger{NoNewKeys: []string{"jobs.**"}}, base, overlay)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(MultiError).Errors).To(HaveLen(1))
+			Expect(err.Error()).To(ContainSubstring("$.jobs.web.instnaces: is not an existing key"))
+		})
+	})
+
+	Context("with StrictTypes", func() {
+		It("refuses to replace a list with a map", func() {
+			_, err := merge(&Merger{StrictTypes: true}, base, map[interface{}]interface{}{
+				"zones": map[interface{}]interface{}{"z1": nil},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.zones: refusing to replace a list with a map"))
+		})
+
+		It("refuses to replace a map with a scalar", func() {
+			_, err := merge(&Merger{StrictTypes: true}, base, map[interface{}]interface{}{
+				"properties": map[interface{}]interface{}{"tls": "none"},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.properties.tls: refusing to replace a map with a scalar"))
+		})
+
+		It("allows scalars of different types, nulls and operators", func() {
+			_, err := merge(&Merger{StrictTypes: true}, base, map[interface{}]interface{}{
+				"properties": map[interface{}]interface{}{
+					"port": "8443",
+					"tls":  "(( grab meta.tls ))",
+				},
+				"zones": nil,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows anything without StrictTypes", func() {
+			_, err := merge(&Merger{}, base, map[interface{}]interface{}{
+				"zones": map[interface{}]interface{}{"z1": nil},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with ReportOverrides", func() {
+		It("records the values that later documents changed, and where they came from", func() {
+			third := map[interface{}]interface{}{
+				"properties": map[interface{}]interface{}{"port": 9443},
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "web", "instances": 3},
+				},
+			}
+			m := &Merger{ReportOverrides: true}
+			_, err := merge(m, base, overlay, third)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.SortedOverrides()).To(Equal([]Override{
+				{Path: "jobs.web.instances", From: "base.yml", To: "third.yml"},
+				{Path: "properties.port", From: "base.yml", To: "overlay.yml"},
+				{Path: "properties.port", From: "overlay.yml", To: "third.yml"},
+			}))
+			Expect(m.SortedOverrides()[1].String()).To(Equal("properties.port: set in base.yml, overridden by overlay.yml"))
+		})
+
+		It("reports changes to appended entries under their identifier", func() {
+			overlay = map[interface{}]interface{}{
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "db", "instances": 1},
+				},
+			}
+			third := map[interface{}]interface{}{
+				"jobs": []interface{}{
+					map[interface{}]interface{}{"name": "db", "instances": 2},
+				},
+			}
+			m := &Merger{ReportOverrides: true}
+			_, err := merge(m, base, overlay, third)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.SortedOverrides()).To(Equal([]Override{
+				{Path: "jobs.db.instances", From: "overlay.yml", To: "third.yml"},
+			}))
+		})
+
+		It("does not report values that stay the same, or (( param ))s", func() {
+			base["meta"] = map[interface{}]interface{}{"name": "(( param \"need a name\" ))"}
+			overlay = map[interface{}]interface{}{
+				"meta":       map[interface{}]interface{}{"name": "prod"},
+				"properties": map[interface{}]interface{}{"port": 443},
+			}
+			m := &Merger{ReportOverrides: true}
+			_, err := merge(m, base, overlay)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Overrides).To(BeEmpty())
+		})
+	})
+})
@@ -214,6 +214,35 @@ var _ = Describe("Should recognize string patterns for", func() {
 		}
 	})
 
+	Context("(( append unique )) and (( union ))", func() {
+		cases := map[string]string{
+			"(( append unique ))":       "",
+			"((append   unique))":       "",
+			"(( union ))":               "",
+			"(( union on id ))":         "id",
+			"(( append unique on id ))": "id",
+			"(( unique ))":              "-",
+			"(( append uniquely ))":     "-",
+			"(( unionize ))":            "-",
+		}
+		for input, key := range cases {
+			input, key := input, key
+			Context(fmt.Sprintf("with case %s", input), func() {
+				It("matches correctly", func() {
+					results := getArrayModifications([]interface{}{input}, false)
+					if key != "-" {
+						Expect(results).To(HaveLen(2))
+						Expect(results[1].listOp).To(Equal(listOpUnion))
+						Expect(results[1].key).To(Equal(key))
+					} else {
+						Expect(results).To(HaveLen(1))
+						Expect(shouldBeDefault(results[0])).To(BeTrue())
+					}
+				})
+			})
+		}
+	})
+
 	Context("(( prepend ))", func() {
 		cases := map[string]bool{
 			"(( prepend ))":          true,
@@ -523,6 +552,23 @@ var _ = Describe("Passing a map to m.mergeObj merges as a map", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("node-path.map: inappropriate use of (( merge )) operator outside of a list (this is spruce, after all)"))
 	})
+	It("refers to entries appended by a key merge by their index", func() {
+		orig := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"name": "web"},
+			},
+		}
+		n := map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"name": "db", "map": "(( merge ))"},
+			},
+		}
+		m := &Merger{}
+		m.mergeObj(orig, n, "node-path")
+		err := m.Error()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("node-path.jobs.0.map: inappropriate use of (( merge )) operator"))
+	})
 })
 
 var _ = Describe("Passing a slice to m.mergeObj", func() {
@@ -705,6 +751,48 @@ var _ = Describe("m.mergeArray", func() {
 		Expect(a).To(Equal(expect))
 		Expect(err).NotTo(HaveOccurred())
 	})
+	It("with initial element '(( append unique ))' appends only new data, in first-seen order", func() {
+		orig := []interface{}{"z1", "z2", "z1"}
+		array := []interface{}{"(( append unique ))", "z3", "z2", "z3"}
+		expect := []interface{}{"z1", "z2", "z3"}
+
+		m := &Merger{}
+		a := m.mergeArray(orig, array, "node-path")
+		err := m.Error()
+		Expect(a).To(Equal(expect))
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("with initial element '(( union on id ))' skips maps whose identifier is already there", func() {
+		orig := []interface{}{
+			map[interface{}]interface{}{"id": "ca1", "pem": "OLD"},
+		}
+		array := []interface{}{
+			"(( union on id ))",
+			map[interface{}]interface{}{"id": "ca1", "pem": "NEW"},
+			map[interface{}]interface{}{"id": "ca2", "pem": "CA2"},
+		}
+		expect := []interface{}{
+			map[interface{}]interface{}{"id": "ca1", "pem": "OLD"},
+			map[interface{}]interface{}{"id": "ca2", "pem": "CA2"},
+		}
+
+		m := &Merger{}
+		a := m.mergeArray(orig, array, "node-path")
+		err := m.Error()
+		Expect(a).To(Equal(expect))
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("with '(( union ))' after '(( prepend ))' combines both", func() {
+		orig := []interface{}{"b", "c"}
+		array := []interface{}{"(( prepend ))", "a", "(( union ))", "c", "d"}
+		expect := []interface{}{"a", "b", "c", "d"}
+
+		m := &Merger{}
+		a := m.mergeArray(orig, array, "node-path")
+		err := m.Error()
+		Expect(a).To(Equal(expect))
+		Expect(err).NotTo(HaveOccurred())
+	})
 
 	Context("with initial element '(( inline ))'", func() {
 		It("and len(orig) == len(new)", func() {
@@ -2113,6 +2201,280 @@ var _ = Describe("m.mergeArray", func() {
 			Expect(err.Error()).To(ContainSubstring("original object does not contain the key"))
 		})
 	})
+
+	Context("with composite and nested identifier keys", func() {
+		var orig []interface{}
+		BeforeEach(func() {
+			orig = []interface{}{
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 1},
+				map[interface{}]interface{}{"name": "web", "az": "z2", "instances": 1},
+				map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 1},
+			}
+		})
+
+		It("merges on all fields of a composite key", func() {
+			array := []interface{}{
+				"(( merge on name,az ))",
+				map[interface{}]interface{}{"name": "web", "az": "z2", "instances": 3},
+				map[interface{}]interface{}{"name": "db", "az": "z2", "instances": 2},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 1},
+				map[interface{}]interface{}{"name": "web", "az": "z2", "instances": 3},
+				map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 1},
+				map[interface{}]interface{}{"name": "db", "az": "z2", "instances": 2},
+			}))
+		})
+
+		It("allows whitespace between the fields of a composite key", func() {
+			array := []interface{}{
+				"(( merge on name, az ))",
+				map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 5},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(HaveLen(3))
+			Expect(a[2]).To(Equal(map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 5}))
+		})
+
+		It("merges on nested key paths", func() {
+			orig := []interface{}{
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "a"}, "spec": "old"},
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "b"}, "spec": "old"},
+			}
+			array := []interface{}{
+				"(( merge on metadata.name ))",
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "b"}, "spec": "new"},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "a"}, "spec": "old"},
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "b"}, "spec": "new"},
+			}))
+		})
+
+		It("prefers keys that literally contain a dot over nested key paths", func() {
+			orig := []interface{}{
+				map[interface{}]interface{}{"a.b": "x", "v": 1},
+			}
+			array := []interface{}{
+				"(( merge on a.b ))",
+				map[interface{}]interface{}{"a.b": "x", "v": 2},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"a.b": "x", "v": 2},
+			}))
+		})
+
+		It("throws an error when a nested key path is missing", func() {
+			array := []interface{}{
+				"(( merge on metadata.name ))",
+				map[interface{}]interface{}{"metadata": map[interface{}]interface{}{"name": "a"}},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(a).To(BeNil())
+			Expect(m.Error()).To(HaveOccurred())
+			Expect(m.Error().Error()).To(ContainSubstring("node-path.0: original object does not contain the key 'metadata.name' - cannot merge by key"))
+		})
+
+		It("throws an error on duplicate composite keys in the new list", func() {
+			array := []interface{}{
+				"(( merge on name,az ))",
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 2},
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 3},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(a).To(BeNil())
+			Expect(m.Error()).To(HaveOccurred())
+			Expect(m.Error().Error()).To(ContainSubstring("node-path.1: new object 'name: web, az: z1' is a duplicate of node-path.0 - cannot merge by key"))
+		})
+
+		It("throws an error on duplicate keys in the original list", func() {
+			array := []interface{}{
+				"(( merge on name ))",
+				map[interface{}]interface{}{"name": "web", "instances": 2},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(a).To(BeNil())
+			Expect(m.Error()).To(HaveOccurred())
+			Expect(m.Error().Error()).To(ContainSubstring("node-path.1: original object 'name: web' is a duplicate of node-path.0 - cannot merge by key"))
+		})
+
+		It("does not mind duplicate keys when there is nothing to merge them into", func() {
+			array := []interface{}{
+				map[interface{}]interface{}{"name": "a", "v": 1},
+				map[interface{}]interface{}{"name": "a", "v": 0},
+			}
+
+			m := &Merger{}
+			Expect(m.checkKeyMergeArrays([]interface{}{}, array, "node-path", "name")).To(Succeed())
+			a := m.mergeArray([]interface{}{}, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal(array))
+		})
+
+		It("still merges by key by default when the original list has duplicate keys", func() {
+			orig := []interface{}{
+				map[interface{}]interface{}{"name": "a", "v": 1},
+				map[interface{}]interface{}{"name": "a", "v": 2},
+				map[interface{}]interface{}{"name": "b", "v": 3},
+			}
+			array := []interface{}{
+				map[interface{}]interface{}{"name": "b", "v": 30},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "a", "v": 1},
+				map[interface{}]interface{}{"name": "a", "v": 2},
+				map[interface{}]interface{}{"name": "b", "v": 30},
+			}))
+		})
+
+		It("still merges by key by default when the new list has duplicate keys", func() {
+			orig := []interface{}{
+				map[interface{}]interface{}{"name": "a", "v": 1},
+				map[interface{}]interface{}{"name": "b", "v": 3},
+			}
+			array := []interface{}{
+				map[interface{}]interface{}{"name": "b", "v": 30},
+				map[interface{}]interface{}{"name": "b", "v": 31},
+				map[interface{}]interface{}{"name": "c", "v": 4},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "a", "v": 1},
+				map[interface{}]interface{}{"name": "b", "v": 31},
+				map[interface{}]interface{}{"name": "c", "v": 4},
+			}))
+		})
+
+		It("does not mind duplicate keys when nothing is merged by key", func() {
+			array := []interface{}{
+				"(( append ))",
+				map[interface{}]interface{}{"name": "web", "az": "z3"},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(HaveLen(4))
+		})
+
+		It("inserts after an entry identified by a composite key", func() {
+			array := []interface{}{
+				"(( insert after name,az \"web,z1\" ))",
+				map[interface{}]interface{}{"name": "api", "az": "z1"},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(HaveLen(4))
+			Expect(a[1]).To(Equal(map[interface{}]interface{}{"name": "api", "az": "z1"}))
+		})
+
+		It("refuses to insert an entry whose composite key already exists", func() {
+			array := []interface{}{
+				"(( insert before name,az \"db,z1\" ))",
+				map[interface{}]interface{}{"name": "web", "az": "z1"},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(a).To(BeNil())
+			Expect(m.Error()).To(HaveOccurred())
+			Expect(m.Error().Error()).To(ContainSubstring("unable to insert, because new list entry 'name: web, az: z1' is detected multiple times"))
+		})
+
+		It("deletes an entry identified by a composite key", func() {
+			array := []interface{}{
+				"(( delete name,az web,z2 ))",
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 1},
+				map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 1},
+			}))
+		})
+
+		It("allows whitespace in composite keys and values of delete and insert", func() {
+			array := []interface{}{
+				"(( delete name, az \"web, z2\" ))",
+				"(( insert after name, az \"web, z1\" ))",
+				map[interface{}]interface{}{"name": "api", "az": "z1"},
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(m.Error()).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "web", "az": "z1", "instances": 1},
+				map[interface{}]interface{}{"name": "api", "az": "z1"},
+				map[interface{}]interface{}{"name": "db", "az": "z1", "instances": 1},
+			}))
+		})
+
+		It("throws an error when not given one value per key field", func() {
+			array := []interface{}{
+				"(( delete name,az \"web\" ))",
+			}
+
+			m := &Merger{}
+			a := m.mergeArray(orig, array, "node-path")
+			Expect(a).To(BeNil())
+			Expect(m.Error()).To(HaveOccurred())
+			Expect(m.Error().Error()).To(ContainSubstring("'web' does not have one value for each of the 2 fields of key 'name,az'"))
+		})
+
+		Context("when DEFAULT_ARRAY_MERGE_KEY is a composite key", func() {
+			BeforeEach(func() {
+				os.Setenv("DEFAULT_ARRAY_MERGE_KEY", "name,az")
+			})
+			AfterEach(func() {
+				os.Setenv("DEFAULT_ARRAY_MERGE_KEY", "")
+			})
+
+			It("merges on it by default", func() {
+				array := []interface{}{
+					map[interface{}]interface{}{"name": "web", "az": "z2", "instances": 4},
+				}
+
+				m := &Merger{}
+				o := m.mergeObj(orig, array, "node-path")
+				Expect(m.Error()).NotTo(HaveOccurred())
+				Expect(o).To(HaveLen(3))
+				Expect(o.([]interface{})[1]).To(Equal(map[interface{}]interface{}{"name": "web", "az": "z2", "instances": 4}))
+			})
+		})
+	})
 })
 
 var _ = Describe("Merge()", func() {
@@ -2244,4 +2606,169 @@ top_replace:
 		valueIs(merged, "nested.replace.0", "two")
 		valueIs(merged, "top_replace.0", "b")
 	})
+
+	Context("with map-level merge directives", func() {
+		var base map[interface{}]interface{}
+		BeforeEach(func() {
+			base = YAML(`properties:
+  tls:
+    cert: OLD CERT
+    key: OLD KEY
+    ca: OLD CA
+  other: untouched
+`)
+		})
+
+		It("deep merges maps by default", func() {
+			merged, err := Merge(base, YAML(`properties:
+  tls:
+    cert: NEW CERT
+`))
+			Expect(err).NotTo(HaveOccurred())
+			valueIs(merged, "properties.tls.cert", "NEW CERT")
+			valueIs(merged, "properties.tls.key", "OLD KEY")
+		})
+
+		It("replaces a map with a (( replace )) key", func() {
+			merged, err := Merge(base, YAML(`properties:
+  tls:
+    (( replace )): ~
+    cert: NEW CERT
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["properties"].(map[interface{}]interface{})["tls"]).To(Equal(map[interface{}]interface{}{
+				"cert": "NEW CERT",
+			}))
+			valueIs(merged, "properties.other", "untouched")
+		})
+
+		It("replaces a map with (( merge-strategy )): replace", func() {
+			merged, err := Merge(base, YAML(`properties:
+  tls:
+    (( merge-strategy )): replace
+    key: NEW KEY
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["properties"].(map[interface{}]interface{})["tls"]).To(Equal(map[interface{}]interface{}{
+				"key": "NEW KEY",
+			}))
+		})
+
+		It("only merges the top-level keys of a map with (( merge-strategy )): shallow", func() {
+			merged, err := Merge(YAML(`config:
+  name: old
+  limits:
+    cpu: 1
+    memory: 2G
+  tags: [a, b]
+`), YAML(`config:
+  (( merge-strategy )): shallow
+  limits:
+    cpu: 2
+  tags: [c]
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["config"]).To(Equal(map[interface{}]interface{}{
+				"name":   "old",
+				"limits": map[interface{}]interface{}{"cpu": 2},
+				"tags":   []interface{}{"c"},
+			}))
+		})
+
+		It("deep merges with (( merge-strategy )): deep", func() {
+			merged, err := Merge(base, YAML(`properties:
+  (( merge-strategy )): deep
+  tls:
+    ca: NEW CA
+`))
+			Expect(err).NotTo(HaveOccurred())
+			valueIs(merged, "properties.tls.ca", "NEW CA")
+			valueIs(merged, "properties.tls.cert", "OLD CERT")
+		})
+
+		It("strips directives from maps that did not exist before", func() {
+			merged, err := Merge(base, YAML(`properties:
+  new:
+    (( replace )): ~
+    nested:
+      (( merge-strategy )): shallow
+      key: value
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["properties"].(map[interface{}]interface{})["new"]).To(Equal(map[interface{}]interface{}{
+				"nested": map[interface{}]interface{}{"key": "value"},
+			}))
+		})
+
+		It("strips directives from maps that replace non-map values", func() {
+			merged, err := Merge(base, YAML(`properties:
+  other:
+    (( replace )): ~
+    key: value
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["properties"].(map[interface{}]interface{})["other"]).To(Equal(map[interface{}]interface{}{
+				"key": "value",
+			}))
+		})
+
+		It("applies directives to entries of key-merged arrays", func() {
+			merged, err := Merge(YAML(`jobs:
+- name: web
+  properties:
+    a: 1
+    b: 2
+`), YAML(`jobs:
+- name: web
+  properties:
+    (( replace )): ~
+    c: 3
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged["jobs"]).To(Equal([]interface{}{
+				map[interface{}]interface{}{
+					"name":       "web",
+					"properties": map[interface{}]interface{}{"c": 3},
+				},
+			}))
+		})
+
+		It("applies directives to the root document", func() {
+			merged, err := Merge(base, YAML(`(( replace )): ~
+fresh: start
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged).To(Equal(map[interface{}]interface{}{"fresh": "start"}))
+		})
+
+		It("leaves the overlay untouched", func() {
+			overlay := YAML(`properties:
+  tls:
+    (( replace )): ~
+    cert: NEW CERT
+`)
+			_, err := Merge(base, overlay)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(overlay["properties"].(map[interface{}]interface{})["tls"]).To(HaveKey("(( replace ))"))
+		})
+
+		It("throws an error on maps with more than one merge directive", func() {
+			_, err := Merge(base, YAML(`properties:
+  tls:
+    (( replace )): ~
+    (( merge-strategy )): shallow
+`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.properties.tls: cannot have more than one merge directive, but has both '(( merge-strategy ))' and '(( replace ))'"))
+		})
+
+		It("throws an error on unknown merge strategies", func() {
+			_, err := Merge(base, YAML(`properties:
+  tls:
+    (( merge-strategy )): sideways
+`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("$.properties.tls: unknown merge strategy 'sideways' - must be one of 'deep', 'shallow' or 'replace'"))
+		})
+	})
 })
@@ -29,60 +29,74 @@ func (Base64Operator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, au
 	return auto
 }
 
-// Run ...
-func (Base64Operator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
-	DEBUG("running (( base64 ... )) operation at $.%s", ev.Here)
-	defer DEBUG("done with (( base64 ... )) operation at $%s\n", ev.Here)
-
-	if len(args) != 1 {
-		return nil, fmt.Errorf("base64 operator requires exactly one string or reference argument")
-	}
-
-	var contents string
-
-	arg := args[0]
-	i := 0
-	v, err := arg.Resolve(ev.Tree)
-	if err != nil {
-		DEBUG("  arg[%d]: failed to resolve expression to a concrete value", i)
-		DEBUG("     [%d]: error was: %s", i, err)
-		return nil, err
-	}
-
-	switch v.Type {
-	case Literal:
-		DEBUG("  arg[%d]: using string literal '%v'", i, v.Literal)
-		DEBUG("     [%d]: appending '%v' to resultant string", i, v.Literal)
-		if fmt.Sprintf("%T", v.Literal) != "string" {
-			return nil, ansi.Errorf("@R{tried to base64 encode} @c{%v}@R{, which is not a string scalar}", v.Literal)
+// encodingArgs resolves the string arguments of the encoding operators
+// (base64, sha256, hex, etc.), which must each be a string literal, or a
+// reference to a string.  The verb describes what the operator does with
+// them, for error messages (i.e. "base64 encode").
+func encodingArgs(ev *Evaluator, name string, verb string, args []*Expr, n int) ([]string, error) {
+	if len(args) != n {
+		if n == 1 {
+			return nil, fmt.Errorf("%s operator requires exactly one string or reference argument", name)
 		}
-		contents = fmt.Sprintf("%v", v.Literal)
+		return nil, fmt.Errorf("%s operator requires exactly %d string or reference arguments", name, n)
+	}
 
-	case Reference:
-		DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
-		s, err := v.Reference.Resolve(ev.Tree)
+	strs := []string{}
+	for i, arg := range args {
+		v, err := arg.Resolve(ev.Tree)
 		if err != nil {
-			DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
-			return nil, fmt.Errorf("unable to resolve `%s`: %s", v.Reference, err)
+			DEBUG("  arg[%d]: failed to resolve expression to a concrete value", i)
+			DEBUG("     [%d]: error was: %s", i, err)
+			return nil, err
 		}
 
-		switch s.(type) {
-		case string:
-			DEBUG("     [%d]: appending '%s' to resultant string", i, s)
-			contents = fmt.Sprintf("%v", s)
+		switch v.Type {
+		case Literal:
+			DEBUG("  arg[%d]: using string literal '%v'", i, v.Literal)
+			s, ok := v.Literal.(string)
+			if !ok {
+				return nil, ansi.Errorf("@R{tried to %s} @c{%v}@R{, which is not a string scalar}", verb, v.Literal)
+			}
+			strs = append(strs, s)
+
+		case Reference:
+			DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
+			s, err := v.Reference.Resolve(ev.Tree)
+			if err != nil {
+				DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
+				return nil, fmt.Errorf("unable to resolve `%s`: %s", v.Reference, err)
+			}
+
+			switch s := s.(type) {
+			case string:
+				DEBUG("     [%d]: using string '%s'", i, s)
+				strs = append(strs, s)
+
+			default:
+				DEBUG("  arg[%d]: %v is not a string scalar", i, s)
+				return nil, ansi.Errorf("@R{tried to %s} @c{%v}@R{, which is not a string scalar}", verb, v.Reference)
+			}
 
 		default:
-			DEBUG("  arg[%d]: %v is not a string scalar", i, s)
-			return nil, ansi.Errorf("@R{tried to base64 encode} @c{%v}@R{, which is not a string scalar}", v.Reference)
+			DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
+			return nil, fmt.Errorf("%s operator only accepts string literals and key reference argument", name)
 		}
+		DEBUG("")
+	}
+	return strs, nil
+}
 
-	default:
-		DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
-		return nil, fmt.Errorf("base64 operator only accepts string literals and key reference argument")
+// Run ...
+func (Base64Operator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( base64 ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( base64 ... )) operation at $%s\n", ev.Here)
+
+	strs, err := encodingArgs(ev, "base64", "base64 encode", args, 1)
+	if err != nil {
+		return nil, err
 	}
-	DEBUG("")
 
-	encoded := base64.StdEncoding.EncodeToString([]byte(contents))
+	encoded := base64.StdEncoding.EncodeToString([]byte(strs[0]))
 	DEBUG("  resolved (( base64 ... )) operation to the string:\n    \"%s\"", string(encoded))
 
 	return &Response{
@@ -1,6 +1,8 @@
 package spruce
 
 import (
+	"math"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -26,4 +28,173 @@ var _ = Describe("CalcOperator", func() {
 		err := ev.RunPhase(EvalPhase)
 		Expect(err).To(HaveOccurred())
 	})
+
+	Describe("expressions", func() {
+		calc := func(expr string) (interface{}, error) {
+			ev := &Evaluator{Tree: evalYAML(`
+meta:
+  a:
+    b: 1
+    bc: 2
+  big: 9007199254740993
+  half: 0.5
+  name: web
+  env: prod
+  list: [a, b, c]
+  net: 10.0.0.0/24
+  custom-extras: 3
+`)}
+			e, err := ParseCalc(expr)
+			if err != nil {
+				return nil, err
+			}
+			return e.Evaluate(ev.Tree)
+		}
+		is := func(expr string, expected interface{}) {
+			v, err := calc(expr)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred(), expr)
+			ExpectWithOffset(1, v).To(Equal(expected), expr)
+		}
+
+		It("treats references as tokens, not substrings", func() {
+			is("meta.a.b + meta.a.bc", int64(3))
+			is("meta.a.bc*10+meta.a.b", int64(21))
+			is("meta.custom-extras - 1", int64(2))
+		})
+
+		It("keeps integers as integers", func() {
+			is("meta.big + 1", int64(9007199254740994))
+			is("9223372036854775807.0 + 1", 9.223372036854775808e18)
+			is("7 / 2", 3.5)
+			is("8 / 2", int64(4))
+			is("2 ** 62", int64(4611686018427387904))
+			is("meta.half * 4", int64(2))
+		})
+
+		It("reports integer overflow", func() {
+			for _, expr := range []string{
+				"1 << 70",
+				"1 << 63",
+				"3 << 62",
+				"9223372036854775807 + 1",
+				"-9223372036854775807 - 2",
+				"4294967296 * 4294967296",
+				"2 ** 63",
+				"2 ** 100",
+			} {
+				_, err := calc(expr)
+				Expect(err).To(HaveOccurred(), expr)
+				Expect(err.Error()).To(ContainSubstring("integer overflow"), expr)
+			}
+			is("-1 << 63", int64(math.MinInt64))
+			is("0 << 70", int64(0))
+			is("1 << 62", int64(4611686018427387904))
+			is("(-1) ** 101", int64(-1))
+			is("2 ** -1", 0.5)
+		})
+
+		It("supports integer division and modulo", func() {
+			is("7 // 2", int64(3))
+			is("-7 // 2", int64(-3))
+			is("7 % 3", int64(1))
+			is("7.5 // 2", int64(3))
+			is("7.5 % 2", 1.5)
+
+			_, err := calc("1 // 0")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("division by zero"))
+		})
+
+		It("supports bitwise operators", func() {
+			is("0xf0 | 0x0f", int64(255))
+			is("12 & 10", int64(8))
+			is("12 ^ 10", int64(6))
+			is("1 << 10", int64(1024))
+			is("1024 >> 3", int64(128))
+			is("~0", int64(-1))
+
+			_, err := calc("1.5 & 1")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("follows operator precedence", func() {
+			is("1 + 2 * 3", int64(7))
+			is("(1 + 2) * 3", int64(9))
+			is("-2 ** 2", int64(-4))
+			is("2 ** 3 ** 2", int64(512))
+			is("1 | 2 == 3", true)
+			is("1 + 1 << 2", int64(8))
+		})
+
+		It("compares strings and numbers", func() {
+			is("meta.env == 'prod'", true)
+			is(`meta.name != "web"`, false)
+			is("'abc' < 'abd'", true)
+			is("meta.a.b == 1.0", true)
+			is("meta.env == 1", false)
+			is("meta.name + '-' + meta.env", "web-prod")
+			is("meta.env =~ '^pr'", true)
+			is("meta.env !~ '^pr'", false)
+
+			_, err := calc("meta.env < 1")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot compare"))
+		})
+
+		It("supports boolean logic and conditionals", func() {
+			is("meta.env == 'prod' && len(meta.list) > 2", true)
+			is("meta.env == 'dev' || !(meta.a.b > 1)", true)
+			is("meta.env == 'prod' ? 3 : 1", int64(3))
+			is("meta.env == 'dev' ? 3 : meta.a.bc", int64(2))
+
+			_, err := calc("1 && true")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("has functions for lengths and networks", func() {
+			is("len(meta.list)", int64(3))
+			is("len(meta.a)", int64(2))
+			is("len('héllo')", int64(5))
+			is("cidr_size(meta.net)", int64(256))
+			is("cidr_size('fd00::/120')", int64(256))
+			is("cidr_host(meta.net, 5)", "10.0.0.5")
+			is("cidr_host(meta.net, -2)", "10.0.0.254")
+			is("cidr_host('fd00::/64', 16)", "fd00::10")
+
+			_, err := calc("cidr_host(meta.net, 256)")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("prefix of 24 does not accommodate a host numbered 256"))
+		})
+
+		It("keeps integer results from the built-in functions", func() {
+			is("max(meta.a.b, meta.a.bc)", int64(2))
+			is("pow(2, 10)", int64(1024))
+			is("mod(10, 4)", int64(2))
+			is("min(1, 0.5)", 0.5)
+		})
+
+		It("rejects malformed expressions", func() {
+			for _, expr := range []string{"1 +", "(1", "1 2", "max(1,", "'open", "1 @ 2", "0x"} {
+				_, err := calc(expr)
+				Expect(err).To(HaveOccurred(), expr)
+			}
+			_, err := calc("nope(1)")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown calc function nope"))
+		})
+	})
+
+	It("depends on exactly the references in the expression", func() {
+		ev := &Evaluator{Tree: evalYAML(`
+meta:
+  a: (( calc "meta.ab + 1" ))
+  ab: (( grab meta.x ))
+  x: 4
+top: 2
+result: (( calc "meta.a * top" ))
+`)}
+		err := ev.RunPhase(EvalPhase)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ev.Tree["result"]).To(Equal(int64(10)))
+	})
 })
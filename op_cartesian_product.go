@@ -59,50 +59,52 @@ func (CartesianProductOperator) Run(ev *Evaluator, args []*Expr) (*Response, err
 			return nil, err
 		}
 
+		var s interface{}
 		switch v.Type {
 		case Literal:
-			DEBUG("  arg[%d]: found string literal '%s'", i, v.Literal)
-			vals = append(vals, []string{v.Literal.(string)})
+			DEBUG("  arg[%d]: found literal '%v'", i, v.Literal)
+			s = v.Literal
 
 		case Reference:
 			DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
-			s, err := v.Reference.Resolve(ev.Tree)
+			s, err = v.Reference.Resolve(ev.Tree)
 			if err != nil {
 				DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
 				return nil, ansi.Errorf("unable to resolve `@m{%s}`: %s", v.Reference, err)
 			}
-			switch s.(type) {
-			case []interface{}:
-				var strs []string
-
-				DEBUG("     [%d]: resolved to a list; verifying", i)
-				for j, sub := range s.([]interface{}) {
-					if _, ok := sub.([]interface{}); ok {
-						DEBUG("       list[%d]: list item is itself a list; error!", j)
-						return nil, fmt.Errorf("cartesian-product operator can only operate on lists of scalar values")
-
-					} else if _, ok := sub.(map[interface{}]interface{}); ok {
-						DEBUG("       list[%d]: list item is a map; error!", j)
-						return nil, fmt.Errorf("cartesian-product operator can only operate on lists of scalar values")
-
-					}
-					DEBUG("       list[%d]: list item is a scalar: %v", j, sub)
-					strs = append(strs, fmt.Sprintf("%v", sub))
-				}
-				vals = append(vals, strs)
 
-			case map[interface{}]interface{}:
-				DEBUG("     [%d]: resolved to a map; error!", i)
-				return nil, fmt.Errorf("cartesian-product operator only accepts arrays and string values")
+		default:
+			DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
+			return nil, fmt.Errorf("cartesian-product operator only accepts key reference arguments")
+		}
+
+		switch s.(type) {
+		case []interface{}:
+			var strs []string
 
-			default:
-				DEBUG("     [%d]: resolved to a scalar; appending", i)
-				vals = append(vals, []string{fmt.Sprintf("%v", s)})
+			DEBUG("     [%d]: resolved to a list; verifying", i)
+			for j, sub := range s.([]interface{}) {
+				if _, ok := sub.([]interface{}); ok {
+					DEBUG("       list[%d]: list item is itself a list; error!", j)
+					return nil, fmt.Errorf("cartesian-product operator can only operate on lists of scalar values")
+
+				} else if _, ok := sub.(map[interface{}]interface{}); ok {
+					DEBUG("       list[%d]: list item is a map; error!", j)
+					return nil, fmt.Errorf("cartesian-product operator can only operate on lists of scalar values")
+
+				}
+				DEBUG("       list[%d]: list item is a scalar: %v", j, sub)
+				strs = append(strs, fmt.Sprintf("%v", sub))
 			}
+			vals = append(vals, strs)
+
+		case map[interface{}]interface{}:
+			DEBUG("     [%d]: resolved to a map; error!", i)
+			return nil, fmt.Errorf("cartesian-product operator only accepts arrays and string values")
 
 		default:
-			DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
-			return nil, fmt.Errorf("cartesian-product operator only accepts key reference arguments")
+			DEBUG("     [%d]: resolved to a scalar; appending", i)
+			vals = append(vals, []string{fmt.Sprintf("%v", s)})
 		}
 		DEBUG("")
 	}
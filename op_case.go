@@ -0,0 +1,63 @@
+package spruce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// CaseOperator is invoked with (( upper <string> )) or (( lower <string> )),
+// and converts the string to upper or lower case, respectively
+type CaseOperator struct {
+	variant string
+}
+
+// Setup ...
+func (CaseOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CaseOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CaseOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (o CaseOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( %s ... )) operation at $.%s", o.variant, ev.Here)
+	defer DEBUG("done with (( %s ... )) operation at $%s\n", o.variant, ev.Here)
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s operator requires exactly one string or reference argument", o.variant)
+	}
+
+	s, err := resolveStringOperand(ev, o.variant, 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if o.variant == "upper" {
+		s = strings.ToUpper(s)
+	} else {
+		s = strings.ToLower(s)
+	}
+	DEBUG("  resolved (( %s ... )) operation to the string:\n    \"%s\"", o.variant, s)
+
+	return &Response{
+		Type:  Replace,
+		Value: s,
+	}, nil
+}
+
+func init() {
+	RegisterOp("upper", CaseOperator{variant: "upper"})
+	RegisterOp("lower", CaseOperator{variant: "lower"})
+}
@@ -0,0 +1,131 @@
+package spruce
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// certInfo extracts the fields that (( cert-info )) knows about
+func certInfo(cert *x509.Certificate, now time.Time) map[interface{}]interface{} {
+	dns := []interface{}{}
+	for _, name := range cert.DNSNames {
+		dns = append(dns, name)
+	}
+	ips := []interface{}{}
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	sans := append(append([]interface{}{}, dns...), ips...)
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, email)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	return map[interface{}]interface{}{
+		"common_name":    cert.Subject.CommonName,
+		"subject":        cert.Subject.String(),
+		"issuer":         cert.Issuer.String(),
+		"serial":         hex.EncodeToString(cert.SerialNumber.Bytes()),
+		"not_before":     cert.NotBefore.UTC().Format(time.RFC3339),
+		"not_after":      cert.NotAfter.UTC().Format(time.RFC3339),
+		"days_remaining": int(cert.NotAfter.Sub(now).Hours() / 24),
+		"sans":           sans,
+		"dns_names":      dns,
+		"ip_addresses":   ips,
+		"fingerprint":    hex.EncodeToString(fingerprint[:]),
+		"is_ca":          cert.IsCA,
+	}
+}
+
+// CertInfoOperator is invoked with (( cert-info <certificate> [field] ))
+type CertInfoOperator struct{}
+
+// Setup ...
+func (CertInfoOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CertInfoOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CertInfoOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (CertInfoOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( cert-info ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( cert-info ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ansi.Errorf("@R{cert-info operator requires a certificate, and an optional field name}")
+	}
+
+	v, err := resolveOperand(ev, "cert-info", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(map[interface{}]interface{}); ok {
+		// accept the maps generated by (( x509-cert )), or stored in vault
+		v = m["certificate"]
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, ansi.Errorf("@c{(( cert-info ))} @R{expects a PEM-encoded certificate, but} @c{%s} @R{is not one}", args[0])
+	}
+	cert, err := parsePEMCertificate(s)
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( cert-info ))} @R{could not read} @c{%s}@R{:} %s", args[0], err)
+	}
+
+	now, err := currentTime()
+	if err != nil {
+		return nil, err
+	}
+	info := certInfo(cert, now)
+	if len(args) == 1 {
+		return &Response{
+			Type:  Replace,
+			Value: info,
+		}, nil
+	}
+
+	field, err := resolveStringOperand(ev, "cert-info", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+	value, ok := info[field]
+	if !ok {
+		fields := []string{}
+		for k := range info {
+			fields = append(fields, k.(string))
+		}
+		sort.Strings(fields)
+		return nil, ansi.Errorf("@c{(( cert-info ))} @R{does not know about the field} @c{%s} @R{(expected one of %s)}", field, strings.Join(fields, ", "))
+	}
+	DEBUG("  %s of certificate '%s' is %v", field, cert.Subject.CommonName, value)
+
+	return &Response{
+		Type:  Replace,
+		Value: value,
+	}, nil
+}
+
+func init() {
+	RegisterOp("cert-info", CertInfoOperator{})
+}
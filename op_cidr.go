@@ -0,0 +1,230 @@
+package spruce
+
+import (
+	"math/big"
+	"net"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// resolveCIDROperand resolves an operator argument to an IPv4 or IPv6
+// network in CIDR notation
+func resolveCIDROperand(ev *Evaluator, name string, i int, arg *Expr) (*net.IPNet, error) {
+	s, err := resolveStringOperand(ev, name, i, arg)
+	if err != nil {
+		return nil, err
+	}
+	ipnet, err := parseCIDR(s)
+	if err != nil {
+		DEBUG("     [%d]: '%s' is not a network in CIDR notation", i, s)
+		return nil, ansi.Errorf("@c{(( %s ))} @R{expects a network in CIDR notation, but} @c{%s} @R{is not one}", name, s)
+	}
+	return ipnet, nil
+}
+
+// CidrSubnetOperator is invoked with (( cidrsubnet <prefix> <newbits> <netnum> ))
+type CidrSubnetOperator struct{}
+
+// Setup ...
+func (CidrSubnetOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CidrSubnetOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CidrSubnetOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (CidrSubnetOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( cidrsubnet ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( cidrsubnet ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 3 {
+		return nil, ansi.Errorf("@R{cidrsubnet operator requires exactly three arguments: a prefix, the number of bits to extend it by, and a subnet number}")
+	}
+
+	ipnet, err := resolveCIDROperand(ev, "cidrsubnet", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	newbits, err := resolveIntOperand(ev, "cidrsubnet", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+	netnum, err := resolveIntOperand(ev, "cidrsubnet", 2, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	subnet, err := cidrSubnet(ipnet, newbits, big.NewInt(int64(netnum)))
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( cidrsubnet ))}@R{:} %s", err)
+	}
+	DEBUG("  subnet %d of %s extended by %d bits is %s", netnum, ipnet, newbits, subnet)
+
+	return &Response{
+		Type:  Replace,
+		Value: subnet.String(),
+	}, nil
+}
+
+// CidrSubnetsOperator is invoked with (( cidrsubnets <prefix> <newbits>... ))
+type CidrSubnetsOperator struct{}
+
+// Setup ...
+func (CidrSubnetsOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CidrSubnetsOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CidrSubnetsOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (CidrSubnetsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( cidrsubnets ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( cidrsubnets ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 2 {
+		return nil, ansi.Errorf("@R{cidrsubnets operator requires a prefix, and the number of bits to extend it by for each subnet}")
+	}
+
+	ipnet, err := resolveCIDROperand(ev, "cidrsubnets", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	newbits := []int{}
+	for i, arg := range args[1:] {
+		n, err := resolveIntOperand(ev, "cidrsubnets", i+1, arg)
+		if err != nil {
+			return nil, err
+		}
+		newbits = append(newbits, n)
+	}
+
+	subnets, err := cidrSubnets(ipnet, newbits...)
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( cidrsubnets ))}@R{:} %s", err)
+	}
+
+	l := []interface{}{}
+	for _, subnet := range subnets {
+		DEBUG("  allocated %s", subnet)
+		l = append(l, subnet.String())
+	}
+	return &Response{
+		Type:  Replace,
+		Value: l,
+	}, nil
+}
+
+// CidrHostOperator is invoked with (( cidrhost <prefix> <hostnum> ))
+type CidrHostOperator struct{}
+
+// Setup ...
+func (CidrHostOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CidrHostOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CidrHostOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (CidrHostOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( cidrhost ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( cidrhost ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, ansi.Errorf("@R{cidrhost operator requires exactly two arguments: a prefix, and a host number}")
+	}
+
+	ipnet, err := resolveCIDROperand(ev, "cidrhost", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	hostnum, err := resolveIntOperand(ev, "cidrhost", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := cidrHost(ipnet, big.NewInt(int64(hostnum)))
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( cidrhost ))}@R{:} %s", err)
+	}
+	DEBUG("  host %d of %s is %s", hostnum, ipnet, ip)
+
+	return &Response{
+		Type:  Replace,
+		Value: ip.String(),
+	}, nil
+}
+
+// CidrNetmaskOperator is invoked with (( cidrnetmask <prefix> ))
+type CidrNetmaskOperator struct{}
+
+// Setup ...
+func (CidrNetmaskOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (CidrNetmaskOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (CidrNetmaskOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (CidrNetmaskOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( cidrnetmask ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( cidrnetmask ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 1 {
+		return nil, ansi.Errorf("@R{cidrnetmask operator requires exactly one argument, a prefix}")
+	}
+
+	ipnet, err := resolveCIDROperand(ev, "cidrnetmask", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(ipnet.Mask) != net.IPv4len {
+		return nil, ansi.Errorf("@c{(( cidrnetmask ))} @R{only supports IPv4 networks, not} @c{%s}", ipnet)
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: net.IP(ipnet.Mask).String(),
+	}, nil
+}
+
+func init() {
+	RegisterOp("cidrsubnet", CidrSubnetOperator{})
+	RegisterOp("cidrsubnets", CidrSubnetsOperator{})
+	RegisterOp("cidrhost", CidrHostOperator{})
+	RegisterOp("cidrnetmask", CidrNetmaskOperator{})
+}
@@ -0,0 +1,133 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CIDR Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	meta := `
+meta:
+  vpc: 10.1.0.0/16
+  v6: fd00:fd12:3456:7890::/56
+`
+
+	// the expected values in these tests come from the examples in the
+	// Terraform documentation for the functions of the same name
+	Describe("(( cidrsubnet ... ))", func() {
+		It("carves subnets out of IPv4 and IPv6 prefixes", func() {
+			t, err := run(meta + `
+a: (( cidrsubnet "172.16.0.0/12" 4 2 ))
+b: (( cidrsubnet "10.1.2.0/24" 4 15 ))
+c: (( cidrsubnet meta.v6 8 34 ))
+d: (( cidrsubnet meta.vpc 0 0 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("172.18.0.0/16"))
+			Expect(t["b"]).To(Equal("10.1.2.240/28"))
+			Expect(t["c"]).To(Equal("fd00:fd12:3456:7822::/64"))
+			Expect(t["d"]).To(Equal("10.1.0.0/16"))
+		})
+
+		It("refuses subnets that don't fit", func() {
+			_, err := run(meta + `x: (( cidrsubnet meta.vpc 4 16 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("prefix extension of 4 does not accommodate a subnet numbered 16"))
+
+			_, err = run(meta + `x: (( cidrsubnet meta.vpc 17 0 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("insufficient address space to extend prefix of 16 by 17"))
+		})
+
+		It("requires a network in CIDR notation", func() {
+			_, err := run(`x: (( cidrsubnet "10.0.0.1" 8 1 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expects a network in CIDR notation, but 10.0.0.1 is not one"))
+		})
+	})
+
+	Describe("(( cidrsubnets ... ))", func() {
+		It("allocates consecutive subnets", func() {
+			t, err := run(meta + `
+a: (( cidrsubnets meta.vpc 4 4 8 4 ))
+b: (( cidrsubnets meta.v6 16 16 16 32 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal([]interface{}{"10.1.0.0/20", "10.1.16.0/20", "10.1.32.0/24", "10.1.48.0/20"}))
+			Expect(t["b"]).To(Equal([]interface{}{
+				"fd00:fd12:3456:7800::/72",
+				"fd00:fd12:3456:7800:100::/72",
+				"fd00:fd12:3456:7800:200::/72",
+				"fd00:fd12:3456:7800:300::/88",
+			}))
+		})
+
+		It("fails when the prefix runs out of room", func() {
+			_, err := run(meta + `x: (( cidrsubnets "10.0.0.0/24" 1 2 2 1 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not enough remaining address space for a subnet with a prefix of 25 bits after 10.0.0.192/26"))
+		})
+	})
+
+	Describe("(( cidrhost ... ))", func() {
+		It("picks hosts, counting from the front or the back", func() {
+			t, err := run(meta + `
+a: (( cidrhost "10.12.112.0/20" 16 ))
+b: (( cidrhost "10.12.112.0/20" 268 ))
+c: (( cidrhost "fd00:fd12:3456:7890:00a2::/72" 34 ))
+d: (( cidrhost meta.vpc -1 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("10.12.112.16"))
+			Expect(t["b"]).To(Equal("10.12.113.12"))
+			Expect(t["c"]).To(Equal("fd00:fd12:3456:7890::22"))
+			Expect(t["d"]).To(Equal("10.1.255.255"))
+		})
+
+		It("refuses hosts outside of the prefix", func() {
+			_, err := run(`x: (( cidrhost "10.0.0.0/30" 4 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("prefix of 30 does not accommodate a host numbered 4"))
+		})
+	})
+
+	Describe("(( cidrnetmask ... ))", func() {
+		It("converts IPv4 prefixes to netmasks", func() {
+			t, err := run(`x: (( cidrnetmask "172.16.0.0/12" ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal("255.240.0.0"))
+		})
+
+		It("does not support IPv6", func() {
+			_, err := run(`x: (( cidrnetmask "fd00::/64" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("only supports IPv4 networks"))
+		})
+	})
+
+	Describe("(( ips ... ))", func() {
+		It("handles IPv6 networks", func() {
+			t, err := run(`
+a: (( ips "fd00::/64" 10 ))
+b: (( ips "fd00::/64" -1 ))
+c: (( ips "fd00::ff00/120" 253 3 ))
+d: (( ips "2001:db8::1" 15 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("fd00::a"))
+			Expect(t["b"]).To(Equal("fd00::ffff:ffff:ffff:ffff"))
+			Expect(t["c"]).To(Equal([]interface{}{"fd00::fffd", "fd00::fffe", "fd00::ffff"}))
+			Expect(t["d"]).To(Equal("2001:db8::10"))
+
+			_, err = run(`x: (( ips "fd00::/120" 254 3 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("would exceed size of subnet"))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collection Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	meta := `
+meta:
+  sizes:
+    small: 1
+    large: 3
+    medium: 2
+  list: [a, b, a, c, b]
+  nested: [[1, [2, 3]], 4, [[5]]]
+  names: [web, db]
+  ports: [80, 5432]
+`
+
+	Describe("(( values ... ))", func() {
+		It("returns the values of a map, ordered by key", func() {
+			t, err := run(meta + `x: (( values meta.sizes ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{3, 2, 1}))
+		})
+
+		It("only works on maps", func() {
+			_, err := run(meta + `x: (( values meta.list ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("meta.list is not a map"))
+		})
+	})
+
+	Describe("(( length ... ))", func() {
+		It("counts lists, maps and strings", func() {
+			t, err := run(meta + `
+a: (( length meta.list ))
+b: (( length meta.sizes ))
+c: (( length "héllo" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal(5))
+			Expect(t["b"]).To(Equal(3))
+			Expect(t["c"]).To(Equal(5))
+		})
+
+		It("rejects scalars without a length", func() {
+			_, err := run(meta + `x: (( length meta.sizes.small ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not a list, map or string"))
+		})
+	})
+
+	Describe("(( unique ... ))", func() {
+		It("removes duplicates, preserving order", func() {
+			t, err := run(meta + `x: (( unique meta.list "d" "a" ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{"a", "b", "c", "d"}))
+		})
+
+		It("treats literal and parsed numbers alike", func() {
+			t, err := run(meta + `x: (( unique meta.ports 80 ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{80, 5432}))
+		})
+	})
+
+	Describe("(( union ... )), (( intersect ... )) and (( difference ... ))", func() {
+		sets := `
+sets:
+  a: [z1, z2, z1, 3]
+  b: [z3, z2, 3.0]
+  jobs:
+  - { name: web, instances: 1 }
+  - { name: db,  instances: 1 }
+  more:
+  - { name: web, instances: 5 }
+  - { name: worker }
+`
+		It("combines lists, keeping entries in first-seen order", func() {
+			t, err := run(sets + `
+u: (( union sets.a sets.b "z4" ))
+i: (( intersect sets.a sets.b ))
+d: (( difference sets.a sets.b ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["u"]).To(Equal([]interface{}{"z1", "z2", 3, "z3", "z4"}))
+			Expect(t["i"]).To(Equal([]interface{}{"z2", 3}))
+			Expect(t["d"]).To(Equal([]interface{}{"z1"}))
+		})
+
+		It("compares maps by their identifier", func() {
+			t, err := run(sets + `
+u: (( union sets.jobs sets.more ))
+i: (( intersect sets.jobs sets.more ))
+d: (( difference sets.jobs sets.more ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["u"]).To(HaveLen(3))
+			Expect(t["u"].([]interface{})[0]).To(Equal(map[interface{}]interface{}{"name": "web", "instances": 1}))
+			Expect(t["i"]).To(Equal([]interface{}{map[interface{}]interface{}{"name": "web", "instances": 1}}))
+			Expect(t["d"]).To(Equal([]interface{}{map[interface{}]interface{}{"name": "db", "instances": 1}}))
+		})
+
+		It("needs enough lists, and no maps", func() {
+			_, err := run(sets + `x: (( intersect sets.a ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("(( intersect ... )) needs at least two lists"))
+
+			_, err = run(sets + `x: (( union sets.a sets ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("sets is a map, not a list"))
+		})
+	})
+
+	Describe("(( flatten ... ))", func() {
+		It("flattens deeply nested lists", func() {
+			t, err := run(meta + `x: (( flatten meta.nested 6 ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{1, 2, 3, 4, 5, int64(6)}))
+		})
+	})
+
+	Describe("(( zip ... ))", func() {
+		It("pairs up list entries", func() {
+			t, err := run(meta + `x: (( zip meta.names meta.ports ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{
+				[]interface{}{"web", 80},
+				[]interface{}{"db", 5432},
+			}))
+		})
+
+		It("refuses to zip lists of different lengths", func() {
+			_, err := run(meta + `x: (( zip meta.names meta.list ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot zip lists of different lengths"))
+		})
+	})
+
+	Describe("(( merge-maps ... ))", func() {
+		It("deep-merges maps, with later maps taking precedence", func() {
+			t, err := run(`
+base:
+  a: 1
+  sub: { p: 1, q: 2 }
+  list: [1, 2]
+over:
+  b: 2
+  sub: { q: 3 }
+  list: [3]
+x: (( merge-maps base over ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal(map[interface{}]interface{}{
+				"a":    1,
+				"b":    2,
+				"sub":  map[interface{}]interface{}{"p": 1, "q": 3},
+				"list": []interface{}{3},
+			}))
+			Expect(t["base"].(map[interface{}]interface{})["sub"]).To(Equal(map[interface{}]interface{}{"p": 1, "q": 2}))
+		})
+		It("is not mistaken for a (( merge )) array directive", func() {
+			m := &Merger{}
+			root := map[interface{}]interface{}{}
+			Expect(m.Merge(root, evalYAML(`x: (( merge-maps a b ))`))).To(Succeed())
+			Expect(root["x"]).To(Equal("(( merge-maps a b ))"))
+		})
+	})
+
+	Describe("(( index-of ... ))", func() {
+		It("finds values in lists and strings", func() {
+			t, err := run(meta + `
+a: (( index-of meta.list "c" ))
+b: (( index-of meta.ports 5432 ))
+c: (( index-of meta.list "z" ))
+d: (( index-of "héllo" "llo" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal(3))
+			Expect(t["b"]).To(Equal(1))
+			Expect(t["c"]).To(Equal(-1))
+			Expect(t["d"]).To(Equal(2))
+		})
+	})
+
+	It("evaluates operators inside of the collections first", func() {
+		t, err := run(`
+a_count:  (( length things ))
+a_unique: (( unique things ))
+a_values: (( values config ))
+things:
+  - (( grab meta.first ))
+  - (( concat "b" "" ))
+  - b
+config:
+  key: (( grab meta.first ))
+meta:
+  first: a
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["a_count"]).To(Equal(3))
+		Expect(t["a_unique"]).To(Equal([]interface{}{"a", "b"}))
+		Expect(t["a_values"]).To(Equal([]interface{}{"a"}))
+	})
+})
@@ -0,0 +1,142 @@
+package spruce
+
+import (
+	"time"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// resolveTimeOperand resolves an operator argument to a time, which
+// may be a timestamp string or an integer number of seconds since the
+// Unix epoch
+func resolveTimeOperand(ev *Evaluator, name string, i int, arg *Expr) (time.Time, error) {
+	v, err := resolveOperand(ev, name, i, arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case int:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case string:
+		t, err := ParseTime(v)
+		if err != nil {
+			return time.Time{}, ansi.Errorf("@c{(( %s ))}: %s", name, err)
+		}
+		return t, nil
+	}
+	DEBUG("     [%d]: %v is not a time", i, v)
+	return time.Time{}, ansi.Errorf("@c{(( %s ))} @R{expects a time, but} @c{%s} @R{is not one}", name, arg)
+}
+
+// DateAddOperator is invoked with (( date-add <time> <duration> [format] ))
+type DateAddOperator struct{}
+
+// Setup ...
+func (DateAddOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (DateAddOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (DateAddOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (DateAddOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( date-add ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( date-add ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 2 || len(args) > 3 {
+		return nil, ansi.Errorf("@R{date-add operator requires a time, a duration, and an optional format}")
+	}
+
+	t, err := resolveTimeOperand(ev, "date-add", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := resolveStringOperand(ev, "date-add", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( date-add ))} @R{was given an invalid duration} @c{%q} @R{(try something like \"720h\" or \"30d\")}", s)
+	}
+
+	layout := "RFC3339"
+	if len(args) == 3 {
+		layout, err = resolveStringOperand(ev, "date-add", 2, args[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t = t.Add(d)
+	DEBUG("  added %s, giving %s", d, t)
+	return &Response{
+		Type:  Replace,
+		Value: formatTime(t, layout),
+	}, nil
+}
+
+// DateFormatOperator is invoked with (( date-format <time> <format> ))
+type DateFormatOperator struct{}
+
+// Setup ...
+func (DateFormatOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (DateFormatOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (DateFormatOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (DateFormatOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( date-format ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( date-format ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, ansi.Errorf("@R{date-format operator requires exactly two arguments: a time and a format}")
+	}
+
+	t, err := resolveTimeOperand(ev, "date-format", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	layout, err := resolveStringOperand(ev, "date-format", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	v := formatTime(t, layout)
+	DEBUG("  formatted %s as %v", t, v)
+	return &Response{
+		Type:  Replace,
+		Value: v,
+	}, nil
+}
+
+func init() {
+	RegisterOp("date-add", DateAddOperator{})
+	RegisterOp("date-format", DateFormatOperator{})
+}
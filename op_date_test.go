@@ -0,0 +1,124 @@
+package spruce
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Date Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	BeforeEach(func() {
+		Now = time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+	})
+	AfterEach(func() {
+		Now = time.Time{}
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+	})
+
+	Describe("(( now ... ))", func() {
+		It("returns the pinned time, in RFC3339 by default", func() {
+			t, err := run(`
+a: (( now ))
+b: (( now "unix" ))
+c: (( now "2006-01-02" ))
+d: (( now "Kitchen" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("2024-06-01T12:30:00Z"))
+			Expect(t["b"]).To(Equal(int64(1717245000)))
+			Expect(t["c"]).To(Equal("2024-06-01"))
+			Expect(t["d"]).To(Equal("12:30PM"))
+		})
+
+		It("honors $SOURCE_DATE_EPOCH", func() {
+			Now = time.Time{}
+			os.Setenv("SOURCE_DATE_EPOCH", "86400")
+			t, err := run(`x: (( now ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal("1970-01-02T00:00:00Z"))
+
+			os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+			_, err = run(`x: (( now ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid $SOURCE_DATE_EPOCH"))
+		})
+
+		It("uses the actual time otherwise", func() {
+			Now = time.Time{}
+			t, err := run(`x: (( now "unix" ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(BeNumerically("~", time.Now().Unix(), 5))
+		})
+	})
+
+	Describe("(( date-add ... ))", func() {
+		It("adds durations, including days", func() {
+			t, err := run(`
+meta:
+  issued: 2024-01-31
+a: (( date-add meta.issued "720h" ))
+b: (( date-add meta.issued "30d" ))
+c: (( date-add meta.issued "-1d12h" "DateTime" ))
+d: (( date-add 0 "90m" "unix" ))
+e: (( date-add expiry "-24h" ))
+expiry: (( now ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("2024-03-01T00:00:00Z"))
+			Expect(t["b"]).To(Equal("2024-03-01T00:00:00Z"))
+			Expect(t["c"]).To(Equal("2024-01-29 12:00:00"))
+			Expect(t["d"]).To(Equal(int64(5400)))
+			Expect(t["e"]).To(Equal("2024-05-31T12:30:00Z"))
+		})
+
+		It("rejects bad times and durations", func() {
+			_, err := run(`x: (( date-add "someday" "1h" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unable to parse someday as a time"))
+
+			_, err = run(`x: (( date-add "2024-01-01" "a while" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`was given an invalid duration "a while"`))
+		})
+
+		It("applies a leading sign to every unit", func() {
+			t, err := run(`
+a: (( date-add "2024-01-31" "-1d12h" "DateTime" ))
+b: (( date-add "2024-01-31" "+1d12h" "DateTime" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("2024-01-29 12:00:00"))
+			Expect(t["b"]).To(Equal("2024-02-01 12:00:00"))
+
+			for _, d := range []string{"-1d-12h", "1d-12h", "1d+12h"} {
+				_, err = run(`x: (( date-add "2024-01-31" "` + d + `" ))`)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(`was given an invalid duration "` + d + `"`))
+			}
+		})
+	})
+
+	Describe("(( date-format ... ))", func() {
+		It("reformats times", func() {
+			t, err := run(`
+meta:
+  when: "2024-01-31T08:15:00+02:00"
+a: (( date-format meta.when "2006-01-02 15:04" ))
+b: (( date-format meta.when "unix" ))
+c: (( date-format 1700000000 "RFC1123" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("2024-01-31 06:15"))
+			Expect(t["b"]).To(Equal(int64(1706681700)))
+			Expect(t["c"]).To(Equal("Tue, 14 Nov 2023 22:13:20 UTC"))
+		})
+	})
+})
@@ -0,0 +1,146 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoding Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	meta := `
+meta:
+  blob: hello
+  password: "p@ss w/rd+1"
+  json: '{"a": [1, 2.5, true], "b": {"c": null}}'
+  yaml: "a: [1, two]\nb: {c: d}"
+  number: 42
+  config:
+    name: web
+    ports: [80, 443]
+    html: "<b>&</b>"
+`
+
+	Describe("(( base64 ... )) and (( base64-decode ... ))", func() {
+		It("round-trips strings", func() {
+			t, err := run(meta + `
+a: (( base64 meta.blob ))
+b: (( base64-decode "aGVsbG8=" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("aGVsbG8="))
+			Expect(t["b"]).To(Equal("hello"))
+		})
+
+		It("only accepts strings", func() {
+			_, err := run(meta + `x: (( base64 meta.number ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tried to base64 encode meta.number, which is not a string scalar"))
+		})
+	})
+
+	Describe("(( sha256 ... )), (( sha1 ... )) and (( md5 ... ))", func() {
+		It("returns hex digests", func() {
+			t, err := run(meta + `
+a: (( sha256 meta.blob ))
+b: (( sha1 meta.blob ))
+c: (( md5 "hello" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+			Expect(t["b"]).To(Equal("aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"))
+			Expect(t["c"]).To(Equal("5d41402abc4b2a76b9719d911017c592"))
+		})
+
+		It("refuses to hash maps", func() {
+			_, err := run(meta + `x: (( sha256 meta.config ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tried to sha256 hash meta.config, which is not a string scalar"))
+		})
+	})
+
+	Describe("(( hmac ... ))", func() {
+		It("computes keyed digests", func() {
+			t, err := run(meta + `x: (( hmac "sha256" "key" "The quick brown fox jumps over the lazy dog" ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"))
+		})
+
+		It("rejects unknown algorithms", func() {
+			_, err := run(meta + `x: (( hmac "sha3" "key" meta.blob ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unsupported hmac algorithm sha3 (expected one of md5, sha1, sha256)"))
+		})
+	})
+
+	Describe("(( hex ... )) and (( urlencode ... ))", func() {
+		It("encodes strings", func() {
+			t, err := run(meta + `
+a: (( hex meta.blob ))
+b: (( urlencode meta.password ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("68656c6c6f"))
+			Expect(t["b"]).To(Equal("p%40ss%20w%2Frd%2B1"))
+		})
+	})
+
+	Describe("(( json-parse ... )) and (( yaml-parse ... ))", func() {
+		It("parses strings into data structures", func() {
+			t, err := run(meta + `
+a: (( json-parse meta.json ))
+b: (( yaml-parse meta.yaml ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal(map[interface{}]interface{}{
+				"a": []interface{}{int64(1), 2.5, true},
+				"b": map[interface{}]interface{}{"c": nil},
+			}))
+			Expect(t["b"]).To(Equal(map[interface{}]interface{}{
+				"a": []interface{}{1, "two"},
+				"b": map[interface{}]interface{}{"c": "d"},
+			}))
+		})
+
+		It("reports malformed input", func() {
+			_, err := run(meta + `x: (( json-parse "{nope" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unable to parse JSON"))
+		})
+	})
+
+	Describe("(( tojson ... ))", func() {
+		It("serializes compactly by default", func() {
+			t, err := run(meta + `x: (( tojson meta.config ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal(`{"html":"<b>&</b>","name":"web","ports":[80,443]}`))
+		})
+
+		It("indents by a number of spaces, or a string", func() {
+			t, err := run(meta + `
+a: (( tojson meta.config.ports 2 ))
+b: (( tojson meta.config.ports "\t" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("[\n  80,\n  443\n]"))
+			Expect(t["b"]).To(Equal("[\n\t80,\n\t443\n]"))
+		})
+
+		It("round-trips through (( json-parse ))", func() {
+			t, err := run(meta + `
+a: (( tojson meta.config ))
+b: (( json-parse a ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["b"]).To(Equal(map[interface{}]interface{}{
+				"html":  "<b>&</b>",
+				"name":  "web",
+				"ports": []interface{}{int64(80), int64(443)},
+			}))
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// FlattenOperator is invoked with (( flatten <lists/values>... )), and
+// returns a single list of every non-list value found, no matter how
+// deeply nested in lists of lists it was.
+type FlattenOperator struct{}
+
+// Setup ...
+func (FlattenOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (FlattenOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (FlattenOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+func flatten(l []interface{}) []interface{} {
+	flat := []interface{}{}
+	for _, v := range l {
+		if sub, ok := v.([]interface{}); ok {
+			flat = append(flat, flatten(sub)...)
+		} else {
+			flat = append(flat, v)
+		}
+	}
+	return flat
+}
+
+// Run ...
+func (FlattenOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( flatten ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( flatten ... )) operation at $%s\n", ev.Here)
+
+	if len(args) == 0 {
+		DEBUG("  no arguments supplied to (( flatten ... )) operation.  oops.")
+		return nil, ansi.Errorf("no arguments specified to @c{(( flatten ... ))}")
+	}
+
+	vals := []interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, "flatten", i, arg)
+		if err != nil {
+			return nil, err
+		}
+		DEBUG("     [%d]: appending to the list to be flattened", i)
+		vals = append(vals, s)
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: flatten(vals),
+	}, nil
+}
+
+func init() {
+	RegisterOp("flatten", FlattenOperator{})
+}
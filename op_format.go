@@ -0,0 +1,81 @@
+package spruce
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// FormatOperator is invoked with (( format <format> <values>... )), and
+// formats the values according to a printf-style format string
+type FormatOperator struct{}
+
+// badFormatRx matches the markers that fmt.Sprintf leaves behind when the
+// verbs of a format string don't line up with its arguments
+var badFormatRx = regexp.MustCompile(`%!\w*\(`)
+
+// Setup ...
+func (FormatOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (FormatOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (FormatOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (FormatOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( format ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( format ... )) operation at $%s\n", ev.Here)
+
+	if len(args) == 0 {
+		DEBUG("  no arguments supplied to (( format ... )) operation.  oops.")
+		return nil, ansi.Errorf("no arguments specified to @c{(( format ... ))}")
+	}
+
+	format, err := resolveStringOperand(ev, "format", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	DEBUG("     [0]: using format string '%s'", format)
+
+	vals := []interface{}{}
+	for i, arg := range args[1:] {
+		v, err := resolveOperand(ev, "format", i+1, arg)
+		if err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			DEBUG("     [%d]: %v is not a scalar", i+1, v)
+			return nil, ansi.Errorf("@R{tried to format} @c{%s}@R{, which is not a scalar value}", arg)
+		}
+		vals = append(vals, v)
+	}
+
+	s := fmt.Sprintf(format, vals...)
+	if badFormatRx.MatchString(s) {
+		DEBUG("  format string and arguments don't match up: %s", s)
+		return nil, ansi.Errorf("@R{format string} @c{\"%s\"} @R{does not match its %d argument(s):} %s", format, len(vals), s)
+	}
+	DEBUG("  resolved (( format ... )) operation to the string:\n    \"%s\"", s)
+
+	return &Response{
+		Type:  Replace,
+		Value: s,
+	}, nil
+}
+
+func init() {
+	RegisterOp("format", FormatOperator{})
+}
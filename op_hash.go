@@ -0,0 +1,71 @@
+package spruce
+
+import (
+	"crypto/md5"  // #nosec G501 -- used for checksums, not for security
+	"crypto/sha1" // #nosec G505 -- used for checksums, not for security
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// hashFuncs are the digest algorithms supported by (( sha256 )) and
+// friends, and by (( hmac ))
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// HashOperator is invoked with (( sha256 <string> )), (( sha1 <string> ))
+// or (( md5 <string> )), and returns the hex-encoded digest of the string.
+// These are typically used as checksums of configuration blobs, so that
+// changes to them trigger rollouts.
+type HashOperator struct {
+	variant string
+}
+
+// Setup ...
+func (HashOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (HashOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (HashOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (o HashOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( %s ... )) operation at $.%s", o.variant, ev.Here)
+	defer DEBUG("done with (( %s ... )) operation at $%s\n", o.variant, ev.Here)
+
+	strs, err := encodingArgs(ev, o.variant, o.variant+" hash", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hashFuncs[o.variant]()
+	h.Write([]byte(strs[0])) // #nosec G104 -- hash.Hash writes never fail
+	digest := hex.EncodeToString(h.Sum(nil))
+	DEBUG("  resolved (( %s ... )) operation to the string:\n    \"%s\"", o.variant, digest)
+
+	return &Response{
+		Type:  Replace,
+		Value: digest,
+	}, nil
+}
+
+func init() {
+	for name := range hashFuncs {
+		RegisterOp(name, HashOperator{variant: name})
+	}
+}
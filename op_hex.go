@@ -0,0 +1,51 @@
+package spruce
+
+import (
+	"encoding/hex"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// HexOperator is invoked with (( hex <string> )), and returns the
+// hexadecimal encoding of the string's bytes
+type HexOperator struct{}
+
+// Setup ...
+func (HexOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (HexOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (HexOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (HexOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( hex ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( hex ... )) operation at $%s\n", ev.Here)
+
+	strs, err := encodingArgs(ev, "hex", "hex encode", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := hex.EncodeToString([]byte(strs[0]))
+	DEBUG("  resolved (( hex ... )) operation to the string:\n    \"%s\"", encoded)
+
+	return &Response{
+		Type:  Replace,
+		Value: encoded,
+	}, nil
+}
+
+func init() {
+	RegisterOp("hex", HexOperator{})
+}
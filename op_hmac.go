@@ -0,0 +1,69 @@
+package spruce
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// HmacOperator is invoked with (( hmac <algorithm> <key> <message> )), and
+// returns the hex-encoded HMAC of the message, using one of the digest
+// algorithms supported by (( sha256 )) and friends.
+type HmacOperator struct{}
+
+// Setup ...
+func (HmacOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (HmacOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (HmacOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (HmacOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( hmac ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( hmac ... )) operation at $%s\n", ev.Here)
+
+	strs, err := encodingArgs(ev, "hmac", "hmac", args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	algo, key, message := strings.ToLower(strs[0]), strs[1], strs[2]
+	newHash, ok := hashFuncs[algo]
+	if !ok {
+		known := []string{}
+		for name := range hashFuncs {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, ansi.Errorf("@R{unsupported hmac algorithm} @c{%s} @R{(expected one of %s)}", strs[0], strings.Join(known, ", "))
+	}
+
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(message)) // #nosec G104 -- hash.Hash writes never fail
+	digest := hex.EncodeToString(mac.Sum(nil))
+	DEBUG("  resolved (( hmac ... )) operation to the string:\n    \"%s\"", digest)
+
+	return &Response{
+		Type:  Replace,
+		Value: digest,
+	}, nil
+}
+
+func init() {
+	RegisterOp("hmac", HmacOperator{})
+}
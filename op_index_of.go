@@ -0,0 +1,86 @@
+package spruce
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// IndexOfOperator is invoked with (( index-of <list|string> <value> )),
+// and returns the index of the first entry in the list equal to the value
+// (or the character offset of the value in the string), or -1 if it
+// isn't there.
+type IndexOfOperator struct{}
+
+// Setup ...
+func (IndexOfOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (IndexOfOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (IndexOfOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (IndexOfOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( index-of ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( index-of ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("index-of operator requires exactly two arguments: a list (or string), and the value to look for")
+	}
+
+	haystack, err := resolveOperand(ev, "index-of", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	needle, err := resolveOperand(ev, "index-of", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	idx := -1
+	switch haystack := haystack.(type) {
+	case []interface{}:
+		for i, v := range haystack {
+			if equalValues(v, needle) {
+				idx = i
+				break
+			}
+		}
+
+	case string:
+		s, ok := needle.(string)
+		if !ok {
+			return nil, ansi.Errorf("@R{can only look for strings inside of} @c{%s}", args[0])
+		}
+		if i := strings.Index(haystack, s); i >= 0 {
+			idx = utf8.RuneCountInString(haystack[:i])
+		}
+
+	default:
+		DEBUG("     [0]: resolved to something that is not a list or a string")
+		return nil, ansi.Errorf("@c{%s} @R{is not a list or a string}", args[0])
+	}
+	DEBUG("  found at index %d", idx)
+
+	return &Response{
+		Type:  Replace,
+		Value: idx,
+	}, nil
+}
+
+func init() {
+	RegisterOp("index-of", IndexOfOperator{})
+}
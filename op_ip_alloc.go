@@ -0,0 +1,271 @@
+package spruce
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// ipAllocations remembers what (( ip-alloc )) handed out for each key, so
+// that asking again with the same key gets the same addresses
+var ipAllocations map[string]ipAllocation
+
+type ipAllocation struct {
+	pool  string
+	count int
+	ips   []interface{}
+}
+
+// ipRange is an inclusive range of addresses
+type ipRange struct {
+	first, last *big.Int
+	length      int
+}
+
+// parseIPRange parses a single address, a range of addresses like
+// "10.0.0.10 - 10.0.0.20", or a network in CIDR notation
+func parseIPRange(s string) (ipRange, error) {
+	if strings.Contains(s, "/") {
+		ipnet, err := parseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return ipRange{}, fmt.Errorf("%s is not a valid network", s)
+		}
+		first := ipToInt(ipnet.IP)
+		last := new(big.Int).Add(first, cidrSize(ipnet))
+		return ipRange{first: first, last: last.Sub(last, big.NewInt(1)), length: len(ipnet.IP)}, nil
+	}
+
+	segments := strings.Split(s, "-")
+	if len(segments) > 2 {
+		return ipRange{}, fmt.Errorf("%s is not a valid range of addresses", s)
+	}
+	ips := []net.IP{}
+	for _, seg := range segments {
+		ip := net.ParseIP(strings.TrimSpace(seg))
+		if ip == nil {
+			return ipRange{}, fmt.Errorf("%s is not a valid IP address", strings.TrimSpace(seg))
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		ips = append(ips, ip)
+	}
+
+	start, end := ips[0], ips[len(ips)-1]
+	if len(start) != len(end) {
+		return ipRange{}, fmt.Errorf("%s mixes IPv4 and IPv6 addresses", s)
+	}
+	r := ipRange{first: ipToInt(start), last: ipToInt(end), length: len(start)}
+	if r.first.Cmp(r.last) > 0 {
+		return ipRange{}, fmt.Errorf("%s ends before it starts", s)
+	}
+	return r, nil
+}
+
+// ipPool is a set of address ranges, optionally split up by AZ.  Pools
+// that are not AZ-aware have a single, unnamed AZ.
+type ipPool struct {
+	azs     []string
+	ranges  map[string][]ipRange
+	cursors map[string]*ipCursor
+}
+
+// ipCursor is where the search for the next free address in an AZ of an
+// ipPool picks up: everything before it has been claimed already
+type ipCursor struct {
+	r int
+	n *big.Int
+}
+
+// parseIPPool understands pools given as a single range (or address, or
+// network), a list of them, or a map of AZ names to either of those
+func parseIPPool(v interface{}) (ipPool, error) {
+	pool := ipPool{ranges: map[string][]ipRange{}, cursors: map[string]*ipCursor{}}
+
+	ranges := func(v interface{}) ([]ipRange, error) {
+		var l []interface{}
+		switch v := v.(type) {
+		case string:
+			l = []interface{}{v}
+		case []interface{}:
+			l = v
+		default:
+			return nil, fmt.Errorf("expected a range of addresses, or a list of them")
+		}
+
+		rr := []ipRange{}
+		for _, s := range l {
+			s, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a range of addresses, or a list of them")
+			}
+			r, err := parseIPRange(s)
+			if err != nil {
+				return nil, err
+			}
+			rr = append(rr, r)
+		}
+		return rr, nil
+	}
+
+	if m, ok := v.(map[interface{}]interface{}); ok {
+		for k, v := range m {
+			az := fmt.Sprintf("%v", k)
+			rr, err := ranges(v)
+			if err != nil {
+				return pool, fmt.Errorf("AZ %s: %s", az, err)
+			}
+			pool.azs = append(pool.azs, az)
+			pool.ranges[az] = rr
+		}
+		sort.Strings(pool.azs)
+		return pool, nil
+	}
+
+	rr, err := ranges(v)
+	if err != nil {
+		return pool, err
+	}
+	pool.azs = []string{""}
+	pool.ranges[""] = rr
+	return pool, nil
+}
+
+// next returns the first address in the AZ that has not been claimed yet.
+// Since the caller claims it, the search for the one after it carries on
+// from there, instead of starting over at the beginning of the AZ.
+func (p ipPool) next(az string) (string, bool) {
+	c, ok := p.cursors[az]
+	if !ok {
+		c = &ipCursor{}
+		p.cursors[az] = c
+	}
+
+	one := big.NewInt(1)
+	for rr := p.ranges[az]; c.r < len(rr); c.r, c.n = c.r+1, nil {
+		if c.n == nil {
+			c.n = new(big.Int).Set(rr[c.r].first)
+		}
+		for ; c.n.Cmp(rr[c.r].last) <= 0; c.n.Add(c.n, one) {
+			ip := intToIP(c.n, rr[c.r].length).String()
+			if _, taken := UsedIPs[ip]; !taken {
+				c.n.Add(c.n, one)
+				return ip, true
+			}
+		}
+	}
+	return "", false
+}
+
+// allocate claims count addresses for owner, taking them from each AZ in
+// turn, and skipping over AZs that have run out
+func (p ipPool) allocate(count int, owner string) ([]interface{}, bool) {
+	ips := []interface{}{}
+	exhausted := map[string]bool{}
+	for i := 0; len(ips) < count; i++ {
+		if len(exhausted) == len(p.azs) {
+			return ips, false
+		}
+		az := p.azs[i%len(p.azs)]
+		if exhausted[az] {
+			continue
+		}
+		ip, ok := p.next(az)
+		if !ok {
+			exhausted[az] = true
+			continue
+		}
+		DEBUG("  claiming %s (from AZ '%s') for %s", ip, az, owner)
+		UsedIPs[ip] = owner
+		ips = append(ips, ip)
+	}
+	return ips, true
+}
+
+// IPAllocOperator is invoked with (( ip-alloc <pool> <count> <key> ))
+type IPAllocOperator struct{}
+
+// Setup ...
+func (IPAllocOperator) Setup() error {
+	UsedIPs = map[string]string{}
+	ipAllocations = map[string]ipAllocation{}
+	return nil
+}
+
+// Phase ...
+func (IPAllocOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (IPAllocOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (IPAllocOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( ip-alloc ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( ip-alloc ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 3 {
+		return nil, ansi.Errorf("@R{ip-alloc operator requires exactly three arguments: a pool, a count, and a key}")
+	}
+
+	v, err := resolveOperand(ev, "ip-alloc", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	pool, err := parseIPPool(v)
+	if err != nil {
+		DEBUG("  %s is not a valid IP pool: %s", args[0], err)
+		return nil, ansi.Errorf("@c{%s} @R{is not a valid IP pool:} %s", args[0], err)
+	}
+	count, err := resolveIntOperand(ev, "ip-alloc", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, ansi.Errorf("@R{ip-alloc cannot allocate a negative number of addresses}")
+	}
+	key, err := resolveStringOperand(ev, "ip-alloc", 2, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if prev, ok := ipAllocations[key]; ok {
+		if prev.pool != args[0].String() || prev.count != count {
+			return nil, ansi.Errorf("@R{ip-alloc key} @c{%s} @R{was already used to allocate %d addresses from} @c{%s}", key, prev.count, prev.pool)
+		}
+		DEBUG("  key %s was already allocated %v", key, prev.ips)
+		return &Response{
+			Type:  Replace,
+			Value: prev.ips,
+		}, nil
+	}
+
+	ips, ok := pool.allocate(count, key)
+	if !ok {
+		DEBUG("  pool %s ran out of addresses after %d of %d\n", args[0], len(ips), count)
+		for _, ip := range ips {
+			delete(UsedIPs, ip.(string))
+		}
+		return nil, ansi.Errorf("@R{IP pool} @c{%s} @R{does not have} @c{%d} @R{free addresses left for} @c{%s}", args[0], count, key)
+	}
+	ipAllocations[key] = ipAllocation{pool: args[0].String(), count: count, ips: ips}
+
+	return &Response{
+		Type:  Replace,
+		Value: ips,
+	}, nil
+}
+
+func init() {
+	RegisterOp("ip-alloc", IPAllocOperator{})
+}
@@ -0,0 +1,124 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("(( ip-alloc ... ))", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	It("allocates unique addresses across the document", func() {
+		t, err := run(`
+pools:
+  lb: [ 10.0.0.10 - 10.0.0.12, 10.0.0.20 ]
+services:
+  api:
+    ips: (( ip-alloc pools.lb 2 "api" ))
+  web:
+    ips: (( ip-alloc pools.lb 2 "web" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		api := t["services"].(map[interface{}]interface{})["api"].(map[interface{}]interface{})
+		web := t["services"].(map[interface{}]interface{})["web"].(map[interface{}]interface{})
+		Expect(api["ips"]).To(Equal([]interface{}{"10.0.0.10", "10.0.0.11"}))
+		Expect(web["ips"]).To(Equal([]interface{}{"10.0.0.12", "10.0.0.20"}))
+	})
+
+	It("hands back the same addresses for the same key", func() {
+		t, err := run(`
+pool: 10.0.0.0/30
+a: (( ip-alloc pool 2 "vms" ))
+b: (( ip-alloc pool 2 "vms" ))
+c: (( ip-alloc pool 1 "other" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["a"]).To(Equal([]interface{}{"10.0.0.0", "10.0.0.1"}))
+		Expect(t["b"]).To(Equal(t["a"]))
+		Expect(t["c"]).To(Equal([]interface{}{"10.0.0.2"}))
+
+		_, err = run(`
+pool: 10.0.0.0/30
+a: (( ip-alloc pool 2 "vms" ))
+b: (( ip-alloc pool 3 "vms" ))
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("ip-alloc key vms was already used to allocate 2 addresses from pool"))
+	})
+
+	It("spreads allocations across AZs", func() {
+		t, err := run(`
+pool:
+  z2: 10.0.2.10 - 10.0.2.11
+  z1: [ 10.0.1.10 ]
+  z3: [ "fd00::a - fd00::c" ]
+vms: (( ip-alloc pool 6 "vms" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["vms"]).To(Equal([]interface{}{
+			"10.0.1.10", "10.0.2.10", "fd00::a",
+			"10.0.2.11", "fd00::b", "fd00::c",
+		}))
+	})
+
+	It("does not hand out addresses taken by (( static_ips ))", func() {
+		t, err := run(`
+networks:
+- name: net
+  subnets:
+  - static: [ 10.0.0.10 - 10.0.0.20 ]
+instance_groups:
+- name: web
+  instances: 2
+  networks:
+  - name: net
+    static_ips: (( static_ips 0 1 ))
+zz:
+  extra: (( ip-alloc networks.net.subnets.0.static 1 "extra" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["zz"].(map[interface{}]interface{})["extra"]).To(Equal([]interface{}{"10.0.0.12"}))
+	})
+
+	It("allocates large numbers of addresses from large pools", func() {
+		t, err := run(`
+pool: 10.0.0.0/8
+a: (( ip-alloc pool 20000 "a" ))
+b: (( ip-alloc pool 2 "b" ))
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t["a"]).To(HaveLen(20000))
+		Expect(t["a"].([]interface{})[19999]).To(Equal("10.0.78.31"))
+		Expect(t["b"]).To(Equal([]interface{}{"10.0.78.32", "10.0.78.33"}))
+	})
+
+	It("fails when the pool runs out of addresses", func() {
+		_, err := run(`
+pool: [ 10.0.0.1 - 10.0.0.2 ]
+a: (( ip-alloc pool 2 "a" ))
+b: (( ip-alloc pool 1 "b" ))
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("IP pool pool does not have 1 free addresses left for b"))
+	})
+
+	It("refuses pools that are not ranges of addresses", func() {
+		_, err := run(`
+pool: [ 10.0.0.9 - 10.0.0.1 ]
+a: (( ip-alloc pool 1 "a" ))
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("pool is not a valid IP pool: 10.0.0.9 - 10.0.0.1 ends before it starts"))
+
+		_, err = run(`
+pool: { z1: { nope: true } }
+a: (( ip-alloc pool 1 "a" ))
+`)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("AZ z1: expected a range of addresses, or a list of them"))
+	})
+})
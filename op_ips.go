@@ -2,10 +2,9 @@ package spruce
 
 import (
 	"fmt"
+	"math/big"
 	"net"
 
-	"github.com/ziutek/utils/netaddr"
-
 	"github.com/starkandwayne/goutils/tree"
 
 	. "github.com/geofffranks/spruce/log"
@@ -56,18 +55,6 @@ func makeInt(val interface{}) int {
 	return num
 }
 
-func netSize(ipnet *net.IPNet) int {
-	ones, bits := ipnet.Mask.Size()
-	return 1 << uint(bits-ones) // #nosec G115 -- bits-ones bounded by net.Mask.Size (0-128)
-}
-
-func abs(n int) int {
-	if n < 0 {
-		return -n
-	}
-	return n
-}
-
 // Run ...
 func (IpsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	DEBUG("running (( ips ... )) operation at $.%s", ev.Here)
@@ -118,41 +105,42 @@ func (IpsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		}
 	}
 
-	start := makeInt(vals[1])
+	start := big.NewInt(int64(makeInt(vals[1])))
 
 	if ipnet != nil {
 		ip = ip.Mask(ipnet.Mask)
-		netsize := netSize(ipnet)
+		netsize := cidrSize(ipnet)
 
-		if abs(start) > netsize {
-			return nil, fmt.Errorf("start index %d exceeds size of subnet %s", start, vals[0])
+		if new(big.Int).Abs(start).Cmp(netsize) > 0 {
+			return nil, fmt.Errorf("start index %s exceeds size of subnet %s", start, vals[0])
 		}
-		if start < 0 {
-			start += netsize
+		if start.Sign() < 0 {
+			start.Add(start, netsize)
 		}
 	}
 
 	if len(args) == 2 {
 		return &Response{
 			Type:  Replace,
-			Value: netaddr.IPAdd(ip, start).String(),
+			Value: ipAdd(ip, start).String(),
 		}, nil
-	} else {
-		count := makeInt(vals[2])
-		if ipnet != nil {
-			if start+count > netSize(ipnet) {
-				return nil, fmt.Errorf("start index %d and count %d would exceed size of subnet %s", start, count, vals[0])
-			}
-		}
-		lst := []interface{}{}
-		for i := start; i < start+count; i++ {
-			lst = append(lst, netaddr.IPAdd(ip, i).String())
+	}
+
+	count := makeInt(vals[2])
+	if ipnet != nil {
+		end := new(big.Int).Add(start, big.NewInt(int64(count)))
+		if end.Cmp(cidrSize(ipnet)) > 0 {
+			return nil, fmt.Errorf("start index %s and count %d would exceed size of subnet %s", start, count, vals[0])
 		}
-		return &Response{
-			Type:  Replace,
-			Value: lst,
-		}, nil
 	}
+	lst := []interface{}{}
+	for i := 0; i < count; i++ {
+		lst = append(lst, ipAdd(ip, new(big.Int).Add(start, big.NewInt(int64(i)))).String())
+	}
+	return &Response{
+		Type:  Replace,
+		Value: lst,
+	}, nil
 }
 
 func init() {
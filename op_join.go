@@ -50,6 +50,11 @@ func (JoinOperator) Dependencies(ev *Evaluator, args []*Expr, _ []*tree.Cursor,
 			DEBUG("Could not resolve to a canonical path '%s'", arg.String())
 			return []*tree.Cursor{}
 		}
+		//wildcard references resolve to literal lists, and were already
+		//expanded into the auto-generated deps
+		if finalCursor.Type == Literal {
+			continue
+		}
 		//get the list at this location
 		list, err := finalCursor.Reference.Resolve(ev.Tree)
 		if err != nil {
@@ -107,6 +112,7 @@ func (JoinOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 
 	var separator string
 	var list []string
+	var ok bool
 
 	for i, arg := range args {
 		if i == 0 { // argument #0: separator
@@ -121,8 +127,12 @@ func (JoinOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 				return nil, fmt.Errorf("join operator only accepts literal argument for the separator")
 			}
 
+			separator, ok = sep.Literal.(string)
+			if !ok {
+				DEBUG("     [%d]: unsupported type for join operator separator argument: '%v'", i, sep)
+				return nil, fmt.Errorf("join operator only accepts a string for the separator")
+			}
 			DEBUG("     [%d]: list separator will be: %s", i, sep)
-			separator = sep.Literal.(string)
 
 		} else { // argument #1..n: list, or literal
 			ref, err := arg.Resolve(ev.Tree)
@@ -131,49 +141,50 @@ func (JoinOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 				return nil, err
 			}
 
+			var s interface{}
 			switch ref.Type {
 			case Literal:
 				DEBUG("     [%d]: adding literal %s to the list", i, ref)
-				list = append(list, fmt.Sprintf("%v", ref.Literal))
+				s = ref.Literal
 
 			case Reference:
 				DEBUG("     [%d]: trying to resolve reference $.%s", i, ref.Reference)
-				s, err := ref.Reference.Resolve(ev.Tree)
+				s, err = ref.Reference.Resolve(ev.Tree)
 				if err != nil {
 					DEBUG("     [%d]: resolution failed with error: %s", i, err)
 					return nil, fmt.Errorf("unable to resolve `%s`: %s", ref.Reference, err)
 				}
 
-				switch s.(type) {
-				case []interface{}:
-					DEBUG("     [%d]: $.%s is a list", i, ref.Reference)
-					for idx, entry := range s.([]interface{}) {
-						switch entry.(type) {
-						case []interface{}:
-							DEBUG("     [%d]: entry #%d in list is a list (not a literal)", i, idx)
-							return nil, ansi.Errorf("entry #%d in list is not compatible for @c{(( join ... ))}", idx)
-
-						case map[interface{}]interface{}:
-							DEBUG("     [%d]: entry #%d in list is a map (not a literal)", i, idx)
-							return nil, ansi.Errorf("entry #%d in list is not compatible for @c{(( join ... ))}", idx)
-
-						default:
-							list = append(list, fmt.Sprintf("%v", entry))
-						}
-					}
-
-				case map[interface{}]interface{}:
-					DEBUG("     [%d]: $.%s is a map (not a list or a literal)", i, ref.Reference)
-					return nil, ansi.Errorf("referenced entry is not a list or string for @c{(( join ... ))}")
+			default:
+				DEBUG("     [%d]: unsupported type for join operator: '%v'", i, ref)
+				return nil, fmt.Errorf("join operator only lists with string entries, and literals as data arguments")
+			}
 
-				default:
-					DEBUG("     [%d]: $.%s is a literal", i, ref.Reference)
-					list = append(list, fmt.Sprintf("%v", s))
+			switch s.(type) {
+			case []interface{}:
+				DEBUG("     [%d]: %s is a list", i, arg)
+				for idx, entry := range s.([]interface{}) {
+					switch entry.(type) {
+					case []interface{}:
+						DEBUG("     [%d]: entry #%d in list is a list (not a literal)", i, idx)
+						return nil, ansi.Errorf("entry #%d in list is not compatible for @c{(( join ... ))}", idx)
+
+					case map[interface{}]interface{}:
+						DEBUG("     [%d]: entry #%d in list is a map (not a literal)", i, idx)
+						return nil, ansi.Errorf("entry #%d in list is not compatible for @c{(( join ... ))}", idx)
+
+					default:
+						list = append(list, fmt.Sprintf("%v", entry))
+					}
 				}
 
+			case map[interface{}]interface{}:
+				DEBUG("     [%d]: %s is a map (not a list or a literal)", i, arg)
+				return nil, ansi.Errorf("referenced entry is not a list or string for @c{(( join ... ))}")
+
 			default:
-				DEBUG("     [%d]: unsupported type for join operator: '%v'", i, ref)
-				return nil, fmt.Errorf("join operator only lists with string entries, and literals as data arguments")
+				DEBUG("     [%d]: %s is a literal", i, arg)
+				list = append(list, fmt.Sprintf("%v", s))
 			}
 		}
 	}
@@ -0,0 +1,78 @@
+package spruce
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// LengthOperator is invoked with (( length <list|map|string> )), and
+// returns the number of entries in a list or map, or the number of
+// characters in a string.
+type LengthOperator struct{}
+
+// Setup ...
+func (LengthOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (LengthOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (LengthOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (LengthOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( length ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( length ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("length operator requires exactly one argument")
+	}
+
+	s, err := resolveOperand(ev, "length", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch s := s.(type) {
+	case []interface{}:
+		DEBUG("     [0]: resolved to a list of %d entries", len(s))
+		n = len(s)
+
+	case map[interface{}]interface{}:
+		DEBUG("     [0]: resolved to a map of %d keys", len(s))
+		n = len(s)
+
+	case string:
+		n = utf8.RuneCountInString(s)
+		DEBUG("     [0]: resolved to a string of %d characters", n)
+
+	case nil:
+		DEBUG("     [0]: resolved to null")
+		n = 0
+
+	default:
+		DEBUG("     [0]: resolved to a scalar that has no length")
+		return nil, ansi.Errorf("@c{%s} @R{is not a list, map or string}", args[0])
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: n,
+	}, nil
+}
+
+func init() {
+	RegisterOp("length", LengthOperator{})
+}
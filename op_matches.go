@@ -0,0 +1,64 @@
+package spruce
+
+import (
+	"fmt"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// MatchesOperator is invoked with (( matches <regex> <string> )), and
+// returns true if the regular expression matches (any part of) the string
+type MatchesOperator struct{}
+
+// Setup ...
+func (MatchesOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (MatchesOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (MatchesOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (MatchesOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( matches ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( matches ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("matches operator requires exactly two arguments: a regular expression, and the string to match it against")
+	}
+
+	pattern, err := resolveStringOperand(ev, "matches", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := resolveStringOperand(ev, "matches", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := compileOperandRegexp("matches", pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := re.MatchString(s)
+	DEBUG("  /%s/ matches '%s'? %v", pattern, s, matched)
+
+	return &Response{
+		Type:  Replace,
+		Value: matched,
+	}, nil
+}
+
+func init() {
+	RegisterOp("matches", MatchesOperator{})
+}
@@ -0,0 +1,77 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// MergeMapsOperator is invoked with (( merge-maps <map> <map>... )), and
+// deep-merges the given maps together.  Later maps take precedence; nested
+// maps are merged recursively, and everything else (including lists) is
+// replaced outright.
+type MergeMapsOperator struct{}
+
+// Setup ...
+func (MergeMapsOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (MergeMapsOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (MergeMapsOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+func mergeMaps(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[interface{}]interface{}); ok {
+			if existing, ok := dst[k].(map[interface{}]interface{}); ok {
+				mergeMaps(existing, sub)
+				continue
+			}
+		}
+		dst[k] = deepCopy(v)
+	}
+}
+
+// Run ...
+func (MergeMapsOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( merge-maps ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( merge-maps ... )) operation at $%s\n", ev.Here)
+
+	if len(args) == 0 {
+		DEBUG("  no arguments supplied to (( merge-maps ... )) operation.  oops.")
+		return nil, ansi.Errorf("no arguments specified to @c{(( merge-maps ... ))}")
+	}
+
+	merged := map[interface{}]interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, "merge-maps", i, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := s.(map[interface{}]interface{})
+		if !ok {
+			DEBUG("     [%d]: resolved to something that is not a map.  that is unacceptable.", i)
+			return nil, ansi.Errorf("@c{%s} @R{is not a map}", arg)
+		}
+		DEBUG("     [%d]: merging %d keys on top of the result", i, len(m))
+		mergeMaps(merged, m)
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: merged,
+	}, nil
+}
+
+func init() {
+	RegisterOp("merge-maps", MergeMapsOperator{})
+}
@@ -0,0 +1,61 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// NowOperator is invoked with (( now [format] )), and returns the current
+// time, or the time pinned by --now or $SOURCE_DATE_EPOCH
+type NowOperator struct{}
+
+// Setup ...
+func (NowOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (NowOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (NowOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (NowOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( now ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( now ... )) operation at $%s\n", ev.Here)
+
+	if len(args) > 1 {
+		return nil, ansi.Errorf("@R{now operator takes at most one argument, the format of the time}")
+	}
+
+	layout := "RFC3339"
+	if len(args) == 1 {
+		var err error
+		layout, err = resolveStringOperand(ev, "now", 0, args[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := currentTime()
+	if err != nil {
+		return nil, err
+	}
+	DEBUG("  the time is now %s", t)
+
+	return &Response{
+		Type:  Replace,
+		Value: formatTime(t, layout),
+	}, nil
+}
+
+func init() {
+	RegisterOp("now", NowOperator{})
+}
@@ -0,0 +1,70 @@
+package spruce
+
+import (
+	"fmt"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// ParseOperator is invoked with (( json-parse <string> )) or
+// (( yaml-parse <string> )), and parses the string back into whatever
+// data structure it represents
+type ParseOperator struct {
+	variant string
+}
+
+// Setup ...
+func (ParseOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (ParseOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (ParseOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (o ParseOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( %s ... )) operation at $.%s", o.variant, ev.Here)
+	defer DEBUG("done with (( %s ... )) operation at $%s\n", o.variant, ev.Here)
+
+	format := "JSON"
+	if o.variant == "yaml-parse" {
+		format = "YAML"
+	}
+
+	strs, err := encodingArgs(ev, o.variant, "parse "+format+" from", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var val interface{}
+	if o.variant == "json-parse" {
+		val, err = decodeJSON([]byte(strs[0]))
+	} else {
+		err = yaml.Unmarshal([]byte(strs[0]), &val)
+	}
+	if err != nil {
+		DEBUG("  unable to parse '%s' as %s: %s", strs[0], format, err)
+		return nil, fmt.Errorf("unable to parse %s: %s", format, err)
+	}
+	DEBUG("  parsed %s into a value (could be a map, a list or a scalar)", format)
+
+	return &Response{
+		Type:  Replace,
+		Value: val,
+	}, nil
+}
+
+func init() {
+	RegisterOp("json-parse", ParseOperator{variant: "json-parse"})
+	RegisterOp("yaml-parse", ParseOperator{variant: "yaml-parse"})
+}
@@ -0,0 +1,159 @@
+package spruce
+
+import (
+	"fmt"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// QueryOperator ...
+type QueryOperator struct{}
+
+// Setup ...
+func (QueryOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (QueryOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// parseQueryArgs pulls the query expression (a literal string, or a
+// reference to one) and the optional result mode out of the arguments.
+func parseQueryArgs(ev *Evaluator, args []*Expr) (*Query, string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, "", ansi.Errorf("@R{query operator requires a query expression, and an optional mode}")
+	}
+
+	v, err := args[0].Resolve(ev.Tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var src interface{}
+	switch v.Type {
+	case Literal:
+		src = v.Literal
+
+	case Reference:
+		src, err = v.Reference.Resolve(ev.Tree)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to resolve `%s`: %s", v.Reference, err)
+		}
+
+	default:
+		return nil, "", fmt.Errorf("query operator only accepts literal and key reference arguments")
+	}
+
+	s, ok := src.(string)
+	if !ok {
+		return nil, "", ansi.Errorf("@R{query expression must be a string}")
+	}
+	q, err := ParseQuery(s)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mode := ""
+	if len(args) == 2 {
+		if args[1].Type != Literal {
+			return nil, "", ansi.Errorf("@R{query mode must be a literal} @c{\"first\"} @R{or} @c{\"all\"}")
+		}
+		mode = fmt.Sprintf("%v", args[1].Literal)
+		if mode != "first" && mode != "all" {
+			return nil, "", ansi.Errorf("@R{unknown query mode} @c{%s} @R{(expected} @c{\"first\"} @R{or} @c{\"all\"}@R{)}", mode)
+		}
+	}
+	return q, mode, nil
+}
+
+// Dependencies runs the query with every filter matching, and returns
+// all of the nodes it could possibly match, everything the filters look
+// at, and any operators that stand in the way of walking the query path.
+func (QueryOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	l := auto
+
+	q, _, err := parseQueryArgs(ev, args)
+	if err != nil {
+		DEBUG("unable to determine (( query )) dependencies: %s", err)
+		return l
+	}
+
+	here := ""
+	if ev.Here != nil {
+		if canon, err := ev.Here.Canonical(ev.Tree); err == nil {
+			here = canon.String()
+		}
+	}
+
+	add := func(path []string, under bool) {
+		c := &tree.Cursor{Nodes: path}
+		if c.String() == here {
+			return
+		}
+		l = append(l, c)
+		if !under {
+			return
+		}
+		for _, other := range locs {
+			if other.Under(c) {
+				l = append(l, other)
+			}
+		}
+	}
+
+	qe := &queryEval{root: ev.Tree, conservative: true}
+	for _, n := range qe.apply([]queryNode{{path: []string{}, value: ev.Tree}}, q.segments) {
+		add(n.path, true)
+	}
+	for _, path := range qe.reads {
+		add(path, true)
+	}
+	for _, path := range qe.deadEnds {
+		add(path, false)
+	}
+	return l
+}
+
+// Run ...
+func (QueryOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( query ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( query ... )) operation at $%s\n", ev.Here)
+
+	q, mode, err := parseQueryArgs(ev, args)
+	if err != nil {
+		return nil, err
+	}
+
+	DEBUG("  evaluating query `%s`", q)
+	results := q.Run(ev.Tree)
+	DEBUG("  query matched %d node(s)", len(results))
+
+	if mode == "first" || (mode == "" && q.Definite()) {
+		if len(results) == 0 {
+			return nil, ansi.Errorf("@R{query} @c{%s} @R{did not match anything}", q)
+		}
+		return &Response{
+			Type:  Replace,
+			Value: results[0].Value,
+		}, nil
+	}
+
+	vals := []interface{}{}
+	for _, r := range results {
+		DEBUG("    matched $.%s", r.Path)
+		vals = append(vals, r.Value)
+	}
+	return &Response{
+		Type:  Replace,
+		Value: vals,
+	}, nil
+}
+
+func init() {
+	RegisterOp("query", QueryOperator{})
+}
@@ -0,0 +1,187 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query", func() {
+	doc := `
+jobs:
+  - name: web
+    instances: 2
+    networks:
+      - name: default
+        ip: 10.0.0.5
+      - name: public
+        ip: 1.2.3.4
+  - name: smoke-tests
+    lifecycle: errand
+    instances: 1
+    networks:
+      - name: default
+        ip: 10.0.0.6
+  - name: db
+    instances: 3
+    networks:
+      - name: default
+        ip: 10.0.0.7
+meta:
+  net: public
+`
+
+	query := func(src string) []interface{} {
+		q, err := ParseQuery(src)
+		Expect(err).NotTo(HaveOccurred())
+		vals := []interface{}{}
+		for _, r := range q.Run(evalYAML(doc)) {
+			vals = append(vals, r.Value)
+		}
+		return vals
+	}
+
+	paths := func(src string) []string {
+		q, err := ParseQuery(src)
+		Expect(err).NotTo(HaveOccurred())
+		l := []string{}
+		for _, r := range q.Run(evalYAML(doc)) {
+			l = append(l, r.Path.String())
+		}
+		return l
+	}
+
+	Describe("paths", func() {
+		It("follows keys, indices and list entry names", func() {
+			Expect(query("$.jobs[0].name")).To(Equal([]interface{}{"web"}))
+			Expect(query("jobs.db.instances")).To(Equal([]interface{}{3}))
+			Expect(query("$['jobs'][-1]['name']")).To(Equal([]interface{}{"db"}))
+			Expect(paths("$.jobs.web.networks.public")).To(Equal([]string{"jobs.0.networks.1"}))
+		})
+
+		It("supports wildcards, unions and slices", func() {
+			Expect(query("$.jobs[*].name")).To(Equal([]interface{}{"web", "smoke-tests", "db"}))
+			Expect(query("$.jobs.*.instances")).To(Equal([]interface{}{2, 1, 3}))
+			Expect(query("$.jobs[0,2].name")).To(Equal([]interface{}{"web", "db"}))
+			Expect(query("$.jobs[1:].name")).To(Equal([]interface{}{"smoke-tests", "db"}))
+			Expect(query("$.jobs[::-2].name")).To(Equal([]interface{}{"db", "web"}))
+		})
+
+		It("supports recursive descent", func() {
+			Expect(query("$..ip")).To(Equal([]interface{}{"10.0.0.5", "1.2.3.4", "10.0.0.6", "10.0.0.7"}))
+			Expect(query("$.jobs[0]..[0].ip")).To(Equal([]interface{}{"10.0.0.5"}))
+		})
+
+		It("knows which queries are definite", func() {
+			for src, definite := range map[string]bool{
+				"$.jobs[0].name":        true,
+				"jobs.web['instances']": true,
+				"$.jobs[*].name":        false,
+				"$..name":               false,
+				"$.jobs[0,1]":           false,
+				"$.jobs[?(@.name)]":     false,
+			} {
+				q, err := ParseQuery(src)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(q.Definite()).To(Equal(definite), src)
+			}
+		})
+	})
+
+	Describe("filters", func() {
+		It("compares strings and numbers", func() {
+			Expect(query("$.jobs[?(@.lifecycle == 'errand')].name")).To(Equal([]interface{}{"smoke-tests"}))
+			Expect(query("$.jobs[?(@.instances >= 2)].name")).To(Equal([]interface{}{"web", "db"}))
+			Expect(query("$.jobs[?(@.instances != 2.0)].name")).To(Equal([]interface{}{"smoke-tests", "db"}))
+		})
+
+		It("tests for existence, and supports boolean logic", func() {
+			Expect(query("$.jobs[?(@.lifecycle)].name")).To(Equal([]interface{}{"smoke-tests"}))
+			Expect(query("$.jobs[?(!@.lifecycle)].name")).To(Equal([]interface{}{"web", "db"}))
+			Expect(query("$.jobs[?(@.instances > 1 && (@.name == 'db' || @.name == 'nope'))].name")).To(Equal([]interface{}{"db"}))
+		})
+
+		It("matches regular expressions", func() {
+			Expect(query("$.jobs[?(@.name =~ /^SMOKE/i)].name")).To(Equal([]interface{}{"smoke-tests"}))
+			Expect(query("$..networks[?(@.ip =~ '^10\\.')].ip")).To(Equal([]interface{}{"10.0.0.5", "10.0.0.6", "10.0.0.7"}))
+		})
+
+		It("can reference the root of the document", func() {
+			Expect(query("$.jobs[*].networks[?(@.name == $.meta.net)].ip")).To(Equal([]interface{}{"1.2.3.4"}))
+		})
+	})
+
+	It("rejects malformed queries", func() {
+		for _, src := range []string{"$.", "$.jobs[", "$.jobs[?(@.x ==)]", "$.jobs[?(@.x =~ '(')]", "$.a b"} {
+			_, err := ParseQuery(src)
+			Expect(err).To(HaveOccurred(), src)
+		}
+	})
+
+	Describe("(( query ... ))", func() {
+		run := func(yml string) (map[interface{}]interface{}, error) {
+			ev := &Evaluator{Tree: evalYAML(yml)}
+			err := ev.RunPhase(EvalPhase)
+			return ev.Tree, err
+		}
+
+		It("returns a single value for definite queries, and a list otherwise", func() {
+			t, err := run(doc + `
+first: (( query "jobs[0].name" ))
+errands: (( query "$.jobs[?(@.lifecycle == 'errand')].name" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["first"]).To(Equal("web"))
+			Expect(t["errands"]).To(Equal([]interface{}{"smoke-tests"}))
+		})
+
+		It("can be asked for the first match, or all matches", func() {
+			t, err := run(doc + `
+ip:   (( query "$.jobs.web.networks[?(@.name == 'default')].ip" "first" ))
+list: (( query "jobs[0].name" "all" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["ip"]).To(Equal("10.0.0.5"))
+			Expect(t["list"]).To(Equal([]interface{}{"web"}))
+		})
+
+		It("fails when a single value was expected and nothing matched", func() {
+			_, err := run(doc + `x: (( query "$.jobs[?(@.name == 'nope')]" "first" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("did not match anything"))
+
+			t, err := run(doc + `x: (( query "$.jobs[?(@.name == 'nope')]" ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal([]interface{}{}))
+		})
+
+		It("evaluates operators the query depends on first", func() {
+			t, err := run(`
+a_errands: (( query "$.jobs[?(@.lifecycle == 'errand')].name" ))
+a_count:   (( query "$..[?(@.name == $.meta.job)].instances" "first" ))
+jobs:
+  - name: (( concat "smoke" "-tests" ))
+    lifecycle: (( grab meta.lifecycle ))
+  - name: web
+    instances: (( grab meta.instances ))
+meta:
+  job: (( concat "w" "eb" ))
+  lifecycle: errand
+  instances: 4
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a_errands"]).To(Equal([]interface{}{"smoke-tests"}))
+			Expect(t["a_count"]).To(Equal(4))
+		})
+
+		It("does not depend on itself", func() {
+			t, err := run(`
+names: (( query "$..name" ))
+things:
+  - name: a
+  - name: b
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["names"]).To(Equal([]interface{}{"a", "b"}))
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// randomCharsets are the named character sets that (( random-string ))
+// understands; anything else is taken as the literal set of characters
+// to draw from.
+var randomCharsets = map[string]string{
+	"alnum":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits": "0123456789",
+	"hex":    "0123456789abcdef",
+}
+
+// RandomStringOperator is invoked with (( random-string <length> [charset] ))
+type RandomStringOperator struct{}
+
+// Setup ...
+func (RandomStringOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (RandomStringOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (RandomStringOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (RandomStringOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( random-string ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( random-string ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ansi.Errorf("@R{random-string operator requires a length, and an optional character set}")
+	}
+
+	length, err := resolveIntOperand(ev, "random-string", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, ansi.Errorf("@c{(( random-string ))} @R{cannot generate a string of negative length} @c{%d}", length)
+	}
+
+	charset := randomCharsets["alnum"]
+	if len(args) == 2 {
+		charset, err = resolveStringOperand(ev, "random-string", 1, args[1])
+		if err != nil {
+			return nil, err
+		}
+		if named, ok := randomCharsets[charset]; ok {
+			charset = named
+		}
+	}
+	chars := []rune(charset)
+	if len(chars) == 0 {
+		return nil, ansi.Errorf("@c{(( random-string ))} @R{requires a non-empty character set}")
+	}
+
+	r := randFor(ev, "random-string")
+	s := make([]rune, length)
+	for i := range s {
+		s[i] = chars[r.IntN(len(chars))]
+	}
+	DEBUG("  generated a %d-character random string", length)
+
+	return &Response{
+		Type:  Replace,
+		Value: string(s),
+	}, nil
+}
+
+func init() {
+	RegisterOp("random-string", RandomStringOperator{})
+}
@@ -0,0 +1,142 @@
+package spruce
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Randomizing Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	doc := `
+list: [a, b, c, d, e, f, g, h]
+s1: (( shuffle list ))
+s2: (( shuffle list ))
+p1: (( random-string 24 ))
+p2: (( random-string 24 ))
+u1: (( uuid ))
+u2: (( uuid ))
+`
+
+	AfterEach(func() {
+		Seed = ""
+		os.Unsetenv("SPRUCE_SEED")
+	})
+
+	Context("under a seed", func() {
+		It("produces the same output on every run", func() {
+			Seed = "s3cr3t"
+			first, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).To(Equal(first))
+		})
+
+		It("gives every call site its own values", func() {
+			Seed = "s3cr3t"
+			t, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["s1"]).NotTo(Equal(t["s2"]))
+			Expect(t["p1"]).NotTo(Equal(t["p2"]))
+			Expect(t["u1"]).NotTo(Equal(t["u2"]))
+		})
+
+		It("does not disturb other call sites when one is added", func() {
+			Seed = "s3cr3t"
+			before, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			after, err := run(doc + "p0: (( random-string 24 ))\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after["p1"]).To(Equal(before["p1"]))
+			Expect(after["s2"]).To(Equal(before["s2"]))
+		})
+
+		It("does not disturb named list entries when one is inserted before them", func() {
+			Seed = "s3cr3t"
+			before, err := run("jobs:\n- name: web\n  password: (( random-string 24 ))\n")
+			Expect(err).NotTo(HaveOccurred())
+			after, err := run("jobs:\n- name: db\n  password: (( random-string 24 ))\n- name: web\n  password: (( random-string 24 ))\n")
+			Expect(err).NotTo(HaveOccurred())
+
+			web := before["jobs"].([]interface{})[0].(map[interface{}]interface{})
+			Expect(after["jobs"].([]interface{})[1]).To(HaveKeyWithValue("password", web["password"]))
+		})
+
+		It("can be given via $SPRUCE_SEED", func() {
+			os.Setenv("SPRUCE_SEED", "s3cr3t")
+			fromEnv, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+
+			os.Unsetenv("SPRUCE_SEED")
+			Seed = "s3cr3t"
+			fromVar, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fromEnv).To(Equal(fromVar))
+
+			Seed = "other"
+			other, err := run(doc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other["u1"]).NotTo(Equal(fromVar["u1"]))
+		})
+	})
+
+	Describe("(( random-string ... ))", func() {
+		It("draws from named or literal character sets", func() {
+			t, err := run(`
+a: (( random-string 32 ))
+b: (( random-string 32 "hex" ))
+c: (( random-string 10 "xy" ))
+d: (( random-string 0 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(MatchRegexp(`^[A-Za-z0-9]{32}$`))
+			Expect(t["b"]).To(MatchRegexp(`^[0-9a-f]{32}$`))
+			Expect(t["c"]).To(MatchRegexp(`^[xy]{10}$`))
+			Expect(t["d"]).To(Equal(""))
+		})
+
+		It("rejects bad lengths", func() {
+			_, err := run(`x: (( random-string -1 ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot generate a string of negative length"))
+
+			_, err = run(`x: (( random-string "ten" ))`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("(( uuid ))", func() {
+		It("generates version 4 UUIDs", func() {
+			t, err := run(`x: (( uuid ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		})
+	})
+
+	Describe("(( uuid-v5 ... ))", func() {
+		It("generates name-based UUIDs", func() {
+			t, err := run(`
+meta:
+  host: example.com
+a: (( uuid-v5 "dns" meta.host ))
+b: (( uuid-v5 "6ba7b810-9dad-11d1-80b4-00c04fd430c8" "example.com" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("cfbff0d1-9375-5685-968c-48ce8b15ae17"))
+			Expect(t["b"]).To(Equal(t["a"]))
+		})
+
+		It("rejects invalid namespaces", func() {
+			_, err := run(`x: (( uuid-v5 "nope" "example.com" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("namespace nope is neither a UUID nor one of dns, url, oid or x500"))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package spruce
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// ReplaceOperator is invoked with (( replace <regex> <replacement> <string> )),
+// and replaces every match of the regular expression in the string.  The
+// replacement can refer to capture groups as $1, ${name}, etc.
+//
+// A bare (( replace )), without arguments, is still the array merging
+// directive, and is handled by the Merger rather than this operator.
+type ReplaceOperator struct{}
+
+// Setup ...
+func (ReplaceOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (ReplaceOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (ReplaceOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// compileOperandRegexp compiles a regular expression given to an operator
+func compileOperandRegexp(name string, pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		DEBUG("  invalid regular expression '%s': %s", pattern, err)
+		return nil, ansi.Errorf("@c{(( %s ))} @R{was given an invalid regular expression} @c{\"%s\"}@R{:} %s", name, pattern, err)
+	}
+	return re, nil
+}
+
+// Run ...
+func (ReplaceOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( replace ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( replace ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 3 {
+		return nil, fmt.Errorf("replace operator requires exactly three arguments: a regular expression, a replacement, and the string to replace in")
+	}
+
+	var strs [3]string
+	for i, arg := range args {
+		s, err := resolveStringOperand(ev, "replace", i, arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+
+	re, err := compileOperandRegexp("replace", strs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	s := re.ReplaceAllString(strs[2], strs[1])
+	DEBUG("  resolved (( replace ... )) operation to the string:\n    \"%s\"", s)
+
+	return &Response{
+		Type:  Replace,
+		Value: s,
+	}, nil
+}
+
+func init() {
+	RegisterOp("replace", ReplaceOperator{})
+}
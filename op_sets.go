@@ -0,0 +1,186 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// SetOperator is invoked with (( union <lists>... )), (( intersect <lists>... ))
+// or (( difference <lists>... )), and treats the lists as sets: simple values
+// are the same if they are equal, and maps are the same if they have the
+// same identifier (`name`, or $DEFAULT_ARRAY_MERGE_KEY), or failing that,
+// if they are equal. Entries stay in the order they were first seen.
+type SetOperator struct {
+	variant string
+}
+
+// Setup ...
+func (SetOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (SetOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (SetOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (o SetOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( %s ... )) operation at $.%s", o.variant, ev.Here)
+	defer DEBUG("done with (( %s ... )) operation at $%s\n", o.variant, ev.Here)
+
+	least, lists := 2, "two lists"
+	if o.variant == "union" {
+		least, lists = 1, "one list"
+	}
+	if len(args) < least {
+		DEBUG("  not enough arguments supplied to (( %s ... )) operation.  oops.", o.variant)
+		return nil, ansi.Errorf("@c{(( %s ... ))} @R{needs at least %s}", o.variant, lists)
+	}
+
+	sets := [][]interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, o.variant, i, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		switch s := s.(type) {
+		case []interface{}:
+			DEBUG("     [%d]: resolved to a list", i)
+			sets = append(sets, s)
+
+		case map[interface{}]interface{}:
+			DEBUG("     [%d]: resolved to a map; error!", i)
+			return nil, ansi.Errorf("@c{%s} @R{is a map, not a list}", arg)
+
+		default:
+			DEBUG("     [%d]: resolved to a single value", i)
+			sets = append(sets, []interface{}{s})
+		}
+	}
+
+	key := getDefaultIdentifierKey()
+	var result []interface{}
+	switch o.variant {
+	case "union":
+		result = setUnion(key, sets...)
+	case "intersect":
+		result = setIntersect(key, sets...)
+	case "difference":
+		result = setDifference(key, sets...)
+	}
+	DEBUG("  %s has %d entries", o.variant, len(result))
+
+	return &Response{
+		Type:  Replace,
+		Value: result,
+	}, nil
+}
+
+// sameSetEntry returns true if a and b are the same entry, as far as the set
+// operators are concerned: maps with the same identifier under key, or
+// otherwise equal values.
+func sameSetEntry(a, b interface{}, key string) bool {
+	ma, aIsMap := a.(map[interface{}]interface{})
+	mb, bIsMap := b.(map[interface{}]interface{})
+	if aIsMap && bIsMap {
+		if idA, ok := setEntryIdentity(ma, key); ok {
+			if idB, ok := setEntryIdentity(mb, key); ok {
+				return equalValues(idA, idB)
+			}
+		}
+	}
+	return equalValues(a, b)
+}
+
+// setEntryIdentity returns the identity of a map, if it has a simple value
+// for every field of the key
+func setEntryIdentity(obj map[interface{}]interface{}, key string) (interface{}, bool) {
+	for _, field := range keyFields(key) {
+		v, ok := keyFieldValue(obj, field)
+		if !ok {
+			return nil, false
+		}
+		switch v.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return nil, false
+		}
+	}
+	id, _ := entryIdentity(obj, key)
+	return id, true
+}
+
+func setContains(l []interface{}, v interface{}, key string) bool {
+	for _, x := range l {
+		if sameSetEntry(x, v, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// setUnion returns the distinct entries of all the lists, in the order they
+// were first seen
+func setUnion(key string, lists ...[]interface{}) []interface{} {
+	result := []interface{}{}
+	for _, l := range lists {
+		for _, v := range l {
+			if !setContains(result, v, key) {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// setIntersect returns the distinct entries of the first list that are in
+// all the others
+func setIntersect(key string, lists ...[]interface{}) []interface{} {
+	result := []interface{}{}
+	for _, v := range setUnion(key, lists[0]) {
+		inAll := true
+		for _, l := range lists[1:] {
+			if !setContains(l, v, key) {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// setDifference returns the distinct entries of the first list that are in
+// none of the others
+func setDifference(key string, lists ...[]interface{}) []interface{} {
+	result := []interface{}{}
+	for _, v := range setUnion(key, lists[0]) {
+		inAny := false
+		for _, l := range lists[1:] {
+			if setContains(l, v, key) {
+				inAny = true
+				break
+			}
+		}
+		if !inAny {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func init() {
+	for _, name := range []string{"union", "intersect", "difference"} {
+		RegisterOp(name, SetOperator{variant: name})
+	}
+}
@@ -2,7 +2,7 @@ package spruce
 
 import (
 	"fmt"
-	"math/rand"
+	"math/rand/v2"
 
 	"github.com/starkandwayne/goutils/tree"
 
@@ -43,8 +43,13 @@ func (ShuffleOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 
 		switch v.Type {
 		case Literal:
-			DEBUG("  arg[%d]: found string literal '%s'", i, v.Literal)
-			vals = append(vals, v.Literal)
+			DEBUG("  arg[%d]: found literal '%v'", i, v.Literal)
+			if l, ok := v.Literal.([]interface{}); ok {
+				// wildcard references resolve to a list of their matches
+				vals = append(vals, l...)
+			} else {
+				vals = append(vals, v.Literal)
+			}
 
 		case Reference:
 			DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
@@ -75,7 +80,7 @@ func (ShuffleOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 
 	return &Response{
 		Type:  Replace,
-		Value: shuffle(vals),
+		Value: shuffle(randFor(ev, "shuffle"), vals),
 	}, nil
 }
 
@@ -83,7 +88,7 @@ func init() {
 	RegisterOp("shuffle", ShuffleOperator{})
 }
 
-func shuffle(l []interface{}) []interface{} {
-	rand.Shuffle(len(l), func(i, j int) { l[i], l[j] = l[j], l[i] })
+func shuffle(r *rand.Rand, l []interface{}) []interface{} {
+	r.Shuffle(len(l), func(i, j int) { l[i], l[j] = l[j], l[i] })
 	return l
 }
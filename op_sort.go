@@ -39,13 +39,56 @@ func init() {
 	RegisterOp("sort", SortOperator{})
 }
 
+// sortModifiers are the words that modify the sort key before them (or the
+// entries themselves, in a simple list) rather than naming a key field
+var sortModifiers = map[string]bool{
+	"asc":     true,
+	"desc":    true,
+	"lexical": true,
+	"natural": true,
+	"numeric": true,
+	"semver":  true,
+}
+
+// sortKey is one of the keys that (( sort )) orders a list by, along with its
+// direction and collation (lexical, natural, numeric or semver)
+type sortKey struct {
+	field     string
+	desc      bool
+	collation string
+}
+
 func addToSortListIfNecessary(operator string, path string) {
 	if opcall, err := ParseOpcall(MergePhase, operator); err == nil {
-		var byKey string
-		if len(opcall.args) == 2 {
-			byKey = opcall.args[1].String()
+		// (( sort by name desc, version semver )) parses as separate arguments
+		// for each key field and modifier; modifiers belong to the field before
+		// them, and are recorded after it, e.g. "name desc,version semver"
+		args := opcall.args
+		if len(args) > 0 && args[0].Type == Reference && args[0].Reference.String() == "by" {
+			args = args[1:]
 		}
 
+		var keys []string
+		for _, arg := range args {
+			word, quoted := arg.String(), false
+			if s, ok := arg.Literal.(string); ok && arg.Type == Literal {
+				word, quoted = s, true
+			}
+
+			switch {
+			case quoted && sortModifiers[word]:
+				// (( sort by "desc" )) sorts by a field named desc
+				keys = append(keys, fmt.Sprintf(`"%s"`, word))
+			case !quoted && sortModifiers[word] && len(keys) > 0:
+				keys[len(keys)-1] += " " + word
+			case !quoted && sortModifiers[word]:
+				keys = append(keys, " "+word)
+			default:
+				keys = append(keys, word)
+			}
+		}
+		byKey := strings.Join(keys, ",")
+
 		DEBUG("adding sort by '%s' of path '%s' to the list of paths to sort", byKey, path)
 		if _, ok := pathsToSort[path]; !ok {
 			pathsToSort[path] = byKey
@@ -53,35 +96,82 @@ func addToSortListIfNecessary(operator string, path string) {
 	}
 }
 
-func universalLess(a interface{}, b interface{}, key string) bool {
-	switch a.(type) {
-	case string:
-		return strings.Compare(a.(string), b.(string)) < 0
+// parseSortKeys parses the sort keys recorded by addToSortListIfNecessary.
+// There is always at least one key, although its field may be empty.
+func parseSortKeys(spec string) []sortKey {
+	keys := []sortKey{}
+	for _, part := range strings.Split(spec, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 {
+			continue
+		}
 
-	case float64:
-		return a.(float64) < b.(float64)
+		key := sortKey{collation: "lexical"}
+		if !sortModifiers[words[0]] {
+			key.field = strings.Trim(words[0], `"`)
+			words = words[1:]
+		}
+		for _, word := range words {
+			switch word {
+			case "asc":
+				key.desc = false
+			case "desc":
+				key.desc = true
+			default:
+				key.collation = word
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		keys = append(keys, sortKey{collation: "lexical"})
+	}
+	return keys
+}
 
-	case int:
-		return a.(int) < b.(int)
+// compareSortEntries compares two list entries key by key, only moving on to
+// the next key on a tie
+func compareSortEntries(a interface{}, b interface{}, keys []sortKey) int {
+	for _, key := range keys {
+		valueA, valueB := a, b
+		if entryA, ok := a.(map[interface{}]interface{}); ok {
+			valueA, _ = keyFieldValue(entryA, key.field)
+		}
+		if entryB, ok := b.(map[interface{}]interface{}); ok {
+			valueB, _ = keyFieldValue(entryB, key.field)
+		}
 
-	case map[interface{}]interface{}:
-		entryA, entryB := a.(map[interface{}]interface{}), b.(map[interface{}]interface{})
-		return universalLess(entryA[key], entryB[key], key)
+		c := collate(valueA, valueB, key.collation)
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
 	}
 
-	return false
+	return 0
 }
 
 func sortList(path string, list []interface{}, key string) error {
+	keys := parseSortKeys(key)
+
 	typeCheckMap := map[string]struct{}{}
 	for _, entry := range list {
 		reflectType := reflect.TypeOf(entry)
 
 		var typeName string
-		if reflectType != nil {
-			typeName = reflectType.Kind().String()
-		} else {
+		switch {
+		case reflectType == nil:
 			typeName = "nil"
+		case isSortNumber(entry) && keys[0].collation != "lexical":
+			// the other collations compare numbers and strings alike
+			typeName = reflect.String.String()
+		case isSortNumber(entry):
+			typeName = "number"
+		default:
+			typeName = reflectType.Kind().String()
 		}
 
 		if _, ok := typeCheckMap[typeName]; !ok {
@@ -100,9 +190,14 @@ func sortList(path string, list []interface{}, key string) error {
 	for kind := range typeCheckMap {
 		switch kind {
 		case reflect.Map.String():
-			if key == "" {
-				key = getDefaultIdentifierKey()
+			fields := []string{}
+			for i := range keys {
+				if keys[i].field == "" {
+					keys[i].field = getDefaultIdentifierKey()
+				}
+				fields = append(fields, keys[i].field)
 			}
+			key = strings.Join(fields, ",")
 
 			if err := canKeyMergeArray("list", list, path, key); err != nil {
 				return tree.TypeMismatchError{
@@ -121,8 +216,8 @@ func sortList(path string, list []interface{}, key string) error {
 		}
 	}
 
-	sort.Slice(list, func(i int, j int) bool {
-		return universalLess(list[i], list[j], key)
+	sort.SliceStable(list, func(i int, j int) bool {
+		return compareSortEntries(list[i], list[j], keys) < 0
 	})
 
 	return nil
@@ -0,0 +1,66 @@
+package spruce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// SplitOperator is invoked with (( split <separator> <string> )), and is
+// the opposite of (( join ... )); it splits the string into a list of
+// strings at each occurrence of the separator.
+type SplitOperator struct{}
+
+// Setup ...
+func (SplitOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (SplitOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (SplitOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (SplitOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( split ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( split ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("split operator requires exactly two arguments: a separator, and the string to split")
+	}
+
+	sep, err := resolveStringOperand(ev, "split", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := resolveStringOperand(ev, "split", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	l := []interface{}{}
+	if s != "" {
+		for _, part := range strings.Split(s, sep) {
+			l = append(l, part)
+		}
+	}
+	DEBUG("  split '%s' on '%s' into %d parts", s, sep, len(l))
+
+	return &Response{
+		Type:  Replace,
+		Value: l,
+	}, nil
+}
+
+func init() {
+	RegisterOp("split", SplitOperator{})
+}
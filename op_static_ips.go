@@ -1,7 +1,6 @@
 package spruce
 
 import (
-	"encoding/binary"
 	"fmt"
 	"net"
 	"strconv"
@@ -23,6 +22,7 @@ type StaticIPOperator struct{}
 // Setup ...
 func (StaticIPOperator) Setup() error {
 	UsedIPs = map[string]string{}
+	ipState = nil
 	return nil
 }
 
@@ -112,29 +112,47 @@ func instances(ev *Evaluator, job *tree.Cursor) (int, error) {
 	return int(i), nil
 }
 
+// networkName returns the name of the job network that (( static_ips )) was
+// called in
+func networkName(ev *Evaluator) (string, error) {
+	c := ev.Here.Copy()
+	c.Pop()
+	c.Push("name")
+	return c.ResolveString(ev.Tree)
+}
+
 func statics(ev *Evaluator) (map[string][]string, []string, error) {
 	addrs := map[string][]string{}
 	azs := []string{}
 
-	c := ev.Here.Copy()
-	c.Pop()
-	c.Push("name")
-	name, err := c.ResolveString(ev.Tree)
+	name, err := networkName(ev)
 	if err != nil {
 		return addrs, azs, err
 	}
 
-	c, err = tree.ParseCursor(fmt.Sprintf("networks.%s.subnets.*", name))
+	// since BOSH v2, networks are declared in the cloud-config, so look
+	// there for any network that the manifest doesn't declare itself
+	doc := ev.Tree
+	if CloudConfig != nil {
+		if c, err := tree.ParseCursor(fmt.Sprintf("networks.%s", name)); err == nil {
+			if _, err := c.Resolve(ev.Tree); err != nil {
+				DEBUG("  network %s is not in the manifest; looking for it in the cloud-config", name)
+				doc = CloudConfig
+			}
+		}
+	}
+
+	c, err := tree.ParseCursor(fmt.Sprintf("networks.%s.subnets.*", name))
 	if err != nil {
 		return addrs, azs, err
 	}
-	keys, err := c.Glob(ev.Tree)
+	keys, err := c.Glob(doc)
 	if err != nil {
 		return addrs, azs, err
 	}
 
 	for _, key := range keys {
-		r, err := key.Canonical(ev.Tree)
+		r, err := key.Canonical(doc)
 		if err != nil {
 			return addrs, azs, err
 		}
@@ -146,7 +164,7 @@ func statics(ev *Evaluator) (map[string][]string, []string, error) {
 
 		// look for az definition in the `az` key
 		c, _ = tree.ParseCursor(fmt.Sprintf("%s.az", r.String()))
-		z, err := c.ResolveString(ev.Tree)
+		z, err := c.ResolveString(doc)
 		if err == nil && len(z) > 0 {
 			azs = append(azs, z) // to preserve subnet ordering
 			subnetZones = append(subnetZones, z)
@@ -154,7 +172,7 @@ func statics(ev *Evaluator) (map[string][]string, []string, error) {
 
 		// look for az definitions in the `azs` key
 		c, _ = tree.ParseCursor(fmt.Sprintf("%s.azs", r.String()))
-		os, err := c.Resolve(ev.Tree)
+		os, err := c.Resolve(doc)
 		if err == nil {
 			if zs, ok := os.([]interface{}); ok {
 				for _, o := range zs {
@@ -177,13 +195,13 @@ func statics(ev *Evaluator) (map[string][]string, []string, error) {
 		if err != nil {
 			return addrs, azs, err
 		}
-		keys, err := c.Glob(ev.Tree)
+		keys, err := c.Glob(doc)
 		if err != nil {
 			return addrs, azs, err
 		}
 
 		for _, key := range keys {
-			r, err := key.Resolve(ev.Tree)
+			r, err := key.Resolve(doc)
 			if err != nil {
 				return addrs, azs, err
 			}
@@ -215,7 +233,10 @@ func statics(ev *Evaluator) (map[string][]string, []string, error) {
 					return nil, azs, ansi.Errorf("@c{%s}@R{: not a valid IP address}", segments[1])
 				}
 
-				if binary.BigEndian.Uint32(start.To4()) > binary.BigEndian.Uint32(end.To4()) {
+				if (start.To4() == nil) != (end.To4() == nil) {
+					return nil, azs, ansi.Errorf("@R{Static IP pool }@c{[%s - %s]} @R{mixes IPv4 and IPv6 addresses}", start, end)
+				}
+				if ipToInt(start).Cmp(ipToInt(end)) > 0 {
 					return nil, azs, ansi.Errorf("@R{Static IP pool }@c{[%s - %s]} @R{ends before it starts}", start, end)
 				}
 
@@ -250,18 +271,26 @@ func allIPs(pools map[string][]string, azs []string) []string {
 	return ips
 }
 
-func incrementIP(ip net.IP, i int) net.IP {
-	if ip[i] == 255 {
-		ip[i] = 0
-
-		// check next octet
-		if ip[i-1] == 255 {
-			incrementIP(ip, i-1)
-		} else {
-			ip[i-1]++
+// poolAZ returns the first of the azs whose pool contains ip
+func poolAZ(pools map[string][]string, azs []string, ip string) (string, bool) {
+	for _, az := range azs {
+		for _, candidate := range pools[az] {
+			if candidate == ip {
+				return az, true
+			}
 		}
-	} else {
+	}
+	return "", false
+}
+
+// incrementIP adds one to the address in place, starting at byte i and
+// carrying over into the bytes before it, for IPv4 and IPv6 alike
+func incrementIP(ip net.IP, i int) net.IP {
+	for ; i >= 0; i-- {
 		ip[i]++
+		if ip[i] != 0 {
+			break
+		}
 	}
 	return ip
 }
@@ -312,6 +341,20 @@ func (s StaticIPOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 	job.Pop()
 	DEBUG("  got it.  azs are %v\n", azs)
 
+	if err := loadIPState(); err != nil {
+		return nil, err
+	}
+	network, err := networkName(ev)
+	if err != nil {
+		DEBUG("  network has no name.  this could be problematic.\n")
+		return nil, err
+	}
+	if IPStateFile != "" {
+		if _, ok := ipState[network]; !ok {
+			ipState[network] = map[string]ipReservation{}
+		}
+	}
+
 	// determine if we have any instances
 	DEBUG("  determining how many instances of job %s there are", jobname)
 	inst, err := instances(ev, job)
@@ -319,6 +362,9 @@ func (s StaticIPOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		DEBUG("  failed: %s\n", err)
 		return nil, err
 	}
+	if IPStateFile != "" {
+		releaseIPs(network, fmt.Sprintf("%v", jobname), inst)
+	}
 	if inst == 0 {
 		DEBUG("  no instances for this job.  skipping static IP address calculations...\n")
 		return &Response{
@@ -451,8 +497,25 @@ func (s StaticIPOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 			return nil, ansi.Errorf("@R{request for} @c{static_ip(%d)} @R{in a pool of only} @c{%d (zero-indexed)} @R{static addresses}", offset, len(pool))
 		}
 
-		// check to see if the address is already claimed
+		// prefer the address reserved for this instance on a previous run,
+		// as long as it is still in the pool, and in the requested AZ
 		ip := pool[offset]
+		if IPStateFile != "" {
+			if reserved, ok := ipState[network][current]; ok {
+				if z, found := poolAZ(pools, azs, reserved.IP); found && (az == UndefinedAZ || az == z) {
+					DEBUG("     [%d]: reusing %s, reserved for %s in the IP state file", i, reserved.IP, current)
+					ip = reserved.IP
+				} else {
+					DEBUG("     [%d]: %s (reserved for %s) is no longer in the pool; reallocating", i, reserved.IP, current)
+				}
+			}
+			if owner, reserved := ipReservedBy(network, ip, current); reserved {
+				DEBUG("     [%d]: %s is reserved for %s\n", i, ip, owner)
+				return nil, ansi.Errorf("@R{tried to use IP '}@c{%s}@R{' for} @c{%s}@R{, but that address is reserved for} @c{%s} @R{in IP state file} @m{%s}", ip, current, owner, IPStateFile)
+			}
+		}
+
+		// check to see if the address is already claimed
 		DEBUG("     [%d]: checking to see if %s is already claimed", i, ip)
 		if thief, taken := UsedIPs[ip]; taken {
 			DEBUG("     [%d]: %s is in use by %s\n", i, ip, thief)
@@ -463,6 +526,10 @@ func (s StaticIPOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
 		DEBUG("     [%d]: claiming %s for job %s", i, ip, current)
 		UsedIPs[ip] = current
 		ips = append(ips, ip)
+		if IPStateFile != "" {
+			z, _ := poolAZ(pools, azs, ip)
+			ipState[network][current] = ipReservation{IP: ip, AZ: z}
+		}
 
 		DEBUG("")
 	}
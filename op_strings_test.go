@@ -0,0 +1,159 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("String Operators", func() {
+	run := func(yml string) (map[interface{}]interface{}, error) {
+		ev := &Evaluator{Tree: evalYAML(yml)}
+		err := ev.RunPhase(EvalPhase)
+		return ev.Tree, err
+	}
+
+	meta := `
+meta:
+  env: Prod-East
+  index: 7
+  hosts: "web1, web2 ,web3"
+  padded: "  spaced out  "
+  list: [a, b]
+`
+
+	Describe("(( format ... ))", func() {
+		It("formats values printf-style", func() {
+			t, err := run(meta + `x: (( format "%s-%03d" meta.env meta.index ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal("Prod-East-007"))
+		})
+
+		It("complains when the arguments don't match the format", func() {
+			_, err := run(meta + `x: (( format "%s-%s" meta.env ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`format string "%s-%s" does not match its 1 argument(s)`))
+
+			_, err = run(meta + `x: (( format "%d" meta.env ))`)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("refuses to format lists and maps", func() {
+			_, err := run(meta + `x: (( format "%v" meta.list ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tried to format meta.list, which is not a scalar value"))
+		})
+	})
+
+	Describe("(( replace ... ))", func() {
+		It("replaces regular expression matches, with capture groups", func() {
+			t, err := run(meta + `
+a: (( replace "-" "_" meta.env ))
+b: (( replace "^(\\w+)-(\\w+)$" "$2.$1" meta.env ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("Prod_East"))
+			Expect(t["b"]).To(Equal("East.Prod"))
+		})
+
+		It("reports invalid regular expressions", func() {
+			_, err := run(meta + `x: (( replace "(" "" meta.env ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`(( replace )) was given an invalid regular expression "("`))
+		})
+
+		It("leaves the bare (( replace )) merge directive alone", func() {
+			t, err := run(`x: (( replace ))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["x"]).To(Equal("(( replace ))"))
+		})
+
+		It("reports calls with arguments, but not three of them", func() {
+			_, err := run(meta + `x: (( replace meta.env ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("replace operator requires exactly three arguments"))
+		})
+
+		It("still replaces lists when used as the bare merge directive", func() {
+			root := map[interface{}]interface{}{"list": []interface{}{"a", "b"}}
+			m := &Merger{}
+			Expect(m.Merge(root, map[interface{}]interface{}{"list": []interface{}{"(( replace ))", "c"}})).To(Succeed())
+			Expect(root["list"]).To(Equal([]interface{}{"c"}))
+		})
+	})
+
+	Describe("(( split ... ))", func() {
+		It("splits strings into lists", func() {
+			t, err := run(meta + `
+a: (( split "," meta.hosts ))
+b: (( split "," "" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal([]interface{}{"web1", " web2 ", "web3"}))
+			Expect(t["b"]).To(Equal([]interface{}{}))
+		})
+	})
+
+	Describe("(( upper ... )) and (( lower ... ))", func() {
+		It("changes case", func() {
+			t, err := run(meta + `
+a: (( upper meta.env ))
+b: (( lower meta.env ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("PROD-EAST"))
+			Expect(t["b"]).To(Equal("prod-east"))
+		})
+
+		It("refuses non-scalars", func() {
+			_, err := run(meta + `x: (( upper meta.list ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("(( upper )) expects a string, but meta.list is not a string scalar"))
+		})
+	})
+
+	Describe("(( trim ... ))", func() {
+		It("trims whitespace, or the given characters", func() {
+			t, err := run(meta + `
+a: (( trim meta.padded ))
+b: (( trim "--x--" "-" ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("spaced out"))
+			Expect(t["b"]).To(Equal("x"))
+		})
+	})
+
+	Describe("(( substr ... ))", func() {
+		It("extracts characters by position", func() {
+			t, err := run(meta + `
+a: (( substr meta.env 0 4 ))
+b: (( substr meta.env -4 ))
+c: (( substr "héllo" 1 3 ))
+d: (( substr meta.env 5 100 ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal("Prod"))
+			Expect(t["b"]).To(Equal("East"))
+			Expect(t["c"]).To(Equal("éll"))
+			Expect(t["d"]).To(Equal("East"))
+		})
+
+		It("requires integer positions", func() {
+			_, err := run(meta + `x: (( substr meta.env "one" ))`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`(( substr )) expects an integer, but "one" is not one`))
+		})
+	})
+
+	Describe("(( matches ... ))", func() {
+		It("returns whether the regular expression matches", func() {
+			t, err := run(meta + `
+a: (( matches "^prod" meta.env ))
+b: (( matches "(?i)^prod" meta.env ))
+`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t["a"]).To(Equal(false))
+			Expect(t["b"]).To(Equal(true))
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package spruce
+
+import (
+	"fmt"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// SubstrOperator is invoked with (( substr <string> <start> [<length>] )),
+// and returns part of the string, counted in characters.  A negative start
+// counts back from the end of the string; without a length, everything
+// through to the end of the string is returned.
+type SubstrOperator struct{}
+
+// Setup ...
+func (SubstrOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (SubstrOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (SubstrOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (SubstrOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( substr ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( substr ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("substr operator requires a string, a starting index, and optionally a length")
+	}
+
+	s, err := resolveStringOperand(ev, "substr", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+
+	start, err := resolveIntOperand(ev, "substr", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start += len(runes)
+	}
+	start = clampIndex(start, 0, len(runes))
+
+	end := len(runes)
+	if len(args) == 3 {
+		length, err := resolveIntOperand(ev, "substr", 2, args[2])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("substr operator requires a length that is not negative")
+		}
+		end = clampIndex(start+length, start, len(runes))
+	}
+
+	sub := string(runes[start:end])
+	DEBUG("  resolved (( substr ... )) operation to the string:\n    \"%s\"", sub)
+
+	return &Response{
+		Type:  Replace,
+		Value: sub,
+	}, nil
+}
+
+func init() {
+	RegisterOp("substr", SubstrOperator{})
+}
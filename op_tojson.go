@@ -0,0 +1,93 @@
+package spruce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// TojsonOperator is invoked with (( tojson <value> [<indent>] )), and
+// serializes the value (a map, list or scalar) as a JSON string.  Without
+// an indent, the JSON is compact; the indent can be either a number of
+// spaces, or the literal string to indent with (i.e. "\t").
+type TojsonOperator struct{}
+
+// Setup ...
+func (TojsonOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (TojsonOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (TojsonOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (TojsonOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( tojson ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( tojson ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("tojson operator requires a value to serialize, and optionally an indent")
+	}
+
+	v, err := resolveOperand(ev, "tojson", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		i, err := resolveOperand(ev, "tojson", 1, args[1])
+		if err != nil {
+			return nil, err
+		}
+		switch i := i.(type) {
+		case string:
+			indent = i
+		case int:
+			indent = strings.Repeat(" ", max(i, 0))
+		case int64:
+			indent = strings.Repeat(" ", max(int(i), 0))
+		default:
+			return nil, ansi.Errorf("@R{tojson indent must be a number of spaces, or a string}")
+		}
+	}
+
+	data, err := deinterface(v, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(data); err != nil {
+		DEBUG("  unable to encode value as JSON: %s", err)
+		return nil, ansi.Errorf("@R{unable to convert} @c{%s} @R{to JSON}: %s", args[0], err)
+	}
+
+	s := strings.TrimSuffix(buf.String(), "\n")
+	DEBUG("  resolved (( tojson ... )) operation to the string:\n    \"%s\"", s)
+
+	return &Response{
+		Type:  Replace,
+		Value: s,
+	}, nil
+}
+
+func init() {
+	RegisterOp("tojson", TojsonOperator{})
+}
@@ -0,0 +1,66 @@
+package spruce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// TrimOperator is invoked with (( trim <string> [<characters>] )), and
+// removes leading and trailing whitespace (or the given characters) from
+// the string
+type TrimOperator struct{}
+
+// Setup ...
+func (TrimOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (TrimOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (TrimOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (TrimOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( trim ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( trim ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("trim operator requires a string to trim, and optionally the characters to remove")
+	}
+
+	s, err := resolveStringOperand(ev, "trim", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 2 {
+		cutset, err := resolveStringOperand(ev, "trim", 1, args[1])
+		if err != nil {
+			return nil, err
+		}
+		DEBUG("  trimming any of '%s' from '%s'", cutset, s)
+		s = strings.Trim(s, cutset)
+	} else {
+		DEBUG("  trimming whitespace from '%s'", s)
+		s = strings.TrimSpace(s)
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: s,
+	}, nil
+}
+
+func init() {
+	RegisterOp("trim", TrimOperator{})
+}
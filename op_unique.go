@@ -0,0 +1,85 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// UniqueOperator is invoked with (( unique <lists/values>... )), and
+// returns a single list of every distinct value, in the order they were
+// first seen.
+type UniqueOperator struct{}
+
+// Setup ...
+func (UniqueOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (UniqueOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (UniqueOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (UniqueOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( unique ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( unique ... )) operation at $%s\n", ev.Here)
+
+	if len(args) == 0 {
+		DEBUG("  no arguments supplied to (( unique ... )) operation.  oops.")
+		return nil, ansi.Errorf("no arguments specified to @c{(( unique ... ))}")
+	}
+
+	vals := []interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, "unique", i, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		switch s := s.(type) {
+		case []interface{}:
+			DEBUG("     [%d]: resolved to a list; appending its entries", i)
+			vals = append(vals, s...)
+
+		case map[interface{}]interface{}:
+			DEBUG("     [%d]: resolved to a map; error!", i)
+			return nil, ansi.Errorf("@c{%s} @R{is a map, not a list}", arg)
+
+		default:
+			vals = append(vals, s)
+		}
+		DEBUG("")
+	}
+
+	unique := []interface{}{}
+	for _, v := range vals {
+		seen := false
+		for _, u := range unique {
+			if equalValues(u, v) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			unique = append(unique, v)
+		}
+	}
+	DEBUG("  removed %d duplicate entries", len(vals)-len(unique))
+
+	return &Response{
+		Type:  Replace,
+		Value: unique,
+	}, nil
+}
+
+func init() {
+	RegisterOp("unique", UniqueOperator{})
+}
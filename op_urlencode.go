@@ -0,0 +1,56 @@
+package spruce
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// UrlencodeOperator is invoked with (( urlencode <string> )), and
+// percent-encodes every character of the string other than the RFC 3986
+// unreserved characters (letters, digits, `-`, `.`, `_` and `~`), making
+// it safe to use anywhere in a URL -- including passwords in the userinfo
+// of connection strings.
+type UrlencodeOperator struct{}
+
+// Setup ...
+func (UrlencodeOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (UrlencodeOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (UrlencodeOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (UrlencodeOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( urlencode ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( urlencode ... )) operation at $%s\n", ev.Here)
+
+	strs, err := encodingArgs(ev, "urlencode", "url encode", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// QueryEscape encodes spaces as '+', which only means space in query strings
+	encoded := strings.ReplaceAll(url.QueryEscape(strs[0]), "+", "%20")
+	DEBUG("  resolved (( urlencode ... )) operation to the string:\n    \"%s\"", encoded)
+
+	return &Response{
+		Type:  Replace,
+		Value: encoded,
+	}, nil
+}
+
+func init() {
+	RegisterOp("urlencode", UrlencodeOperator{})
+}
@@ -0,0 +1,148 @@
+package spruce
+
+import (
+	"crypto/sha1" // #nosec G505 -- SHA-1 is mandated by RFC 4122 for version 5 UUIDs
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// uuidNamespaces are the well-known namespaces from RFC 4122, Appendix C
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
+
+func parseUUID(s string) ([]byte, bool) {
+	if ns, ok := uuidNamespaces[strings.ToLower(s)]; ok {
+		s = ns
+	}
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, false
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	return b, err == nil
+}
+
+// setUUIDVersion stamps the version and RFC 4122 variant bits onto b
+func setUUIDVersion(b []byte, version byte) {
+	b[6] = (b[6] & 0x0f) | version<<4
+	b[8] = (b[8] & 0x3f) | 0x80
+}
+
+// UUIDOperator is invoked with (( uuid )), and generates a random
+// (version 4) UUID
+type UUIDOperator struct{}
+
+// Setup ...
+func (UUIDOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (UUIDOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (UUIDOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (UUIDOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( uuid )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( uuid )) operation at $%s\n", ev.Here)
+
+	if len(args) != 0 {
+		return nil, ansi.Errorf("@R{uuid operator does not take any arguments}")
+	}
+
+	b := make([]byte, 16)
+	r := randFor(ev, "uuid")
+	for i := range b {
+		b[i] = byte(r.UintN(256))
+	}
+	setUUIDVersion(b, 4)
+
+	id := formatUUID(b)
+	DEBUG("  generated UUID %s", id)
+	return &Response{
+		Type:  Replace,
+		Value: id,
+	}, nil
+}
+
+// UUIDv5Operator is invoked with (( uuid-v5 <namespace> <name> )), and
+// generates a name-based (version 5) UUID, which is always the same for
+// the same namespace and name
+type UUIDv5Operator struct{}
+
+// Setup ...
+func (UUIDv5Operator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (UUIDv5Operator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (UUIDv5Operator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (UUIDv5Operator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( uuid-v5 ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( uuid-v5 ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 2 {
+		return nil, ansi.Errorf("@R{uuid-v5 operator requires exactly two arguments: a namespace and a name}")
+	}
+
+	ns, err := resolveStringOperand(ev, "uuid-v5", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	name, err := resolveStringOperand(ev, "uuid-v5", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	space, ok := parseUUID(ns)
+	if !ok {
+		return nil, ansi.Errorf("@c{(( uuid-v5 ))} @R{namespace} @c{%s} @R{is neither a UUID nor one of dns, url, oid or x500}", ns)
+	}
+
+	h := sha1.New() // #nosec G401 -- SHA-1 is mandated by RFC 4122 for version 5 UUIDs
+	h.Write(space)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+	setUUIDVersion(b, 5)
+
+	id := formatUUID(b)
+	DEBUG("  generated UUID %s", id)
+	return &Response{
+		Type:  Replace,
+		Value: id,
+	}, nil
+}
+
+func init() {
+	RegisterOp("uuid", UUIDOperator{})
+	RegisterOp("uuid-v5", UUIDv5Operator{})
+}
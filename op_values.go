@@ -0,0 +1,79 @@
+package spruce
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// ValuesOperator is invoked with (( values <maps>... )), and is the
+// counterpart to (( keys ... )); it returns the values of each map,
+// ordered by their (sorted) keys.
+type ValuesOperator struct{}
+
+// Setup ...
+func (ValuesOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (ValuesOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (ValuesOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (ValuesOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( values ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( values ... )) operation at $%s\n", ev.Here)
+
+	if len(args) == 0 {
+		DEBUG("  no arguments supplied to (( values ... )) operation.  oops.")
+		return nil, ansi.Errorf("no arguments specified to @c{(( values ... ))}")
+	}
+
+	vals := []interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, "values", i, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := s.(map[interface{}]interface{})
+		if !ok {
+			DEBUG("     [%d]: resolved to something that is not a map.  that is unacceptable.", i)
+			return nil, ansi.Errorf("@c{%s} @R{is not a map}", arg)
+		}
+
+		DEBUG("     [%d]: resolved to a map; extracting values", i)
+		keys := []string{}
+		byKey := map[string]interface{}{}
+		for k, v := range m {
+			key := fmt.Sprintf("%v", k)
+			keys = append(keys, key)
+			byKey[key] = v
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vals = append(vals, byKey[k])
+		}
+		DEBUG("")
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: vals,
+	}, nil
+}
+
+func init() {
+	RegisterOp("values", ValuesOperator{})
+}
@@ -0,0 +1,219 @@
+package spruce
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+const (
+	x509CALifetime   = 10 * 365 * 24 * time.Hour
+	x509CertLifetime = 365 * 24 * time.Hour
+)
+
+// x509Generate hands back the certificate remembered in the x509 state
+// file for this operator call, if it was generated for the same request,
+// or generates (and remembers) a new one
+func x509Generate(ev *Evaluator, name, request string, generate func(*rand.Rand, time.Time) (string, string, error)) (map[string]string, error) {
+	if err := loadX509State(); err != nil {
+		return nil, err
+	}
+
+	here := ev.Here.String()
+	if canon, err := ev.Here.Canonical(ev.Tree); err == nil {
+		here = canon.String()
+	}
+	if prev, ok := x509State[here]; ok && prev["request"] == request {
+		DEBUG("  reusing the certificate for $.%s from the x509 state file", here)
+		return prev, nil
+	}
+
+	now, err := currentTime()
+	if err != nil {
+		return nil, err
+	}
+	cert, key, err := generate(randFor(ev, name), now.Truncate(time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	generated := map[string]string{
+		"request":     request,
+		"certificate": cert,
+		"private_key": key,
+	}
+	x509State[here] = generated
+	return generated, saveX509State()
+}
+
+// X509CAOperator is invoked with (( x509-ca <name> )), and generates a
+// self-signed certificate authority
+type X509CAOperator struct{}
+
+// Setup ...
+func (X509CAOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (X509CAOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (X509CAOperator) Dependencies(_ *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return auto
+}
+
+// Run ...
+func (X509CAOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( x509-ca ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( x509-ca ... )) operation at $%s\n", ev.Here)
+
+	if len(args) != 1 {
+		return nil, ansi.Errorf("@R{x509-ca operator requires exactly one argument, the name of the CA}")
+	}
+	cn, err := resolveStringOperand(ev, "x509-ca", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := x509Generate(ev, "x509-ca", x509Request("ca", cn), func(r *rand.Rand, now time.Time) (string, string, error) {
+		DEBUG("  generating a new CA named '%s'", cn)
+		template := x509Template(cn, now, x509CALifetime)
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		return generateX509(r, template, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Type: Replace,
+		Value: map[interface{}]interface{}{
+			"certificate": ca["certificate"],
+			"private_key": ca["private_key"],
+		},
+	}, nil
+}
+
+// X509CertOperator is invoked with (( x509-cert <ca> <common-name> [sans...] )),
+// and generates a certificate signed by the given CA
+type X509CertOperator struct{}
+
+// Setup ...
+func (X509CertOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (X509CertOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (X509CertOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (X509CertOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( x509-cert ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( x509-cert ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 2 {
+		return nil, ansi.Errorf("@R{x509-cert operator requires a CA, a common name, and optional subject alternative names}")
+	}
+
+	v, err := resolveOperand(ev, "x509-cert", 0, args[0])
+	if err != nil {
+		return nil, err
+	}
+	ca, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ansi.Errorf("@c{(( x509-cert ))} @R{expects a CA, but} @c{%s} @R{is not a map with a certificate and private_key}", args[0])
+	}
+	caPEM, _ := ca["certificate"].(string)
+	keyPEM, _ := ca["private_key"].(string)
+	caCert, err := parsePEMCertificate(caPEM)
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( x509-cert ))} @R{CA} @c{%s}@R{:} %s", args[0], err)
+	}
+	caKey, err := parsePEMPrivateKey(keyPEM)
+	if err != nil {
+		return nil, ansi.Errorf("@c{(( x509-cert ))} @R{CA} @c{%s}@R{:} %s", args[0], err)
+	}
+
+	cn, err := resolveStringOperand(ev, "x509-cert", 1, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var sans []string
+	for i, arg := range args[2:] {
+		v, err := resolveOperand(ev, "x509-cert", i+2, arg)
+		if err != nil {
+			return nil, err
+		}
+		l, isList := v.([]interface{})
+		if !isList {
+			l = []interface{}{v}
+		}
+		for _, san := range l {
+			switch san.(type) {
+			case map[interface{}]interface{}, []interface{}, nil:
+				return nil, ansi.Errorf("@c{(( x509-cert ))} @R{subject alternative names must be strings, but} @c{%s} @R{is not}", arg)
+			}
+			sans = append(sans, fmt.Sprintf("%v", san))
+		}
+	}
+	if len(sans) == 0 {
+		sans = []string{cn}
+	}
+
+	request := x509Request(append([]string{"cert", caPEM, cn}, sans...)...)
+	cert, err := x509Generate(ev, "x509-cert", request, func(r *rand.Rand, now time.Time) (string, string, error) {
+		DEBUG("  generating a new certificate for '%s' (%s), signed by '%s'", cn, strings.Join(sans, ", "), caCert.Subject.CommonName)
+		template := x509Template(cn, now, x509CertLifetime)
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		for _, san := range sans {
+			if ip := net.ParseIP(san); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, san)
+			}
+		}
+		if template.NotAfter.After(caCert.NotAfter) {
+			template.NotAfter = caCert.NotAfter
+		}
+		return generateX509(r, template, caCert, caKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Type: Replace,
+		Value: map[interface{}]interface{}{
+			"certificate": cert["certificate"],
+			"private_key": cert["private_key"],
+			"ca":          caPEM,
+		},
+	}, nil
+}
+
+func init() {
+	RegisterOp("x509-ca", X509CAOperator{})
+	RegisterOp("x509-cert", X509CertOperator{})
+}
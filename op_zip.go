@@ -0,0 +1,76 @@
+package spruce
+
+import (
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// ZipOperator is invoked with (( zip <list> <list>... )), and returns a
+// list of lists, where the first contains the first entry of each of the
+// given lists, the second contains the second entries, and so on.
+type ZipOperator struct{}
+
+// Setup ...
+func (ZipOperator) Setup() error {
+	return nil
+}
+
+// Phase ...
+func (ZipOperator) Phase() OperatorPhase {
+	return EvalPhase
+}
+
+// Dependencies ...
+func (ZipOperator) Dependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	return operandDependencies(ev, args, locs, auto)
+}
+
+// Run ...
+func (ZipOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( zip ... )) operation at $.%s", ev.Here)
+	defer DEBUG("done with (( zip ... )) operation at $%s\n", ev.Here)
+
+	if len(args) < 2 {
+		DEBUG("  too few arguments supplied to (( zip ... )) operation.")
+		return nil, ansi.Errorf("@c{(( zip ... ))} @R{requires at least two lists}")
+	}
+
+	lists := [][]interface{}{}
+	for i, arg := range args {
+		s, err := resolveOperand(ev, "zip", i, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		l, ok := s.([]interface{})
+		if !ok {
+			DEBUG("     [%d]: resolved to something that is not a list.  that is unacceptable.", i)
+			return nil, ansi.Errorf("@c{%s} @R{is not a list}", arg)
+		}
+		if len(lists) > 0 && len(l) != len(lists[0]) {
+			DEBUG("     [%d]: list has %d entries, but the first had %d", i, len(l), len(lists[0]))
+			return nil, ansi.Errorf("@R{cannot zip lists of different lengths (}@c{%s}@R{ has %d entries,} @c{%s}@R{ has %d)}", args[0], len(lists[0]), arg, len(l))
+		}
+		lists = append(lists, l)
+	}
+
+	zipped := []interface{}{}
+	for i := range lists[0] {
+		tuple := []interface{}{}
+		for _, l := range lists {
+			tuple = append(tuple, l[i])
+		}
+		zipped = append(zipped, tuple)
+	}
+
+	return &Response{
+		Type:  Replace,
+		Value: zipped,
+	}, nil
+}
+
+func init() {
+	RegisterOp("zip", ZipOperator{})
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/geofffranks/yaml"
 	"github.com/starkandwayne/goutils/ansi"
@@ -83,6 +84,11 @@ func RegisterOp(name string, op Operator) {
 func SetupOperators(phase OperatorPhase) error {
 	errors := MultiError{Errors: []error{}}
 	for _, op := range OpRegistry {
+		if _, ok := op.(*PluginOperator); ok {
+			// plugins have nothing to set up, and asking for their phase
+			// would run them, whether the documents use them or not
+			continue
+		}
 		if op.Phase() == phase {
 			if err := op.Setup(); err != nil {
 				errors.Append(err)
@@ -187,6 +193,10 @@ func (e *Expr) Resolve(tree map[interface{}]interface{}) (*Expr, error) {
 		return e, nil
 
 	case EnvVar:
+		if path, ok := cloudConfigPath(e.Name); ok {
+			return resolveCloudConfig(path)
+		}
+
 		v := os.Getenv(e.Name)
 		if v == "" {
 			return nil, ansi.Errorf("@R{Environment variable} @c{$%s} @R{is not set}", e.Name)
@@ -209,12 +219,34 @@ func (e *Expr) Resolve(tree map[interface{}]interface{}) (*Expr, error) {
 				e.BracketedNodes[i] = false
 			}
 		}
+		// references rooted at $cloud_config point into the cloud-config,
+		// not the document being evaluated
+		if len(e.Reference.Nodes) > 0 && e.Reference.Nodes[0] == "$"+cloudConfigRoot {
+			var bracketed []bool
+			if len(e.BracketedNodes) > 1 {
+				bracketed = e.BracketedNodes[1:]
+			}
+			nodes, err := ResolveDynamicRefs(ResolveEnv(e.Reference.Nodes[1:]), bracketed, tree)
+			if err != nil {
+				return nil, ansi.Errorf("@R{%s}", err)
+			}
+			return resolveCloudConfigNodes(nodes)
+		}
+
 		e.Reference.Nodes = ResolveEnv(e.Reference.Nodes)
 		nodes, err := ResolveDynamicRefs(e.Reference.Nodes, e.BracketedNodes, tree)
 		if err != nil {
 			return nil, ansi.Errorf("@R{%s}", err)
 		}
 		e.Reference.Nodes = nodes
+		if isGlob(e.Reference) {
+			// wildcard references resolve to the list of everything they match
+			vals, err := resolveGlob(e.Reference, tree)
+			if err != nil {
+				return nil, ansi.Errorf("@R{unable to resolve `}@c{%s}@R{`: %s}", e.Reference, err)
+			}
+			return &Expr{Type: Literal, Literal: vals}, nil
+		}
 		if _, err := e.Reference.Resolve(tree); err != nil {
 			return nil, ansi.Errorf("@R{unable to resolve `}@c{%s}@R{`: %s}", e.Reference, err)
 		}
@@ -381,6 +413,19 @@ func (e *Expr) Dependencies(ev *Evaluator, locs []*tree.Cursor) []*tree.Cursor {
 
 	switch e.Type {
 	case Reference:
+		if isGlob(e.Reference) {
+			// depend on every match, and any operators found underneath them
+			matches, _ := globCursor(e.Reference, ev.Tree)
+			for _, match := range matches {
+				l = append(l, match)
+				for _, other := range locs {
+					if other.Under(match) {
+						l = append(l, other)
+					}
+				}
+			}
+			break
+		}
 		canonicalize(e.Reference)
 		for i, node := range e.Reference.Nodes {
 			if i >= len(e.BracketedNodes) || !e.BracketedNodes[i] {
@@ -409,9 +454,100 @@ func (e *Expr) Dependencies(ev *Evaluator, locs []*tree.Cursor) []*tree.Cursor {
 	return l
 }
 
+// resolveOperand resolves an operator argument to its final value: either
+// the literal itself, or whatever the reference points to in the tree.
+func resolveOperand(ev *Evaluator, name string, i int, arg *Expr) (interface{}, error) {
+	v, err := arg.Resolve(ev.Tree)
+	if err != nil {
+		DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
+		return nil, err
+	}
+
+	switch v.Type {
+	case Literal:
+		DEBUG("  arg[%d]: found literal '%v'", i, v.Literal)
+		return v.Literal, nil
+
+	case Reference:
+		DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
+		s, err := v.Reference.Resolve(ev.Tree)
+		if err != nil {
+			DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
+			return nil, fmt.Errorf("unable to resolve `%s`: %s", v.Reference, err)
+		}
+		return s, nil
+	}
+
+	DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
+	return nil, fmt.Errorf("%s operator only accepts literal and key reference arguments", name)
+}
+
+// resolveStringOperand resolves an operator argument to a string, for
+// operators that work on scalars.  Numbers and booleans are converted to
+// their usual string form, but maps, lists and nulls are refused.
+func resolveStringOperand(ev *Evaluator, name string, i int, arg *Expr) (string, error) {
+	v, err := resolveOperand(ev, name, i, arg)
+	if err != nil {
+		return "", err
+	}
+
+	switch v.(type) {
+	case map[interface{}]interface{}, []interface{}, nil:
+		DEBUG("     [%d]: %v is not a string scalar", i, v)
+		return "", ansi.Errorf("@c{(( %s ))} @R{expects a string, but} @c{%s} @R{is not a string scalar}", name, arg)
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// resolveIntOperand resolves an operator argument to an integer
+func resolveIntOperand(ev *Evaluator, name string, i int, arg *Expr) (int, error) {
+	v, err := resolveOperand(ev, name, i, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	DEBUG("     [%d]: %v is not an integer", i, v)
+	return 0, ansi.Errorf("@c{(( %s ))} @R{expects an integer, but} @c{%s} @R{is not one}", name, arg)
+}
+
+// operandDependencies returns the auto-generated dependencies of an
+// operator, along with any operators found inside of the maps and lists
+// that its reference arguments point to, since those have to be
+// evaluated before the collection as a whole can be used.
+func operandDependencies(ev *Evaluator, args []*Expr, locs []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	deps := auto
+	for _, arg := range args {
+		v, err := arg.Resolve(ev.Tree)
+		if err != nil || v.Type != Reference {
+			continue
+		}
+		canon, err := v.Reference.Canonical(ev.Tree)
+		if err != nil {
+			continue
+		}
+		for _, other := range locs {
+			if other.Under(canon) {
+				deps = append(deps, other)
+			}
+		}
+	}
+	return deps
+}
+
 // Opcall ...
 type Opcall struct {
 	src       string
+	name      string
 	where     *tree.Cursor
 	canonical *tree.Cursor
 	op        Operator
@@ -622,11 +758,16 @@ func ParseOpcall(phase OperatorPhase, src string) (*Opcall, error) {
 		m := re.FindStringSubmatch(src)
 		DEBUG("parsing `%s': looks like a (( %s ... )) operator\n arguments:", src, m[1])
 
+		op.name = m[1]
 		op.op = OperatorFor(m[1])
 		if _, ok := op.op.(NullOperator); ok && len(m[2]) == 0 {
 			DEBUG("skipping `%s': not a real operator -- might be a BOSH variable?", src)
 			continue
 		}
+		if _, ok := op.op.(ReplaceOperator); ok && strings.TrimSpace(m[2]) == "" {
+			DEBUG("skipping `%s': that's the (( replace )) merge directive, not the operator", src)
+			continue
+		}
 		if op.op.Phase() != phase {
 			DEBUG("  - skipping (( %s ... )) operation; it belongs to a different phase", m[1])
 			return nil, nil
@@ -653,11 +794,18 @@ func (op *Opcall) Dependencies(ev *Evaluator, locs []*tree.Cursor) []*tree.Curso
 		l = append(l, arg.Dependencies(ev, locs)...)
 	}
 
+	was := ev.Here
+	ev.Here = op.where
+	defer func() { ev.Here = was }()
 	return op.op.Dependencies(ev, op.args, locs, l)
 }
 
 // Run ...
 func (op *Opcall) Run(ev *Evaluator) (*Response, error) {
+	if err := op.checkGlobs(); err != nil {
+		return nil, ansi.Errorf("@m{$.%s}: %s", op.where, err)
+	}
+
 	was := ev.Here
 	ev.Here = op.where
 	r, err := op.op.Run(ev, op.args)
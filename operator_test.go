@@ -721,6 +721,7 @@ var _ = Describe("static_ips Operator", func() {
 	BeforeEach(func() {
 		op = StaticIPOperator{}
 		UsedIPs = map[string]string{}
+		ipState = nil
 	})
 
 	It("can resolve valid networks inside of job contexts", func() {
@@ -1287,6 +1288,169 @@ jobs:
 		Expect(err.Error()).To(ContainSubstring("ends before it starts"))
 		Expect(r).To(BeNil())
 	})
+
+	It("allocates IPv6 addresses, carrying across octets", func() {
+		ev := &Evaluator{
+			Here: cursor("jobs.job1.networks.0.static_ips"),
+			Tree: opYAML(
+				`networks:
+  - name: test-network
+    subnets:
+    - static: [ "fd00::fe - fd00::101" ]
+jobs:
+  - name: job1
+    instances: 3
+    networks:
+      - name: test-network
+        static_ips: <---------- HERE -----------------
+`),
+		}
+
+		r, err := op.Run(ev, []*Expr{num(0), num(2), num(3)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Value).To(Equal([]interface{}{"fd00::fe", "fd00::100", "fd00::101"}))
+	})
+
+	It("throws an error if the address pool mixes IPv4 and IPv6", func() {
+		ev := &Evaluator{
+			Here: cursor("jobs.job1.networks.0.static_ips"),
+			Tree: opYAML(
+				`networks:
+  - name: test-network
+    subnets:
+    - static: [ "10.0.0.1 - fd00::1" ]
+jobs:
+  - name: job1
+    instances: 1
+    networks:
+      - name: test-network
+        static_ips: <---------- HERE -----------------
+`),
+		}
+
+		r, err := op.Run(ev, []*Expr{num(0)})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("mixes IPv4 and IPv6 addresses"))
+		Expect(r).To(BeNil())
+	})
+
+	Context("with an IP state file", func() {
+		var state string
+
+		BeforeEach(func() {
+			state = filepath.Join(GinkgoT().TempDir(), "ips.yml")
+			IPStateFile = state
+		})
+		AfterEach(func() {
+			IPStateFile = ""
+		})
+
+		tree := func(instances int) map[interface{}]interface{} {
+			return opYAML(fmt.Sprintf(`networks:
+  - name: test-network
+    subnets:
+    - static: [ 10.0.0.5 - 10.0.0.10 ]
+jobs:
+  - name: job1
+    instances: %d
+    networks:
+      - name: test-network
+        static_ips: <---------- HERE -----------------
+`, instances))
+		}
+
+		It("reuses reservations, and allocates new addresses only for new instances", func() {
+			Expect(os.WriteFile(state, []byte(`test-network:
+  job1/0: { ip: 10.0.0.9, az: z1 }
+`), 0600)).To(Succeed())
+
+			ev := &Evaluator{Here: cursor("jobs.job1.networks.0.static_ips"), Tree: tree(2)}
+			Expect(op.Setup()).To(Succeed())
+			r, err := op.Run(ev, []*Expr{num(0), num(1), num(2)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Value).To(Equal([]interface{}{"10.0.0.9", "10.0.0.6"}))
+			Expect(saveIPState()).To(Succeed())
+
+			b, err := os.ReadFile(state)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("job1/1:\n    ip: 10.0.0.6\n"))
+		})
+
+		It("releases the reservations of instances that were scaled away", func() {
+			Expect(os.WriteFile(state, []byte(`test-network:
+  job1/0: { ip: 10.0.0.5 }
+  job1/1: { ip: 10.0.0.6 }
+  job1/2: { ip: 10.0.0.7 }
+`), 0600)).To(Succeed())
+
+			ev := &Evaluator{Here: cursor("jobs.job1.networks.0.static_ips"), Tree: tree(1)}
+			Expect(op.Setup()).To(Succeed())
+			_, err := op.Run(ev, []*Expr{num(0), num(1), num(2)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saveIPState()).To(Succeed())
+
+			b, err := os.ReadFile(state)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("job1/0"))
+			Expect(string(b)).NotTo(ContainSubstring("job1/1"))
+			Expect(string(b)).NotTo(ContainSubstring("job1/2"))
+		})
+
+		It("reports addresses reserved for other instances", func() {
+			Expect(os.WriteFile(state, []byte(`test-network:
+  job2/0: { ip: 10.0.0.6 }
+`), 0600)).To(Succeed())
+
+			ev := &Evaluator{Here: cursor("jobs.job1.networks.0.static_ips"), Tree: tree(2)}
+			Expect(op.Setup()).To(Succeed())
+			r, err := op.Run(ev, []*Expr{num(0), num(1)})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("tried to use IP '10.0.0.6' for job1/1, but that address is reserved for job2/0 in IP state file"))
+			Expect(r).To(BeNil())
+		})
+
+		doc := `
+networks:
+  - name: test-network
+    subnets:
+    - static: [ 10.0.0.5 - 10.0.0.10 ]
+jobs:
+  - name: job1
+    instances: 2
+    networks:
+      - name: test-network
+        static_ips: (( static_ips 0 1 ))
+`
+
+		It("writes the state file once the evaluation has succeeded", func() {
+			ev := &Evaluator{Tree: opYAML(doc)}
+			Expect(ev.Run(nil, nil)).To(Succeed())
+
+			b, err := os.ReadFile(state)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("job1/1:\n    ip: 10.0.0.6\n"))
+		})
+
+		It("leaves the state file alone when the evaluation fails", func() {
+			before := []byte(`test-network:
+  job1/0: { ip: 10.0.0.9 }
+`)
+			Expect(os.WriteFile(state, before, 0600)).To(Succeed())
+
+			ev := &Evaluator{Tree: opYAML(doc + "oops: (( grab meta.nope ))\n")}
+			Expect(ev.Run(nil, nil)).NotTo(Succeed())
+
+			b, err := os.ReadFile(state)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(Equal(before))
+		})
+
+		It("does not create the state file when the evaluation fails", func() {
+			ev := &Evaluator{Tree: opYAML(doc + "oops: (( grab meta.nope ))\n")}
+			Expect(ev.Run(nil, nil)).NotTo(Succeed())
+			Expect(state).NotTo(BeAnExistingFile())
+		})
+	})
 })
 
 var _ = Describe("inject Operator", func() {
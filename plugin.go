@@ -0,0 +1,365 @@
+package spruce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// PluginPrefix is the filename prefix that identifies operator plugins
+// found on SPRUCE_PLUGIN_PATH; `spruce-op-lookup` provides (( lookup ... ))
+const PluginPrefix = "spruce-op-"
+
+// PluginProtocolVersion is sent with every request made to a plugin, so
+// that plugins can refuse to talk to a spruce they don't understand.
+const PluginProtocolVersion = 1
+
+// PluginOperator is an Operator implemented by an external executable.
+// Spruce talks to the plugin by writing a single JSON request to its
+// standard input, and reading a single JSON response from its standard
+// output.  See doc/operator-plugins.md for the details of the protocol.
+type PluginOperator struct {
+	Name    string
+	Command string
+	Args    []string
+
+	described    bool
+	describeErr  error
+	phase        OperatorPhase
+	dependencies []string
+	wantsTree    bool
+}
+
+type pluginRequest struct {
+	Version  int           `json:"version"`
+	Action   string        `json:"action"`
+	Operator string        `json:"operator"`
+	Args     []interface{} `json:"args,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Tree     interface{}   `json:"tree,omitempty"`
+}
+
+type pluginResponse struct {
+	// for `run` requests
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+	Error string          `json:"error"`
+
+	// for `describe` requests
+	Phase        string   `json:"phase"`
+	Dependencies []string `json:"dependencies"`
+	Tree         bool     `json:"tree"`
+}
+
+// PluginConfig is the structure of the file given to LoadPluginConfig
+type PluginConfig struct {
+	Plugins []struct {
+		Name         string   `yaml:"name"`
+		Command      string   `yaml:"command"`
+		Args         []string `yaml:"args"`
+		Phase        string   `yaml:"phase"`
+		Dependencies []string `yaml:"dependencies"`
+		Tree         bool     `yaml:"tree"`
+	} `yaml:"plugins"`
+}
+
+func parsePhase(s string) (OperatorPhase, error) {
+	switch strings.ToLower(s) {
+	case "", "eval":
+		return EvalPhase, nil
+	case "merge":
+		return MergePhase, nil
+	case "param":
+		return ParamPhase, nil
+	}
+	return EvalPhase, fmt.Errorf("unknown operator phase '%s' (expected one of merge, param or eval)", s)
+}
+
+// RegisterPlugin adds an external operator plugin to the operator registry.
+// Plugins cannot replace the built-in operators; if another plugin already
+// claimed the name, the first registration wins.
+func RegisterPlugin(p *PluginOperator) error {
+	if existing, ok := OpRegistry[p.Name]; ok {
+		if _, isPlugin := existing.(*PluginOperator); isPlugin {
+			DEBUG("plugin (( %s )) is already registered; ignoring %s", p.Name, p.Command)
+			return nil
+		}
+		return ansi.Errorf("@R{plugin} @c{%s} @R{(%s) conflicts with the built-in} @c{(( %s ))} @R{operator}", p.Name, p.Command, p.Name)
+	}
+
+	DEBUG("registering plugin (( %s )) from %s", p.Name, p.Command)
+	RegisterOp(p.Name, p)
+	return nil
+}
+
+// LoadPluginConfig registers all of the operator plugins declared in
+// the given YAML configuration file.
+func LoadPluginConfig(path string) error {
+	b, err := os.ReadFile(path) // #nosec G304 -- user-specified file path is core CLI functionality
+	if err != nil {
+		return ansi.Errorf("@R{Error reading plugin configuration} @m{%s}: %s", path, err)
+	}
+
+	var cfg PluginConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return ansi.Errorf("@m{%s}: @R{unable to parse plugin configuration}: %s", path, err)
+	}
+
+	errors := MultiError{Errors: []error{}}
+	for i, def := range cfg.Plugins {
+		if def.Name == "" || def.Command == "" {
+			errors.Append(ansi.Errorf("@m{%s}: @R{plugin #%d must specify both a} @c{name} @R{and a} @c{command}", path, i))
+			continue
+		}
+
+		p := &PluginOperator{
+			Name:         def.Name,
+			Command:      def.Command,
+			Args:         def.Args,
+			dependencies: def.Dependencies,
+			wantsTree:    def.Tree,
+		}
+		if def.Phase != "" {
+			phase, err := parsePhase(def.Phase)
+			if err != nil {
+				errors.Append(ansi.Errorf("@m{%s}: @R{plugin} @c{%s}: %s", path, def.Name, err))
+				continue
+			}
+			// a declared phase means we don't need to ask the plugin to describe itself
+			p.described = true
+			p.phase = phase
+		}
+
+		errors.Append(RegisterPlugin(p))
+	}
+
+	if len(errors.Errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+// DiscoverPlugins registers every executable named `spruce-op-<name>`
+// found in the directories of searchPath, which is formatted like $PATH.
+// As with $PATH, earlier directories take precedence.
+func DiscoverPlugins(searchPath string) error {
+	errors := MultiError{Errors: []error{}}
+	for _, dir := range filepath.SplitList(searchPath) {
+		if dir == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			DEBUG("skipping plugin directory %s: %s", dir, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), PluginPrefix) || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.Mode()&0111 == 0 {
+				DEBUG("skipping %s: not an executable file", filepath.Join(dir, entry.Name()))
+				continue
+			}
+
+			errors.Append(RegisterPlugin(&PluginOperator{
+				Name:    strings.TrimPrefix(entry.Name(), PluginPrefix),
+				Command: filepath.Join(dir, entry.Name()),
+			}))
+		}
+	}
+
+	if len(errors.Errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+func (p *PluginOperator) call(req pluginRequest) (*pluginResponse, error) {
+	req.Version = PluginProtocolVersion
+	req.Operator = p.Name
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to encode request for plugin} @c{%s}: %s", p.Name, err)
+	}
+	TRACE("plugin %s: sending request %s", p.Name, in)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(p.Command, p.Args...) // #nosec G204 -- plugin commands are explicitly configured by the user
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, ansi.Errorf("@R{plugin} @c{%s} @R{failed}: %s", p.Name, msg)
+	}
+	TRACE("plugin %s: received response %s", p.Name, stdout.String())
+
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, ansi.Errorf("@R{plugin} @c{%s} @R{returned a malformed response}: %s", p.Name, err)
+	}
+	if resp.Error != "" {
+		return nil, ansi.Errorf("@R{plugin} @c{%s}@R{:} %s", p.Name, resp.Error)
+	}
+	return &resp, nil
+}
+
+func (p *PluginOperator) describe() {
+	if p.described {
+		return
+	}
+	p.described = true
+	p.phase = EvalPhase
+
+	DEBUG("asking plugin %s to describe itself", p.Name)
+	resp, err := p.call(pluginRequest{Action: "describe"})
+	if err != nil {
+		DEBUG("  plugin %s could not be described: %s", p.Name, err)
+		p.describeErr = err
+		return
+	}
+
+	p.phase, err = parsePhase(resp.Phase)
+	if err != nil {
+		p.describeErr = ansi.Errorf("@R{plugin} @c{%s}@R{:} %s", p.Name, err)
+		return
+	}
+	// what the configuration declared takes precedence
+	if p.dependencies == nil {
+		p.dependencies = resp.Dependencies
+	}
+	p.wantsTree = p.wantsTree || resp.Tree
+}
+
+// Setup ...
+func (p *PluginOperator) Setup() error {
+	return nil
+}
+
+// Phase asks the plugin which phase it belongs to, unless its configuration
+// already told us.  Plugins that can't answer are assumed to be EvalPhase.
+func (p *PluginOperator) Phase() OperatorPhase {
+	p.describe()
+	return p.phase
+}
+
+// Dependencies expands the path globs that the plugin declared as its
+// implicit dependencies, in addition to those given as arguments.
+func (p *PluginOperator) Dependencies(ev *Evaluator, _ []*Expr, _ []*tree.Cursor, auto []*tree.Cursor) []*tree.Cursor {
+	p.describe()
+
+	l := []*tree.Cursor{}
+	for _, path := range p.dependencies {
+		c, err := tree.ParseCursor(path)
+		if err != nil {
+			DEBUG("plugin %s declared an invalid dependency '%s': %s", p.Name, path, err)
+			continue
+		}
+		keys, err := c.Glob(ev.Tree)
+		if err != nil {
+			continue
+		}
+		l = append(l, keys...)
+	}
+
+	return append(l, auto...)
+}
+
+// Run ...
+func (p *PluginOperator) Run(ev *Evaluator, args []*Expr) (*Response, error) {
+	DEBUG("running (( %s ... )) plugin operation at $.%s", p.Name, ev.Here)
+	defer DEBUG("done with (( %s ... )) plugin operation at $%s\n", p.Name, ev.Here)
+
+	p.describe()
+	if p.describeErr != nil {
+		return nil, p.describeErr
+	}
+
+	req := pluginRequest{Action: "run", Args: []interface{}{}, Path: ev.Here.String()}
+	for i, arg := range args {
+		v, err := arg.Resolve(ev.Tree)
+		if err != nil {
+			DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
+			return nil, err
+		}
+
+		var val interface{}
+		switch v.Type {
+		case Literal:
+			DEBUG("  arg[%d]: found literal '%v'", i, v.Literal)
+			val = v.Literal
+
+		case Reference:
+			DEBUG("  arg[%d]: trying to resolve reference $.%s", i, v.Reference)
+			val, err = v.Reference.Resolve(ev.Tree)
+			if err != nil {
+				DEBUG("     [%d]: resolution failed\n    error: %s", i, err)
+				return nil, fmt.Errorf("unable to resolve `%s`: %s", v.Reference, err)
+			}
+
+		default:
+			DEBUG("  arg[%d]: I don't know what to do with '%v'", i, arg)
+			return nil, fmt.Errorf("%s operator only accepts literal and key reference arguments", p.Name)
+		}
+
+		val, err = deinterface(val, false)
+		if err != nil {
+			return nil, err
+		}
+		req.Args = append(req.Args, val)
+	}
+
+	if p.wantsTree {
+		t, err := deinterface(ev.Tree, false)
+		if err != nil {
+			return nil, err
+		}
+		req.Tree = t
+	}
+
+	resp, err := p.call(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if len(resp.Value) > 0 {
+		value, err = decodeJSON(resp.Value)
+		if err != nil {
+			return nil, ansi.Errorf("@R{plugin} @c{%s} @R{returned a malformed value}: %s", p.Name, err)
+		}
+	}
+
+	switch strings.ToLower(resp.Type) {
+	case "", "replace":
+		DEBUG("  plugin replied with a replacement value")
+		return &Response{Type: Replace, Value: value}, nil
+
+	case "inject":
+		if _, ok := value.(map[interface{}]interface{}); !ok {
+			return nil, ansi.Errorf("@R{plugin} @c{%s} @R{asked to inject a value that is not a map}", p.Name)
+		}
+		DEBUG("  plugin replied with a map to inject")
+		return &Response{Type: Inject, Value: value}, nil
+	}
+
+	return nil, ansi.Errorf("@R{plugin} @c{%s} @R{returned unknown response type} @c{%s}", p.Name, resp.Type)
+}
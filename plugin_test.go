@@ -0,0 +1,186 @@
+package spruce
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Operator Plugins", func() {
+	var dir string
+
+	plugin := func(name string, script string) string {
+		path := filepath.Join(dir, PluginPrefix+name)
+		err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755) // #nosec G306 -- test plugin must be executable
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	AfterEach(func() {
+		for name, op := range OpRegistry {
+			if _, ok := op.(*PluginOperator); ok {
+				delete(OpRegistry, name)
+			}
+		}
+	})
+
+	Context("discovered on a search path", func() {
+		It("registers executables named spruce-op-*", func() {
+			plugin("hello", `cat >/dev/null; echo '{"type":"replace","value":"hello"}'`)
+			Expect(os.WriteFile(filepath.Join(dir, PluginPrefix+"noexec"), []byte("#!/bin/sh\n"), 0600)).To(Succeed())
+
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+			Expect(OpRegistry).To(HaveKey("hello"))
+			Expect(OpRegistry).NotTo(HaveKey("noexec"))
+		})
+
+		It("refuses to shadow built-in operators", func() {
+			plugin("grab", `echo '{}'`)
+			err := DiscoverPlugins(dir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("conflicts with the built-in"))
+			Expect(OpRegistry["grab"]).To(Equal(GrabOperator{}))
+		})
+	})
+
+	Context("when not used", func() {
+		It("does not run the plugin", func() {
+			ran := filepath.Join(dir, "ran")
+			plugin("unused", `touch `+ran+`; echo '{"phase":"eval"}'`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("meta:\n  name: (( concat \"a\" \"b\" ))")}
+			Expect(ev.Run(nil, nil)).To(Succeed())
+			Expect(ran).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when evaluated", func() {
+		It("sends resolved arguments and the current path to the plugin", func() {
+			// echo the request back as the value, so we can inspect it
+			plugin("echo", `printf '{"type":"replace","value":'; cat; printf '}'`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("meta:\n  list: [a, b]\nout:\n  result: (( echo \"lit\" 42 meta.list ))")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+
+			req := ev.Tree["out"].(map[interface{}]interface{})["result"].(map[interface{}]interface{})
+			Expect(req["version"]).To(Equal(int64(PluginProtocolVersion)))
+			Expect(req["action"]).To(Equal("run"))
+			Expect(req["operator"]).To(Equal("echo"))
+			Expect(req["path"]).To(Equal("out.result"))
+			Expect(req["args"]).To(Equal([]interface{}{"lit", int64(42), []interface{}{"a", "b"}}))
+			Expect(req).NotTo(HaveKey("tree"))
+		})
+
+		It("injects maps when asked to", func() {
+			plugin("defaults", `cat >/dev/null; echo '{"type":"inject","value":{"a":1,"b":"two"}}'`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("thing:\n  b: mine\n  x: (( defaults ))")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+			Expect(ev.Tree["thing"]).To(Equal(map[interface{}]interface{}{"a": int64(1), "b": "mine"}))
+		})
+
+		It("reports errors returned by the plugin", func() {
+			plugin("broken", `cat >/dev/null; echo '{"error":"the flux capacitor is empty"}'`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("x: (( broken ))")}
+			err := ev.RunPhase(EvalPhase)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("the flux capacitor is empty"))
+		})
+
+		It("reports the stderr of plugins that exit non-zero", func() {
+			plugin("crash", `cat >/dev/null; echo 'kaboom' >&2; exit 3`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("x: (( crash ))")}
+			err := ev.RunPhase(EvalPhase)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("plugin crash failed: kaboom"))
+		})
+	})
+
+	Context("when described", func() {
+		It("honors the declared phase, dependencies and tree request", func() {
+			plugin("count", `
+if grep -q '"describe"'; then
+  echo '{"phase":"eval","dependencies":["jobs.*.instances"],"tree":true}'
+else
+  echo '{"type":"replace","value":"saw the tree"}'
+fi`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("jobs:\n  - name: a\n    instances: (( grab meta.count ))\nmeta:\n  count: 2\naaa: (( count ))")}
+			ops, err := ev.DataFlow(EvalPhase)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[0].src).To(Equal("(( grab meta.count ))"))
+			Expect(ops[1].src).To(Equal("(( count ))"))
+
+			Expect(ev.RunOps(ops)).To(Succeed())
+			Expect(ev.Tree["aaa"]).To(Equal("saw the tree"))
+		})
+
+		It("skips plugins declared for other phases", func() {
+			plugin("early", `echo '{"phase":"merge"}'`)
+			Expect(DiscoverPlugins(dir)).To(Succeed())
+
+			op, err := ParseOpcall(EvalPhase, "(( early ))")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op).To(BeNil())
+		})
+	})
+
+	Context("declared in a configuration file", func() {
+		It("registers plugins without asking them to describe themselves", func() {
+			cmd := plugin("whatever", `grep -q '"describe"' && exit 1; cat >/dev/null; echo '{"value":[1,2.5,true]}'`)
+			config := filepath.Join(dir, "plugins.yml")
+			Expect(os.WriteFile(config, []byte("plugins:\n- name: nums\n  command: "+cmd+"\n  phase: eval\n"), 0600)).To(Succeed())
+
+			Expect(LoadPluginConfig(config)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("x: (( nums ))")}
+			Expect(ev.RunPhase(EvalPhase)).To(Succeed())
+			Expect(ev.Tree["x"]).To(Equal([]interface{}{int64(1), 2.5, true}))
+		})
+
+		It("honors declared dependencies and tree requests without a phase", func() {
+			cmd := plugin("count", `
+if grep -q '"describe"'; then
+  echo '{"phase":"eval"}'
+else
+  echo '{"type":"replace","value":"saw the tree"}'
+fi`)
+			config := filepath.Join(dir, "plugins.yml")
+			Expect(os.WriteFile(config, []byte("plugins:\n- name: count\n  command: "+cmd+"\n  dependencies: [jobs.*.instances]\n  tree: true\n"), 0600)).To(Succeed())
+			Expect(LoadPluginConfig(config)).To(Succeed())
+
+			ev := &Evaluator{Tree: evalYAML("jobs:\n  - name: a\n    instances: (( grab meta.count ))\nmeta:\n  count: 2\naaa: (( count ))")}
+			ops, err := ev.DataFlow(EvalPhase)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ops).To(HaveLen(2))
+			Expect(ops[0].src).To(Equal("(( grab meta.count ))"))
+			Expect(ops[1].src).To(Equal("(( count ))"))
+
+			Expect(OpRegistry["count"].(*PluginOperator).wantsTree).To(BeTrue())
+		})
+
+		It("rejects unknown phases", func() {
+			config := filepath.Join(dir, "plugins.yml")
+			Expect(os.WriteFile(config, []byte("plugins:\n- name: x\n  command: /bin/true\n  phase: later\n"), 0600)).To(Succeed())
+
+			err := LoadPluginConfig(config)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown operator phase 'later'"))
+		})
+	})
+})
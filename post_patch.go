@@ -0,0 +1,119 @@
+package spruce
+
+import (
+	"os"
+
+	"github.com/cppforlife/go-patch/patch"
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// PostPatch is a go-patch ops-file that the Evaluator applies to the tree
+// once it has been evaluated, so that its operations can see (and change)
+// the values that spruce operators produced.
+type PostPatch struct {
+	Source string
+
+	defs []patch.OpDefinition
+	ops  patch.Ops
+}
+
+// LoadPostPatch reads a go-patch ops-file, for Evaluator.PostPatches
+func LoadPostPatch(file string) (PostPatch, error) {
+	b, err := os.ReadFile(file) // #nosec G304 -- user-specified file path is core CLI functionality
+	if err != nil {
+		return PostPatch{}, ansi.Errorf("@R{Error reading file} @m{%s}: %s", file, err)
+	}
+	return ParsePostPatch(file, b)
+}
+
+// ParsePostPatch parses the go-patch operations in data, which came from
+// source (for error messages)
+func ParsePostPatch(source string, data []byte) (PostPatch, error) {
+	defs := []patch.OpDefinition{}
+	if err := yaml.Unmarshal(data, &defs); err != nil {
+		return PostPatch{}, ansi.Errorf("@m{%s}: @R{Unable to parse go-patch operations}: %s", source, err)
+	}
+	ops, err := patch.NewOpsFromDefinitions(defs)
+	if err != nil {
+		return PostPatch{}, ansi.Errorf("@m{%s}: @R{Unable to parse go-patch operations}: %s", source, err)
+	}
+	return PostPatch{Source: source, defs: defs, ops: ops}, nil
+}
+
+// Apply applies the operations to a copy of the tree one at a time,
+// returning the patched copy. Errors name the operation that failed.
+func (p PostPatch) Apply(tree map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	// go-patch changes the tree in place, so work on a copy to leave the tree
+	// untouched if an operation fails halfway through the file
+	doc := deepCopy(tree)
+	for i, op := range p.ops {
+		def := p.defs[i]
+		path := ""
+		if def.Path != nil {
+			path = *def.Path
+		}
+
+		DEBUG("%s: applying post-evaluation go-patch operation #%d (%s %s)", p.Source, i, def.Type, path)
+		next, err := op.Apply(doc)
+		if err != nil {
+			return nil, ansi.Errorf("@m{%s}: @R{operation} @c{#%d} @R{(type: %s, path: %s) failed}: %s", p.Source, i, def.Type, path, err)
+		}
+		doc = next
+	}
+
+	result, ok := doc.(map[interface{}]interface{})
+	if !ok {
+		return nil, ansi.Errorf("@m{%s}: @R{Unable to convert go-patch output into a hash/map}", p.Source)
+	}
+	return result, nil
+}
+
+// applyPostPatches applies each of the Evaluator's PostPatches in turn. If
+// one fails, the tree is left as the ones before it made it.
+func (ev *Evaluator) applyPostPatches() error {
+	for _, p := range ev.PostPatches {
+		tree, err := p.Apply(ev.Tree)
+		if err != nil {
+			return err
+		}
+		ev.Tree = tree
+	}
+	if len(ev.PostPatches) > 0 {
+		forgetRemovedPaths(ev.Tree)
+	}
+	return nil
+}
+
+// forgetRemovedPaths drops the paths marked for pruning or sorting that are
+// no longer in the tree, because a post-patch removed them
+func forgetRemovedPaths(root map[interface{}]interface{}) {
+	exists := func(path string) bool {
+		c, err := tree.ParseCursor(path)
+		if err != nil {
+			return true // let Prune and SortPaths report it
+		}
+		_, err = c.Resolve(root)
+		return err == nil
+	}
+
+	prune := []string{}
+	for _, path := range keysToPrune {
+		if exists(path) {
+			prune = append(prune, path)
+		} else {
+			DEBUG("%s: no longer pruning, since a post-patch removed it", path)
+		}
+	}
+	keysToPrune = prune
+
+	for path := range pathsToSort {
+		if !exists(path) {
+			DEBUG("%s: no longer sorting, since a post-patch removed it", path)
+			delete(pathsToSort, path)
+		}
+	}
+}
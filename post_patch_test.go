@@ -0,0 +1,92 @@
+package spruce
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Post-evaluation go-patches", func() {
+	var tree map[interface{}]interface{}
+
+	BeforeEach(func() {
+		tree = map[interface{}]interface{}{
+			"meta": map[interface{}]interface{}{
+				"env":  "prod",
+				"name": `(( concat "web-" meta.env ))`,
+			},
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"name": "(( grab meta.name ))", "instances": 1},
+			},
+		}
+	})
+
+	It("applies the operations to the evaluated tree, before pruning", func() {
+		p, err := ParsePostPatch("ops.yml", []byte(`
+- type: replace
+  path: /jobs/name=web-prod/instances
+  value: 3
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ev := &Evaluator{Tree: tree, PostPatches: []PostPatch{p}}
+		Expect(ev.Run([]string{"meta"}, nil)).To(Succeed())
+		Expect(ev.Tree).To(Equal(map[interface{}]interface{}{
+			"jobs": []interface{}{
+				map[interface{}]interface{}{"name": "web-prod", "instances": 3},
+			},
+		}))
+	})
+
+	It("names the operation that failed", func() {
+		p, err := ParsePostPatch("ops.yml", []byte(`
+- type: remove
+  path: /meta/env
+- type: replace
+  path: /jobs/name=web-dev/instances
+  value: 3
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ev := &Evaluator{Tree: tree, PostPatches: []PostPatch{p}}
+		err = ev.Run(nil, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("ops.yml: operation #1 (type: replace, path: /jobs/name=web-dev/instances) failed: "))
+		Expect(ev.Tree["meta"]).To(HaveKey("env"))
+	})
+
+	It("does not sort or prune what the operations removed", func() {
+		tree["zones"] = []interface{}{"z2", "z1"}
+		addToSortListIfNecessary("(( sort ))", "zones")
+		addToPruneListIfNecessary("zones")
+		p, err := ParsePostPatch("ops.yml", []byte(`
+- type: remove
+  path: /zones
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ev := &Evaluator{Tree: tree, PostPatches: []PostPatch{p}}
+		Expect(ev.Run(nil, nil)).To(Succeed())
+		Expect(ev.Tree).NotTo(HaveKey("zones"))
+	})
+
+	It("is not applied if evaluation failed", func() {
+		tree["meta"].(map[interface{}]interface{})["env"] = "(( grab meta.missing ))"
+		p, err := ParsePostPatch("ops.yml", []byte(`
+- type: remove
+  path: /meta/region
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ev := &Evaluator{Tree: tree, PostPatches: []PostPatch{p}}
+		err = ev.Run(nil, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("meta.missing"))
+		Expect(err.Error()).NotTo(ContainSubstring("ops.yml"))
+	})
+
+	It("reports operations that cannot be parsed", func() {
+		_, err := ParsePostPatch("ops.yml", []byte(`[{type: frob, path: /x}]`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("ops.yml: Unable to parse go-patch operations: Unknown operation [0] with type 'frob'"))
+	})
+})
@@ -0,0 +1,806 @@
+package spruce
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/starkandwayne/goutils/ansi"
+	"github.com/starkandwayne/goutils/tree"
+)
+
+// Query is a parsed JSONPath expression, as used by the (( query ... ))
+// operator and the `spruce query` command.  The supported syntax is:
+//
+//	$                  the root of the document (optional)
+//	.name  ['name']    a map key (or the name / key / id of a list entry)
+//	.*  [*]            every child of a map or list
+//	[0]  [-1]          a list index, counting from the end if negative
+//	[1:3]  [::2]       a list slice, as [start:end:step]
+//	[0,'a']            a union of any of the above
+//	..name  ..*        recursive descent
+//	[?(<filter>)]      every child for which the filter is true
+//
+// Filters can reference the child under test as @, and the document root
+// as $, and support ==, !=, <, <=, >, >=, =~ (regular expression match),
+// &&, ||, ! and parentheses.  A path on its own tests for existence.
+type Query struct {
+	src      string
+	segments []querySegment
+}
+
+// QueryResult is a single node matched by a Query
+type QueryResult struct {
+	Path  *tree.Cursor
+	Value interface{}
+}
+
+type querySegment struct {
+	descendant bool
+	selectors  []querySelector
+}
+
+const (
+	selectName = iota
+	selectWildcard
+	selectIndex
+	selectSlice
+	selectFilter
+)
+
+type querySelector struct {
+	kind   int
+	name   string
+	index  int
+	slice  [3]*int
+	filter *queryFilter
+}
+
+type queryFilter struct {
+	op          string // ||, &&, !, a comparison, "path" or "literal"
+	left, right *queryFilter
+
+	absolute bool // for paths, $ instead of @
+	segments []querySegment
+
+	literal interface{}
+	re      *regexp.Regexp
+}
+
+type queryNode struct {
+	path  []string
+	value interface{}
+}
+
+// queryEval holds the state of a single evaluation of a Query.  When
+// conservative is set (during dependency analysis), filters match every
+// node they are given, so that the results are a superset of whatever
+// will match once the rest of the document has been evaluated.
+type queryEval struct {
+	root         interface{}
+	conservative bool
+	reads        [][]string
+	deadEnds     [][]string
+}
+
+// ParseQuery parses a JSONPath expression.  For convenience, the leading
+// `$` may be omitted, making `jobs[0].name` the same as `$.jobs[0].name`.
+func ParseQuery(src string) (*Query, error) {
+	p := &queryParser{src: src}
+	p.skipSpace()
+
+	if p.peek() == '$' {
+		p.pos++
+	} else if p.pos < len(p.src) && p.peek() != '.' && p.peek() != '[' {
+		// a bare leading name, as in `jobs.web`
+		name := p.name()
+		if name == "" {
+			return nil, p.errorf("expected `$` or a key name")
+		}
+		p.segments = append(p.segments, querySegment{selectors: []querySelector{{kind: selectName, name: name}}})
+	}
+
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected `%s`", p.src[p.pos:])
+	}
+
+	return &Query{src: src, segments: append(p.segments, segments...)}, nil
+}
+
+// String returns the original source of the query
+func (q *Query) String() string {
+	return q.src
+}
+
+// Definite returns true if the query can only ever match a single node,
+// because it consists solely of key names and list indices.
+func (q *Query) Definite() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		if k := seg.selectors[0].kind; k != selectName && k != selectIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// Run evaluates the query against the given document, returning every
+// matching node, in document order.
+func (q *Query) Run(t interface{}) []QueryResult {
+	qe := &queryEval{root: t}
+	nodes := qe.apply([]queryNode{{path: []string{}, value: t}}, q.segments)
+
+	results := make([]QueryResult, len(nodes))
+	for i, n := range nodes {
+		results[i] = QueryResult{Path: &tree.Cursor{Nodes: n.path}, Value: n.value}
+	}
+	return results
+}
+
+func (qe *queryEval) apply(nodes []queryNode, segments []querySegment) []queryNode {
+	for _, seg := range segments {
+		next := []queryNode{}
+		for _, n := range nodes {
+			candidates := []queryNode{n}
+			if seg.descendant {
+				candidates = queryDescendants(n)
+			}
+			for _, c := range candidates {
+				for _, sel := range seg.selectors {
+					next = append(next, qe.selectFrom(c, sel)...)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func queryChild(n queryNode, key string, v interface{}) queryNode {
+	path := make([]string, len(n.path), len(n.path)+1)
+	copy(path, n.path)
+	return queryNode{path: append(path, key), value: v}
+}
+
+func queryDescendants(n queryNode) []queryNode {
+	l := []queryNode{n}
+	keys, vals := orderedChildren(n.value)
+	for i := range keys {
+		l = append(l, queryDescendants(queryChild(n, keys[i], vals[i]))...)
+	}
+	return l
+}
+
+func (qe *queryEval) selectFrom(n queryNode, sel querySelector) []queryNode {
+	switch sel.kind {
+	case selectName:
+		if v, key, ok := globStep(n.value, sel.name); ok {
+			return []queryNode{queryChild(n, key, v)}
+		}
+
+	case selectWildcard:
+		keys, vals := orderedChildren(n.value)
+		l := []queryNode{}
+		for i := range keys {
+			l = append(l, queryChild(n, keys[i], vals[i]))
+		}
+		if len(keys) > 0 {
+			return l
+		}
+
+	case selectIndex:
+		if list, ok := n.value.([]interface{}); ok {
+			i := sel.index
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				return []queryNode{queryChild(n, strconv.Itoa(i), list[i])}
+			}
+			return nil
+		}
+
+	case selectSlice:
+		if list, ok := n.value.([]interface{}); ok {
+			l := []queryNode{}
+			for _, i := range sliceIndices(len(list), sel.slice) {
+				l = append(l, queryChild(n, strconv.Itoa(i), list[i]))
+			}
+			return l
+		}
+
+	case selectFilter:
+		keys, vals := orderedChildren(n.value)
+		l := []queryNode{}
+		for i := range keys {
+			c := queryChild(n, keys[i], vals[i])
+			if qe.truthy(sel.filter, c) || qe.conservative {
+				l = append(l, c)
+			}
+		}
+		if len(keys) > 0 {
+			return l
+		}
+	}
+
+	// we couldn't descend any further; remember where, since the value
+	// here may not have been evaluated yet
+	qe.deadEnds = append(qe.deadEnds, n.path)
+	return nil
+}
+
+// sliceIndices returns the indices selected by a [start:end:step] slice
+// of a list of length n, following the semantics of Python slices.
+func sliceIndices(n int, slice [3]*int) []int {
+	step := 1
+	if slice[2] != nil {
+		step = *slice[2]
+	}
+	if step == 0 {
+		return nil
+	}
+
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		if step > 0 {
+			return clampIndex(i, 0, n)
+		}
+		return clampIndex(i, -1, n-1)
+	}
+
+	l := []int{}
+	if step > 0 {
+		for i := bound(slice[0], 0); i < bound(slice[1], n); i += step {
+			l = append(l, i)
+		}
+	} else {
+		for i := bound(slice[0], n-1); i > bound(slice[1], -1); i += step {
+			l = append(l, i)
+		}
+	}
+	return l
+}
+
+func clampIndex(i, lo, hi int) int {
+	if i < lo {
+		return lo
+	}
+	if i > hi {
+		return hi
+	}
+	return i
+}
+
+// value evaluates a filter expression against the node under test,
+// returning its value, and whether or not it exists at all.
+func (qe *queryEval) value(f *queryFilter, n queryNode) (interface{}, bool) {
+	switch f.op {
+	case "literal":
+		return f.literal, true
+
+	case "path":
+		start := n
+		if f.absolute {
+			start = queryNode{path: []string{}, value: qe.root}
+		}
+		found := qe.apply([]queryNode{start}, f.segments)
+		for _, r := range found {
+			qe.reads = append(qe.reads, r.path)
+		}
+		switch len(found) {
+		case 0:
+			return nil, false
+		case 1:
+			return found[0].value, true
+		}
+		l := make([]interface{}, len(found))
+		for i, r := range found {
+			l[i] = r.value
+		}
+		return l, true
+	}
+
+	return qe.truthy(f, n), true
+}
+
+func (qe *queryEval) truthy(f *queryFilter, n queryNode) bool {
+	switch f.op {
+	case "||", "&&":
+		a := qe.truthy(f.left, n)
+		if qe.conservative {
+			// evaluate both sides, to find everything the filter looks at
+			b := qe.truthy(f.right, n)
+			return a || b
+		}
+		if f.op == "||" {
+			return a || qe.truthy(f.right, n)
+		}
+		return a && qe.truthy(f.right, n)
+
+	case "!":
+		return !qe.truthy(f.left, n)
+
+	case "path":
+		_, ok := qe.value(f, n)
+		return ok
+
+	case "literal":
+		return f.literal != nil && f.literal != false
+
+	case "=~":
+		v, ok := qe.value(f.left, n)
+		if s, isString := v.(string); ok && isString {
+			return f.re.MatchString(s)
+		}
+		return false
+	}
+
+	a, aok := qe.value(f.left, n)
+	b, bok := qe.value(f.right, n)
+	if !aok || !bok {
+		// comparisons involving missing values only hold for inequality,
+		// unless both sides are missing
+		switch f.op {
+		case "==", "<=", ">=":
+			return !aok && !bok
+		case "!=":
+			return aok != bok
+		}
+		return false
+	}
+
+	switch f.op {
+	case "==":
+		return equalValues(a, b)
+	case "!=":
+		return !equalValues(a, b)
+	}
+
+	cmp, ok := queryCompare(a, b)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func queryNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equalValues compares two values deeply, treating all numeric types as
+// interchangeable, since literals and parsed YAML use different ones.
+func equalValues(a, b interface{}) bool {
+	if x, ok := queryNumber(a); ok {
+		if y, ok := queryNumber(b); ok {
+			return x == y
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func queryCompare(a, b interface{}) (int, bool) {
+	if x, ok := queryNumber(a); ok {
+		if y, ok := queryNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+type queryParser struct {
+	src      string
+	pos      int
+	segments []querySegment
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return ansi.Errorf("@R{invalid query} @c{%s}@R{:} %s (at position %d)", p.src, fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *queryParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *queryParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(".[]()=!<>&|,~*'\" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *queryParser) parseSegments() ([]querySegment, error) {
+	segments := []querySegment{}
+	for {
+		var seg querySegment
+		switch {
+		case p.consume(".."):
+			seg.descendant = true
+			if p.peek() == '[' {
+				break
+			}
+			fallthrough
+
+		case p.consume("."):
+			if p.consume("*") {
+				seg.selectors = []querySelector{{kind: selectWildcard}}
+				break
+			}
+			name := p.name()
+			if name == "" {
+				return nil, p.errorf("expected a key name")
+			}
+			seg.selectors = []querySelector{{kind: selectName, name: name}}
+
+		case p.peek() == '[':
+
+		default:
+			return segments, nil
+		}
+
+		if seg.selectors == nil {
+			p.consume("[")
+			sels, err := p.parseSelectors()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = sels
+		}
+		segments = append(segments, seg)
+	}
+}
+
+func (p *queryParser) parseSelectors() ([]querySelector, error) {
+	sels := []querySelector{}
+	for {
+		p.skipSpace()
+		var sel querySelector
+		switch c := p.peek(); {
+		case c == '*':
+			p.pos++
+			sel.kind = selectWildcard
+
+		case c == '\'' || c == '"':
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			sel.kind = selectName
+			sel.name = s
+
+		case c == '?':
+			p.pos++
+			f, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			sel.kind = selectFilter
+			sel.filter = f
+
+		case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+			var err error
+			sel, err = p.parseIndexOrSlice()
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, p.errorf("expected a selector inside [...]")
+		}
+		sels = append(sels, sel)
+
+		p.skipSpace()
+		if p.consume("]") {
+			return sels, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected `,` or `]`")
+		}
+	}
+}
+
+func (p *queryParser) parseInt() (*int, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return nil, p.errorf("invalid integer `%s`", p.src[start:p.pos])
+	}
+	return &i, nil
+}
+
+func (p *queryParser) parseIndexOrSlice() (querySelector, error) {
+	sel := querySelector{kind: selectIndex}
+	for part := 0; part < 3; part++ {
+		p.skipSpace()
+		i, err := p.parseInt()
+		if err != nil {
+			return sel, err
+		}
+		sel.slice[part] = i
+		p.skipSpace()
+		if !p.consume(":") {
+			break
+		}
+		sel.kind = selectSlice
+	}
+
+	if sel.kind == selectIndex {
+		if sel.slice[0] == nil {
+			return sel, p.errorf("expected a list index")
+		}
+		sel.index = *sel.slice[0]
+	}
+	return sel, nil
+}
+
+func (p *queryParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+			c = p.src[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *queryParser) parseOr() (*queryFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryFilter{op: "||", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseAnd() (*queryFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryFilter{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseNot() (*queryFilter, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "!") && !strings.HasPrefix(p.src[p.pos:], "!=") {
+		p.pos++
+		f, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &queryFilter{op: "!", left: f}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (*queryFilter, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.consume("=~") {
+		p.skipSpace()
+		var pattern string
+		switch p.peek() {
+		case '\'', '"':
+			pattern, err = p.parseString()
+		case '/':
+			pattern, err = p.parseRegex()
+		default:
+			err = p.errorf("expected a regular expression after `=~`")
+		}
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression `%s`: %s", pattern, err)
+		}
+		return &queryFilter{op: "=~", left: left, re: re}, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return &queryFilter{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+// parseRegex parses a /pattern/flags regular expression literal
+func (p *queryParser) parseRegex() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) && p.src[p.pos] != '/' {
+		if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/' {
+			p.pos++
+		}
+		b.WriteByte(p.src[p.pos])
+		p.pos++
+	}
+	if !p.consume("/") {
+		return "", p.errorf("unterminated regular expression")
+	}
+
+	flags := ""
+	for p.pos < len(p.src) && strings.ContainsRune("imsU", rune(p.src[p.pos])) {
+		flags += string(p.src[p.pos])
+		p.pos++
+	}
+	if flags != "" {
+		return "(?" + flags + ")" + b.String(), nil
+	}
+	return b.String(), nil
+}
+
+func (p *queryParser) parsePrimary() (*queryFilter, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected `)`")
+		}
+		return f, nil
+
+	case c == '@' || c == '$':
+		p.pos++
+		segments, err := p.parseSegments()
+		if err != nil {
+			return nil, err
+		}
+		return &queryFilter{op: "path", absolute: c == '$', segments: segments}, nil
+
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &queryFilter{op: "literal", literal: s}, nil
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.ContainsRune("0123456789.eE+-", rune(p.src[p.pos])) {
+			p.pos++
+		}
+		num := p.src[start:p.pos]
+		if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+			return &queryFilter{op: "literal", literal: i}, nil
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number `%s`", num)
+		}
+		return &queryFilter{op: "literal", literal: f}, nil
+	}
+
+	for word, v := range map[string]interface{}{"true": true, "false": false, "null": nil} {
+		if p.consume(word) {
+			return &queryFilter{op: "literal", literal: v}, nil
+		}
+	}
+	return nil, p.errorf("expected a path, a literal value or `(`")
+}
@@ -0,0 +1,44 @@
+package spruce
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"math/rand/v2"
+	"os"
+)
+
+// Seed makes the randomizing operators ((( shuffle )), (( random-string )),
+// (( uuid )), ...) deterministic.  When it is empty, $SPRUCE_SEED is
+// consulted instead, and if that is also unset, real randomness is used.
+var Seed string
+
+func randomSeed() string {
+	if Seed != "" {
+		return Seed
+	}
+	return os.Getenv("SPRUCE_SEED")
+}
+
+// randFor returns a random number generator for the operator currently
+// being evaluated.  Under a seed, the generator is derived from the seed,
+// the operator name and the path of the operator call, so that every call
+// site gets its own stable stream of values, and adding or removing one
+// call does not disturb the output of any of the others.  Entries of named
+// lists are addressed by name, so that they keep their values when other
+// entries are inserted before them; other list entries go by index.
+func randFor(ev *Evaluator, name string) *rand.Rand {
+	var key [32]byte
+
+	seed := randomSeed()
+	if seed == "" {
+		crand.Read(key[:]) // #nosec G104 -- crypto/rand.Read never returns an error
+		return rand.New(rand.NewChaCha8(key))
+	}
+
+	here := ""
+	if ev.Here != nil {
+		here = ev.Here.String()
+	}
+	key = sha256.Sum256([]byte(seed + "\x00" + name + "\x00" + here))
+	return rand.New(rand.NewChaCha8(key))
+}
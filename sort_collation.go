@@ -0,0 +1,256 @@
+package spruce
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// collate compares two values for (( sort )), returning a negative number,
+// zero or a positive number as a sorts before, with or after b.
+//
+//   - lexical (the default) compares strings byte by byte, and numbers
+//     numerically, whether they are integers or not
+//   - numeric compares strings as the numbers they contain; entries that
+//     aren't numbers sort after the ones that are
+//   - natural compares runs of digits numerically, and everything else
+//     lexically, so that web2 sorts before web10
+//   - semver compares semantic versions (with or without a leading v), so
+//     that 1.2.0-rc.1 sorts before 1.2.0; entries that aren't versions sort
+//     after the ones that are
+func collate(a interface{}, b interface{}, collation string) int {
+	switch collation {
+	case "numeric":
+		numA, okA := sortNumber(a, true)
+		numB, okB := sortNumber(b, true)
+		if c, done := collateValid(okA, okB); done {
+			return c
+		}
+		if okA {
+			return cmp.Compare(numA, numB)
+		}
+
+	case "natural":
+		if numA, ok := sortNumber(a, false); ok {
+			if numB, ok := sortNumber(b, false); ok {
+				return cmp.Compare(numA, numB)
+			}
+		}
+		return naturalCompare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+
+	case "semver":
+		versionA, okA := parseSortVersion(a)
+		versionB, okB := parseSortVersion(b)
+		if c, done := collateValid(okA, okB); done {
+			return c
+		}
+		if okA {
+			return versionA.compare(versionB)
+		}
+		return naturalCompare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+
+	case bool:
+		if b, ok := b.(bool); ok && a != b {
+			if a {
+				return 1
+			}
+			return -1
+		}
+
+	default:
+		if numA, ok := sortNumber(a, false); ok {
+			if numB, ok := sortNumber(b, false); ok {
+				return cmp.Compare(numA, numB)
+			}
+		}
+	}
+
+	return 0
+}
+
+// collateValid orders valid entries before invalid ones, and reports whether
+// that settles it (i.e. they aren't both valid)
+func collateValid(okA bool, okB bool) (int, bool) {
+	switch {
+	case okA && !okB:
+		return -1, true
+	case !okA && okB:
+		return 1, true
+	}
+	return 0, false
+}
+
+// isSortNumber returns true if v is one of the number types YAML and JSON
+// values are parsed as
+func isSortNumber(v interface{}) bool {
+	_, ok := sortNumber(v, false)
+	return ok
+}
+
+// sortNumber returns v as a float64, if it is a number, or (if parse is true)
+// a string holding one
+func sortNumber(v interface{}, parse bool) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		if parse {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+// naturalCompare compares strings chunk by chunk, where a chunk is either a
+// run of digits (compared as a number) or a run of anything else (compared
+// lexically). Digits sort before anything else.
+func naturalCompare(a string, b string) int {
+	origA, origB := a, b
+	for a != "" && b != "" {
+		chunkA, chunkB := naturalChunk(a), naturalChunk(b)
+		a, b = a[len(chunkA):], b[len(chunkB):]
+
+		digitsA, digitsB := isDigit(chunkA[0]), isDigit(chunkB[0])
+		var c int
+		switch {
+		case digitsA && digitsB:
+			// compare the numbers without leading zeros by length first, so
+			// that there's no limit to how big they can be
+			numA, numB := strings.TrimLeft(chunkA, "0"), strings.TrimLeft(chunkB, "0")
+			if c = cmp.Compare(len(numA), len(numB)); c == 0 {
+				c = strings.Compare(numA, numB)
+			}
+		case digitsA:
+			c = -1
+		case digitsB:
+			c = 1
+		default:
+			c = strings.Compare(chunkA, chunkB)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	// only leading zeros differ (if anything), e.g. web01 and web1
+	return strings.Compare(origA, origB)
+}
+
+func naturalChunk(s string) string {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// sortVersion is a semantic version, as far as (( sort )) is concerned: any
+// number of dot-separated release numbers, and an optional pre-release.
+// Build metadata is ignored.
+type sortVersion struct {
+	release    []int
+	prerelease []string
+}
+
+func parseSortVersion(v interface{}) (sortVersion, bool) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case int, int64, uint64:
+		s = fmt.Sprintf("%d", v)
+	default:
+		return sortVersion{}, false
+	}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+
+	version := sortVersion{}
+	if i := strings.Index(s, "-"); i >= 0 {
+		version.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return sortVersion{}, false
+		}
+		version.release = append(version.release, n)
+	}
+	return version, true
+}
+
+// compare orders versions by their release numbers (where missing numbers
+// count as 0), then puts pre-releases before the release itself
+func (v sortVersion) compare(other sortVersion) int {
+	for i := 0; i < len(v.release) || i < len(other.release); i++ {
+		var a, b int
+		if i < len(v.release) {
+			a = v.release[i]
+		}
+		if i < len(other.release) {
+			b = other.release[i]
+		}
+		if c := cmp.Compare(a, b); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case v.prerelease == nil && other.prerelease == nil:
+		return 0
+	case v.prerelease == nil:
+		return 1
+	case other.prerelease == nil:
+		return -1
+	}
+
+	// pre-release identifiers compare numerically if they are numbers (which
+	// sort before the ones that aren't), lexically otherwise
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		numA, errA := strconv.Atoi(a)
+		numB, errB := strconv.Atoi(b)
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(numA, numB)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(a, b)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.prerelease), len(other.prerelease))
+}
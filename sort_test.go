@@ -62,6 +62,101 @@ var _ = Describe("Sort", func() {
 			}))
 		})
 
+		It("sorts named-entry lists by multiple and nested keys", func() {
+			list := []interface{}{
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "B"}, "az": "z1"},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "A"}, "az": "z2"},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "A"}, "az": "z1"},
+			}
+			err := sortList("some.path", list, "meta.name,az")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "A"}, "az": "z1"},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "A"}, "az": "z2"},
+				map[interface{}]interface{}{"meta": map[interface{}]interface{}{"name": "B"}, "az": "z1"},
+			}))
+		})
+
+		It("sorts integers and floats together", func() {
+			list := []interface{}{2.5, 1, 3, 2}
+			err := sortList("some.path", list, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{1, 2, 2.5, 3}))
+		})
+
+		It("sorts in descending order", func() {
+			list := []interface{}{"b", "c", "a"}
+			err := sortList("some.path", list, " desc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{"c", "b", "a"}))
+		})
+
+		It("sorts by multiple keys, each in its own direction", func() {
+			list := []interface{}{
+				map[interface{}]interface{}{"name": "a", "version": 1},
+				map[interface{}]interface{}{"name": "b", "version": 2},
+				map[interface{}]interface{}{"name": "a", "version": 2},
+			}
+			err := sortList("some.path", list, "name desc,version")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "b", "version": 2},
+				map[interface{}]interface{}{"name": "a", "version": 1},
+				map[interface{}]interface{}{"name": "a", "version": 2},
+			}))
+		})
+
+		It("sorts named-entry lists by name key with modifiers alone", func() {
+			list := []interface{}{
+				map[interface{}]interface{}{"name": "web2"},
+				map[interface{}]interface{}{"name": "web10"},
+				map[interface{}]interface{}{"name": "web1"},
+			}
+			err := sortList("some.path", list, " natural desc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "web10"},
+				map[interface{}]interface{}{"name": "web2"},
+				map[interface{}]interface{}{"name": "web1"},
+			}))
+		})
+
+		It("sorts naturally", func() {
+			list := []interface{}{"web10", "web2", "db", "web1", "web02"}
+			err := sortList("some.path", list, " natural")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{"db", "web1", "web02", "web2", "web10"}))
+		})
+
+		It("sorts numerically, with non-numbers last", func() {
+			list := []interface{}{"10", 9, "n/a", "1.5"}
+			err := sortList("some.path", list, " numeric")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{"1.5", 9, "10", "n/a"}))
+		})
+
+		It("sorts semantic versions, with non-versions last", func() {
+			list := []interface{}{"1.10.0", "v1.2.0", "latest", "1.2.0-rc.10", "1.2.0-rc.2", "1.2.0-beta", "1.9"}
+			err := sortList("some.path", list, " semver")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{"1.2.0-beta", "1.2.0-rc.2", "1.2.0-rc.10", "v1.2.0", "1.9", "1.10.0", "latest"}))
+		})
+
+		It("sorts named-entry lists by semantic version, newest first", func() {
+			list := []interface{}{
+				map[interface{}]interface{}{"name": "a", "version": "1.2.3"},
+				map[interface{}]interface{}{"name": "b", "version": "1.10.0"},
+				map[interface{}]interface{}{"name": "c", "version": "1.2.3+build.7"},
+			}
+			err := sortList("some.path", list, "version semver desc,name")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(Equal([]interface{}{
+				map[interface{}]interface{}{"name": "b", "version": "1.10.0"},
+				map[interface{}]interface{}{"name": "a", "version": "1.2.3"},
+				map[interface{}]interface{}{"name": "c", "version": "1.2.3+build.7"},
+			}))
+		})
+
 		It("fails on lists of lists", func() {
 			list := []interface{}{
 				[]interface{}{"B", "A"},
@@ -116,6 +211,27 @@ var _ = Describe("Sort", func() {
 			Expect(pathsToSort).To(HaveKeyWithValue("releases", ""))
 		})
 
+		It("adds a composite sort-by-key entry for multiple key fields", func() {
+			addToSortListIfNecessary("(( sort by name, az ))", "jobs")
+			Expect(pathsToSort).To(HaveKeyWithValue("jobs", "name,az"))
+		})
+
+		It("records per-key modifiers after their field", func() {
+			addToSortListIfNecessary("(( sort by name desc, version semver ))", "releases")
+			Expect(pathsToSort).To(HaveKeyWithValue("releases", "name desc,version semver"))
+		})
+
+		It("records modifiers without a key field", func() {
+			addToSortListIfNecessary("(( sort desc natural ))", "azs")
+			Expect(pathsToSort).To(HaveKeyWithValue("azs", " desc natural"))
+		})
+
+		It("treats quoted modifier names as key fields", func() {
+			addToSortListIfNecessary(`(( sort by "desc" desc ))`, "jobs")
+			Expect(pathsToSort).To(HaveKeyWithValue("jobs", `"desc" desc`))
+			Expect(parseSortKeys(pathsToSort["jobs"])).To(Equal([]sortKey{{field: "desc", desc: true, collation: "lexical"}}))
+		})
+
 		It("does not overwrite an existing path entry", func() {
 			addToSortListIfNecessary("(( sort by name ))", "jobs")
 			addToSortListIfNecessary("(( sort by id ))", "jobs")
@@ -0,0 +1,170 @@
+package spruce
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geofffranks/yaml"
+	"github.com/starkandwayne/goutils/ansi"
+
+	. "github.com/geofffranks/spruce/log"
+)
+
+// X509StateFile is the path of a YAML file in which (( x509-ca )) and
+// (( x509-cert )) remember the certificates and keys they generate, so that
+// later runs hand back the same ones instead of generating new ones.
+var X509StateFile string
+
+var x509State map[string]map[string]string
+
+func loadX509State() error {
+	if x509State != nil {
+		return nil
+	}
+	x509State = map[string]map[string]string{}
+	if X509StateFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(X509StateFile) // #nosec G304 -- user-specified state file is core CLI functionality
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return ansi.Errorf("@R{unable to read x509 state file} @m{%s}: %s", X509StateFile, err)
+	}
+	if err := yaml.Unmarshal(b, &x509State); err != nil {
+		return ansi.Errorf("@R{unable to parse x509 state file} @m{%s}: %s", X509StateFile, err)
+	}
+	return nil
+}
+
+func saveX509State() error {
+	if X509StateFile == "" {
+		return nil
+	}
+	b, err := yaml.Marshal(x509State)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(X509StateFile, b, 0600); err != nil {
+		return ansi.Errorf("@R{unable to write x509 state file} @m{%s}: %s", X509StateFile, err)
+	}
+	return nil
+}
+
+// x509Request identifies what was asked of an x509 operator, so that the
+// state file is only consulted for exactly the same certificate request
+func x509Request(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateX509 creates a certificate from the template, and returns the
+// PEM-encoded certificate and private key.  The key and serial number
+// come from r, and the signature is deterministic (RFC 6979 for ECDSA), so
+// that certificates are reproducible under a --seed; the parent
+// certificate and signer default to self-signing when nil.
+func generateX509(r *rand.Rand, template, parent *x509.Certificate, signer crypto.Signer) (string, string, error) {
+	key, err := deriveECDSAKey(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	template.SerialNumber = new(big.Int).SetUint64(r.Uint64() >> 1)
+	if parent == nil {
+		parent, signer = template, key
+	}
+
+	// a nil source of randomness asks for a deterministic signature; the
+	// standard library ignores any other reader but its own
+	der, err := x509.CreateCertificate(nil, template, parent, key.Public(), signer)
+	if err != nil {
+		return "", "", ansi.Errorf("@R{unable to generate certificate}: %s", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	priv := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return string(cert), string(priv), nil
+}
+
+// deriveECDSAKey generates a P-256 key from r.  The standard library's key
+// generation always uses the system's randomness, so the scalar is drawn
+// from r directly, retrying in the (vanishingly rare) case that it falls
+// outside of the curve order.
+func deriveECDSAKey(r *rand.Rand) (*ecdsa.PrivateKey, error) {
+	b := make([]byte, 32)
+	for {
+		for i := range b {
+			b[i] = byte(r.UintN(256))
+		}
+		key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), b)
+		if err == nil {
+			return key, nil
+		}
+		DEBUG("  discarding out-of-range private key scalar: %s", err)
+	}
+}
+
+func x509Template(cn string, now time.Time, lifetime time.Duration) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:   pkix.Name{CommonName: cn},
+		NotBefore: now,
+		NotAfter:  now.Add(lifetime),
+	}
+}
+
+// parsePEMCertificate decodes the first certificate in a PEM string
+func parsePEMCertificate(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ansi.Errorf("@R{no PEM-encoded certificate found}")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to parse certificate}: %s", err)
+	}
+	return cert, nil
+}
+
+// parsePEMPrivateKey decodes a PKCS#8, PKCS#1 or SEC 1 private key
+func parsePEMPrivateKey(s string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, ansi.Errorf("@R{no PEM-encoded private key found}")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, ansi.Errorf("@R{unable to parse private key}: %s", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ansi.Errorf("@R{private key cannot be used for signing}")
+	}
+	return signer, nil
+}